@@ -0,0 +1,86 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+
+	"github.com/virtualtam/ccache_exporter/v4/pkg/ccache"
+)
+
+const (
+	capabilitiesCmdName string = "capabilities"
+)
+
+var (
+	capabilitiesFormatJson bool
+)
+
+// NewCapabilitiesCommand initializes and returns a CLI command to display the
+// commands, counters and configuration keys provided by the detected ccache binary.
+func NewCapabilitiesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   capabilitiesCmdName,
+		Short: "Display the capabilities of the ccache binary",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			caps, err := ccacheWrapper.Capabilities(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to detect ccache capabilities: %w", err)
+			}
+
+			if capabilitiesFormatJson {
+				capsBytes, err := json.Marshal(caps)
+				if err != nil {
+					return fmt.Errorf("failed to marshal capabilities as JSON: %w", err)
+				}
+
+				fmt.Println(string(capsBytes))
+
+				return nil
+			}
+
+			version, err := semver.NewVersion(caps.Version)
+			if err != nil {
+				return fmt.Errorf("failed to parse ccache version: %w", err)
+			}
+
+			fmt.Println("ccache version", caps.Version)
+			fmt.Println()
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+			fmt.Fprintln(tw, "KIND\tNAME\tVERSIONS\tSUPPORTED")
+
+			// capabilities listed several times are supported by one of their
+			// version ranges
+			for _, capability := range ccache.CapabilityMatrix() {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%t\n", capability.Kind, capability.Name, capability.VersionRange(), capability.SupportedBy(version))
+			}
+
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Println()
+			fmt.Println("Counters and configuration keys that are not listed, e.g. added by newer versions, are assumed to be supported.")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(
+		&capabilitiesFormatJson,
+		"json",
+		false,
+		"Format capabilities as JSON",
+	)
+
+	return cmd
+}
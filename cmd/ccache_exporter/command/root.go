@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -31,8 +33,11 @@ var (
 
 	versionDetails *version.Details
 
-	ccacheBinaryPath string
-	ccacheWrapper    *ccache.Wrapper
+	ccacheBinaryPath    string
+	ccacheCommandPrefix string
+	ccacheEnvironment   []string
+	ccacheTimeZone      string
+	ccacheWrapper       *ccache.Wrapper
 )
 
 // NewRootCommand initializes the exporter's CLI entrypoint and global command flags.
@@ -59,18 +64,67 @@ func NewRootCommand() *cobra.Command {
 				return err
 			}
 
-			// Setup ccache wrapper
-			ccacheCommand, err := ccache.NewLocalCommand(ccacheBinaryPath)
-			if err != nil {
-				log.Fatal().Err(err).Msg("ccache: failed to instantiate command wrapper")
+			// Setup ccache wrapper, unless statistics are read from the cache
+			// directory
+			var ccacheVersion string
+
+			if ccacheDirectory == "" {
+				var ccacheCommand ccache.Command
+
+				// the environment of the exporter is not passed to ccache,
+				// except for the cache directory, configuration file and
+				// variables allowed with --ccache-env
+				var commandOptions []ccache.LocalCommandOption
+
+				if len(ccacheEnvironment) > 0 {
+					environment := slices.Concat(ccache.DefaultEnvironment, ccacheEnvironment)
+					commandOptions = append(commandOptions, ccache.WithEnvironment(environment...))
+				}
+
+				if dir := os.Getenv("CCACHE_DIR"); dir != "" {
+					commandOptions = append(commandOptions, ccache.WithCacheDirectory(dir))
+				}
+				if configPath := os.Getenv("CCACHE_CONFIGPATH"); configPath != "" {
+					commandOptions = append(commandOptions, ccache.WithConfigPath(configPath))
+				}
+
+				switch {
+				case replayDirectory != "":
+					ccacheCommand, err = ccache.NewReplayCommand(replayDirectory, ccache.WithReplayInterval(replayInterval))
+				case ccacheCommandPrefix != "":
+					ccacheCommand, err = ccache.NewPrefixCommand(cmd.Context(), strings.Fields(ccacheCommandPrefix), ccacheBinaryPath, commandOptions...)
+				default:
+					ccacheCommand, err = ccache.NewLocalCommand(cmd.Context(), ccacheBinaryPath, commandOptions...)
+				}
+				if err != nil {
+					log.Fatal().Err(err).Msg("ccache: failed to instantiate command wrapper")
+				}
+
+				wrapperOptions := []ccache.WrapperOption{
+					ccache.WithVersionChangeHandler(logVersionChange),
+				}
+
+				if ccacheTimeZone != "" {
+					location, err := time.LoadLocation(ccacheTimeZone)
+					if err != nil {
+						return fmt.Errorf("invalid ccache time zone: %w", err)
+					}
+
+					wrapperOptions = append(wrapperOptions, ccache.WithLocation(location))
+				}
+
+				ccacheWrapper, err = ccache.NewWrapper(cmd.Context(), ccacheCommand, wrapperOptions...)
+				if err != nil {
+					log.Fatal().Err(err).Msg("ccache: failed to detect version")
+				}
+
+				ccacheVersion = ccacheWrapper.Version()
 			}
 
-			ccacheWrapper = ccache.NewWrapper(ccacheCommand)
-
 			// Retrieve exporter and ccache versions
-			versionDetails = version.NewDetails(ccacheWrapper.Version())
+			versionDetails = version.NewDetails(ccacheVersion)
 
-			if cmd.Name() == versionCmdName {
+			if cmd.Name() == versionCmdName || cmd.Name() == capabilitiesCmdName {
 				// Do not setup the service stack for these commands
 				return nil
 			}
@@ -86,8 +140,28 @@ func NewRootCommand() *cobra.Command {
 				log.Info().Strs("config_paths", configPaths).Msg("configuration: no file found")
 			}
 
+			if ccacheDirectory != "" {
+				log.Info().
+					Str("ccache_dir", ccacheDirectory).
+					Msg("ccache: reading statistics from the cache directory")
+
+				return nil
+			}
+
+			if replayDirectory != "" {
+				log.Info().
+					Str("replay_dir", replayDirectory).
+					Dur("replay_interval", replayInterval).
+					Str("ccache_version", ccacheWrapper.Version()).
+					Msg("ccache: replaying statistics from fixtures")
+
+				return nil
+			}
+
 			log.Info().
 				Str("ccache_binary", ccacheBinaryPath).
+				Str("ccache_command_prefix", ccacheCommandPrefix).
+				Strs("ccache_env", ccacheEnvironment).
 				Str("ccache_version", ccacheWrapper.Version()).
 				Msg("ccache: command wrapper created")
 
@@ -117,6 +191,41 @@ func NewRootCommand() *cobra.Command {
 		ccache.DefaultBinaryPath,
 		"Path to the ccache binary",
 	)
+	cmd.PersistentFlags().StringVar(
+		&ccacheCommandPrefix,
+		"ccache-command-prefix",
+		"",
+		"Command line prepended to ccache commands, e.g. \"sudo -u builder\"",
+	)
+	cmd.PersistentFlags().StringVar(
+		&ccacheTimeZone,
+		"ccache-time-zone",
+		"",
+		"Time zone of the host running ccache, e.g. \"Europe/Paris\", to read the statistics times printed by ccache < 3.7 (default: local time zone)",
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&ccacheEnvironment,
+		"ccache-env",
+		nil,
+		"Additional environment variables passed to ccache; a trailing \"*\" matches any prefix, e.g. \"CCACHE_*\"",
+	)
 
 	return cmd
 }
+
+// logVersionChange logs the version transition when ccache is upgraded or
+// downgraded in place.
+func logVersionChange(change ccache.VersionChange) {
+	event := log.Info().
+		Str("ccache_previous_version", change.Previous).
+		Str("ccache_version", change.Current)
+
+	if change.Binary != nil {
+		event = event.
+			Str("ccache_binary", change.Binary.Path).
+			Uint64("ccache_binary_inode", change.Binary.Inode).
+			Time("ccache_binary_mtime", change.Binary.ModTime)
+	}
+
+	event.Msg("ccache: version changed")
+}
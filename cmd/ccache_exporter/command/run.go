@@ -4,10 +4,13 @@
 package command
 
 import (
+	"time"
+
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
 	"github.com/virtualtam/ccache_exporter/v4/cmd/ccache_exporter/metrics"
+	"github.com/virtualtam/ccache_exporter/v4/pkg/ccache"
 )
 
 const (
@@ -15,7 +18,11 @@ const (
 )
 
 var (
-	listenAddr string
+	listenAddr      string
+	ccacheDirectory string
+	scrapeTimeout   time.Duration
+	replayDirectory string
+	replayInterval  time.Duration
 )
 
 // NewRunCommand initializes a CLI command to start the exporter's HTTP server.
@@ -24,7 +31,18 @@ func NewRunCommand() *cobra.Command {
 		Use:   "run",
 		Short: "Start the exporter's HTTP server",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			httpServer := metrics.NewServer(ccacheWrapper, listenAddr, versionDetails)
+			var source metrics.Source = ccacheWrapper
+
+			if ccacheDirectory != "" {
+				cacheDirectory, err := ccache.NewCacheDirectory(ccacheDirectory)
+				if err != nil {
+					return err
+				}
+
+				source = cacheDirectory
+			}
+
+			httpServer := metrics.NewServer(source, listenAddr, versionDetails, scrapeTimeout)
 
 			log.Info().Str("addr", listenAddr).Msg("starting HTTP server")
 			return httpServer.ListenAndServe()
@@ -37,6 +55,32 @@ func NewRunCommand() *cobra.Command {
 		defaultListenAddr,
 		"Listen to this address (host:port)",
 	)
+	cmd.Flags().StringVar(
+		&ccacheDirectory,
+		"ccache-dir",
+		"",
+		"Read statistics from the files stored in this cache directory instead of invoking the ccache binary",
+	)
+	cmd.Flags().StringVar(
+		&replayDirectory,
+		"replay",
+		"",
+		"Replay the ccache outputs captured in this fixture directory instead of invoking the ccache binary",
+	)
+	cmd.Flags().DurationVar(
+		&replayInterval,
+		"replay-interval",
+		0,
+		"Advance to the next replayed snapshot at this interval, rather than on every scrape",
+	)
+	cmd.MarkFlagsMutuallyExclusive("ccache-dir", "replay")
+
+	cmd.Flags().DurationVar(
+		&scrapeTimeout,
+		"scrape-timeout",
+		metrics.DefaultScrapeTimeout,
+		"Time allowed to collect ccache metrics, unless Prometheus sends its scrape timeout",
+	)
 
 	return cmd
 }
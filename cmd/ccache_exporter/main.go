@@ -22,6 +22,7 @@ func main() {
 
 	rootCommand := command.NewRootCommand()
 	rootCommand.AddCommand(
+		command.NewCapabilitiesCommand(),
 		command.NewRunCommand(),
 		command.NewVersionCommand(),
 	)
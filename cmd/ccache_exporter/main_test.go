@@ -0,0 +1,175 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/virtualtam/ccache_exporter/v4/pkg/ccache/ccachetest"
+)
+
+const (
+	// environment variable making the test binary run the exporter
+	runExporterEnv = "TEST_RUN_CCACHE_EXPORTER"
+
+	// time allowed to the exporter to start listening
+	startTimeout = 10 * time.Second
+)
+
+var (
+	testdataDir = filepath.Join("..", "..", "pkg", "ccache", "testdata")
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runExporterEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// startExporter runs the exporter with the given arguments in a subprocess,
+// and returns the URL of its metrics endpoint once it accepts connections.
+func startExporter(t *testing.T, args ...string) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %q", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	args = append(args, "--listen-addr", addr)
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runExporterEnv+"=1")
+	cmd.Stdout = io.Discard
+	cmd.Stderr = io.Discard
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start the exporter: %q", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		<-exited
+	})
+
+	deadline := time.Now().Add(startTimeout)
+
+	for {
+		select {
+		case <-exited:
+			t.Fatalf("the exporter exited before listening on %s", addr)
+		default:
+		}
+
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the exporter is not listening on %s after %s", addr, startTimeout)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return "http://" + addr + "/metrics"
+}
+
+// scrape returns the metrics exposed by the exporter.
+func scrape(t *testing.T, url string) string {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("failed to scrape metrics: %q", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %q", err)
+	}
+
+	return string(body)
+}
+
+// metricLine returns the line of the given metric, or an empty string.
+func metricLine(metrics string, name string) string {
+	for line := range strings.Lines(metrics) {
+		if strings.HasPrefix(line, name+" ") {
+			return strings.TrimSpace(line)
+		}
+	}
+
+	return ""
+}
+
+func TestRun(t *testing.T) {
+	fake := ccachetest.New(t, filepath.Join(testdataDir, "debian-12-ccache-4.7.5"))
+
+	url := startExporter(t, "--ccache-binary-path", fake.Path, "run")
+
+	metrics := scrape(t, url)
+
+	wantMetrics := []string{
+		`ccache_version{version="4.7.5"} 1`,
+		"ccache_call_total 146",
+		"ccache_collector_parsing_errors_total 0",
+	}
+
+	for _, want := range wantMetrics {
+		if !strings.Contains(metrics, "\n"+want) {
+			t.Errorf("want metric %q, got:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	url := startExporter(t, "run", "--replay", filepath.Join(testdataDir, "ubuntu-24.04-ccache-4.9.1"))
+
+	// snapshots are replayed in order, advancing on every scrape
+	wantCalls := []string{
+		"ccache_call_total 0",
+		"ccache_call_total 147",
+		"ccache_call_total 294",
+		"ccache_call_total 0",
+	}
+
+	for _, want := range wantCalls {
+		metrics := scrape(t, url)
+
+		if !strings.Contains(metrics, "\n"+`ccache_version{version="4.9.1"} 1`) {
+			t.Errorf("want the replayed ccache version, got:\n%s", metrics)
+		}
+
+		if got := metricLine(metrics, "ccache_call_total"); got != want {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
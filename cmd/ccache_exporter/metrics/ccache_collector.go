@@ -4,6 +4,12 @@
 package metrics
 
 import (
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 
@@ -23,14 +29,110 @@ var (
 			Help:      "Collector parsing errors (total)",
 		},
 	)
+	skippedFields = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "collector",
+			Name:      "skipped_fields_total",
+			Help:      "Malformed statistics and configuration fields skipped by the collector (total)",
+		},
+		[]string{"key"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(parsingErrors)
+	prometheus.MustRegister(skippedFields)
+}
+
+var (
+	// keys exported as labels of the generic counter metric
+	genericCounterKeyRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// exportedCounters lists the ccache statistics keys that are either exported
+// through a dedicated metric, or do not represent a counter.
+var exportedCounters = map[string]bool{
+	"cache_miss":                 true,
+	"cache_size_kibibyte":        true,
+	"called_for_link":            true,
+	"called_for_preprocessing":   true,
+	"cleanups_performed":         true,
+	"compile_failed":             true,
+	"direct_cache_hit":           true,
+	"files_in_cache":             true,
+	"local_storage_hit":          true,
+	"local_storage_miss":         true,
+	"local_storage_read_hit":     true,
+	"local_storage_read_miss":    true,
+	"local_storage_write":        true,
+	"max_cache_size_kibibyte":    true,
+	"max_files_in_cache":         true,
+	"no_input_file":              true,
+	"preprocessed_cache_hit":     true,
+	"preprocessor_error":         true,
+	"remote_storage_error":       true,
+	"remote_storage_hit":         true,
+	"remote_storage_miss":        true,
+	"remote_storage_read_hit":    true,
+	"remote_storage_read_miss":   true,
+	"remote_storage_timeout":     true,
+	"remote_storage_write":       true,
+	"stats_updated_timestamp":    true,
+	"stats_zeroed_timestamp":     true,
+	"unsupported_code_directive": true,
+}
+
+// isGenericCounter returns whether a ccache statistics key should be exported
+// through the generic counter metric.
+//
+// Sizes and timestamps are not monotonic counters, and are skipped, as are
+// keys that are not formatted as ccache counter keys, e.g. "local_storage_hit".
+func isGenericCounter(key string) bool {
+	if exportedCounters[key] || !genericCounterKeyRegex.MatchString(key) {
+		return false
+	}
+
+	return !strings.HasSuffix(key, "_kibibyte") && !strings.HasSuffix(key, "_timestamp")
+}
+
+// Source provides ccache configuration and statistics.
+//
+// It is implemented by ccache.Wrapper, which invokes the ccache executable,
+// and by ccache.CacheDirectory, which reads files from the cache directory.
+type Source interface {
+	Configuration(ctx context.Context) (*ccache.Configuration, error)
+	Statistics(ctx context.Context) (*ccache.Statistics, error)
+	Version() string
+}
+
+// lenientSource is implemented by sources that can skip malformed statistics
+// fields, such as ccache.Wrapper.
+type lenientSource interface {
+	StatisticsWithMode(ctx context.Context, mode ccache.ParseMode) (*ccache.Statistics, []*ccache.ParseError, error)
+}
+
+// lenientConfigurationSource is implemented by sources that can skip
+// malformed configuration settings, such as ccache.Wrapper and
+// ccache.CacheDirectory.
+type lenientConfigurationSource interface {
+	ConfigurationWithMode(ctx context.Context, mode ccache.ParseMode) (*ccache.Configuration, []*ccache.ParseError, error)
+}
+
+// capabilitiesSource is implemented by sources that know which metrics the
+// running version of ccache provides, such as ccache.Wrapper.
+type capabilitiesSource interface {
+	Capabilities(ctx context.Context) (*ccache.Capabilities, error)
+}
+
+// versionInfoSource is implemented by sources that know the features and
+// library versions of the ccache build, such as ccache.Wrapper.
+type versionInfoSource interface {
+	VersionInfo() *ccache.VersionInfo
 }
 
 type collector struct {
-	wrapper *ccache.Wrapper
+	source Source
 
 	// ccache metrics
 	call                     *prometheus.Desc
@@ -46,6 +148,11 @@ type collector struct {
 	filesInCache             *prometheus.Desc
 	cacheSizeBytes           *prometheus.Desc
 	maxCacheSizeBytes        *prometheus.Desc
+	localStorageHit          *prometheus.Desc
+	localStorageMiss         *prometheus.Desc
+	localStorageReadHit      *prometheus.Desc
+	localStorageReadMiss     *prometheus.Desc
+	localStorageWrite        *prometheus.Desc
 	remoteStorageError       *prometheus.Desc
 	remoteStorageHit         *prometheus.Desc
 	remoteStorageMiss        *prometheus.Desc
@@ -53,17 +160,21 @@ type collector struct {
 	remoteStorageReadMiss    *prometheus.Desc
 	remoteStorageTimeout     *prometheus.Desc
 	remoteStorageWrite       *prometheus.Desc
+	remoteStorageInfo        *prometheus.Desc
+	counter                  *prometheus.Desc
 	version                  *prometheus.Desc
+	featureInfo              *prometheus.Desc
+	buildInfo                *prometheus.Desc
 }
 
 // newCcacheCollector initializes and returns a Prometheus collector for ccache
 // metrics.
-func newCcacheCollector(ccacheWrapper *ccache.Wrapper) *collector {
+func newCcacheCollector(source Source) *collector {
 	return &collector{
-		wrapper: ccacheWrapper,
+		source: source,
 		call: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "call_total"),
-			"Cache calls (total)",
+			"Cacheable calls (hits + misses)",
 			nil,
 			nil,
 		),
@@ -75,7 +186,7 @@ func newCcacheCollector(ccacheWrapper *ccache.Wrapper) *collector {
 		),
 		cacheHitRatio: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "cache_hit_ratio"),
-			"Cache hit ratio (direct + preprocessed) / miss",
+			"Cache hit ratio (direct + preprocessed) / (hits + misses)",
 			nil,
 			nil,
 		),
@@ -139,6 +250,36 @@ func newCcacheCollector(ccacheWrapper *ccache.Wrapper) *collector {
 			nil,
 			nil,
 		),
+		localStorageHit: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "local_storage_hit_total"),
+			"Local storage hits",
+			nil,
+			nil,
+		),
+		localStorageMiss: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "local_storage_miss_total"),
+			"Local storage misses",
+			nil,
+			nil,
+		),
+		localStorageReadHit: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "local_storage_read_hit_total"),
+			"Local storage read hits",
+			nil,
+			nil,
+		),
+		localStorageReadMiss: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "local_storage_read_miss_total"),
+			"Local storage read miss",
+			nil,
+			nil,
+		),
+		localStorageWrite: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "local_storage_write_total"),
+			"Local storage writes",
+			nil,
+			nil,
+		),
 		remoteStorageError: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "remote_storage_errors_total"),
 			"Remote storage errors",
@@ -181,12 +322,36 @@ func newCcacheCollector(ccacheWrapper *ccache.Wrapper) *collector {
 			nil,
 			nil,
 		),
+		remoteStorageInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "remote_storage_info"),
+			"Remote storage backend",
+			[]string{"url", "scheme", "host", "read_only", "shards"},
+			nil,
+		),
+		counter: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "counter_total"),
+			"ccache counters that are not exported through a dedicated metric",
+			[]string{"counter"},
+			nil,
+		),
 		version: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "version"),
 			"ccache version",
 			[]string{"version"},
 			nil,
 		),
+		featureInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "feature_info"),
+			"Feature compiled in ccache",
+			[]string{"feature"},
+			nil,
+		),
+		buildInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "build_info"),
+			"ccache build, with its features and library versions",
+			[]string{"version", "features", "libraries"},
+			nil,
+		),
 	}
 }
 
@@ -206,6 +371,11 @@ func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.filesInCache
 	ch <- c.cacheSizeBytes
 	ch <- c.maxCacheSizeBytes
+	ch <- c.localStorageHit
+	ch <- c.localStorageMiss
+	ch <- c.localStorageReadHit
+	ch <- c.localStorageReadMiss
+	ch <- c.localStorageWrite
 	ch <- c.remoteStorageError
 	ch <- c.remoteStorageHit
 	ch <- c.remoteStorageMiss
@@ -213,54 +383,202 @@ func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.remoteStorageReadMiss
 	ch <- c.remoteStorageTimeout
 	ch <- c.remoteStorageWrite
+	ch <- c.remoteStorageInfo
+	ch <- c.counter
 	ch <- c.version
+	ch <- c.featureInfo
+	ch <- c.buildInfo
 }
 
 // Collect gathers metrics from ccache.
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
-	config, err := c.wrapper.Configuration()
+	c.collect(context.Background(), ch)
+}
+
+// collect gathers metrics from ccache, until the context is done.
+func (c *collector) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	config, err := c.configuration(ctx)
 	if err != nil {
 		log.Error().Err(err).Msg("ccache: failed to collect configuration")
 		parsingErrors.Inc()
 		return
 	}
 
-	stats, err := c.wrapper.Statistics()
+	stats, err := c.statistics(ctx)
 	if err != nil {
 		log.Error().Err(err).Msg("ccache: failed to collect statistics")
 		parsingErrors.Inc()
 		return
 	}
 
+	caps, err := c.capabilities(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("ccache: failed to collect capabilities")
+		parsingErrors.Inc()
+		return
+	}
+
+	// counter sends a counter metric, if ccache reports the corresponding key
+	counter := func(desc *prometheus.Desc, key string, value int64) {
+		if caps != nil && !caps.HasCounter(key) {
+			return
+		}
+
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value))
+	}
+
 	// counters
-	ch <- prometheus.MustNewConstMetric(
-		c.call,
-		prometheus.CounterValue,
-		float64(stats.CacheHitDirect+stats.CacheHitPreprocessed+stats.CacheMiss),
-	)
+	ch <- prometheus.MustNewConstMetric(c.call, prometheus.CounterValue, float64(stats.CacheableCalls()))
 	ch <- prometheus.MustNewConstMetric(c.callHit, prometheus.CounterValue, float64(stats.CacheHitDirect), "direct")
 	ch <- prometheus.MustNewConstMetric(c.callHit, prometheus.CounterValue, float64(stats.CacheHitPreprocessed), "preprocessed")
-	ch <- prometheus.MustNewConstMetric(c.calledForLink, prometheus.CounterValue, float64(stats.CalledForLink))
-	ch <- prometheus.MustNewConstMetric(c.calledForPreprocessing, prometheus.CounterValue, float64(stats.CalledForPreprocessing))
-	ch <- prometheus.MustNewConstMetric(c.compilationFailed, prometheus.CounterValue, float64(stats.CompilationFailed))
-	ch <- prometheus.MustNewConstMetric(c.preprocessingFailed, prometheus.CounterValue, float64(stats.PreprocessingFailed))
-	ch <- prometheus.MustNewConstMetric(c.unsupportedCodeDirective, prometheus.CounterValue, float64(stats.UnsupportedCodeDirective))
-	ch <- prometheus.MustNewConstMetric(c.noInputFile, prometheus.CounterValue, float64(stats.NoInputFile))
-	ch <- prometheus.MustNewConstMetric(c.cleanupsPerformed, prometheus.CounterValue, float64(stats.CleanupsPerformed))
-	ch <- prometheus.MustNewConstMetric(c.remoteStorageError, prometheus.CounterValue, float64(stats.RemoteStorageError))
-	ch <- prometheus.MustNewConstMetric(c.remoteStorageHit, prometheus.CounterValue, float64(stats.RemoteStorageHit))
-	ch <- prometheus.MustNewConstMetric(c.remoteStorageMiss, prometheus.CounterValue, float64(stats.RemoteStorageMiss))
-	ch <- prometheus.MustNewConstMetric(c.remoteStorageReadHit, prometheus.CounterValue, float64(stats.RemoteStorageReadHit))
-	ch <- prometheus.MustNewConstMetric(c.remoteStorageReadMiss, prometheus.CounterValue, float64(stats.RemoteStorageReadMiss))
-	ch <- prometheus.MustNewConstMetric(c.remoteStorageTimeout, prometheus.CounterValue, float64(stats.RemoteStorageTimeout))
-	ch <- prometheus.MustNewConstMetric(c.remoteStorageWrite, prometheus.CounterValue, float64(stats.RemoteStorageWrite))
+	counter(c.calledForLink, "called_for_link", stats.CalledForLink)
+	counter(c.calledForPreprocessing, "called_for_preprocessing", stats.CalledForPreprocessing)
+	counter(c.compilationFailed, "compile_failed", stats.CompilationFailed)
+	counter(c.preprocessingFailed, "preprocessor_error", stats.PreprocessingFailed)
+	counter(c.unsupportedCodeDirective, "unsupported_code_directive", stats.UnsupportedCodeDirective)
+	counter(c.noInputFile, "no_input_file", stats.NoInputFile)
+	counter(c.cleanupsPerformed, "cleanups_performed", stats.CleanupsPerformed)
+	counter(c.localStorageHit, "local_storage_hit", stats.LocalStorageHit)
+	counter(c.localStorageMiss, "local_storage_miss", stats.LocalStorageMiss)
+	counter(c.localStorageReadHit, "local_storage_read_hit", stats.LocalStorageReadHit)
+	counter(c.localStorageReadMiss, "local_storage_read_miss", stats.LocalStorageReadMiss)
+	counter(c.localStorageWrite, "local_storage_write", stats.LocalStorageWrite)
+	counter(c.remoteStorageError, "remote_storage_error", stats.RemoteStorageError)
+	counter(c.remoteStorageHit, "remote_storage_hit", stats.RemoteStorageHit)
+	counter(c.remoteStorageMiss, "remote_storage_miss", stats.RemoteStorageMiss)
+	counter(c.remoteStorageReadHit, "remote_storage_read_hit", stats.RemoteStorageReadHit)
+	counter(c.remoteStorageReadMiss, "remote_storage_read_miss", stats.RemoteStorageReadMiss)
+	counter(c.remoteStorageTimeout, "remote_storage_timeout", stats.RemoteStorageTimeout)
+	counter(c.remoteStorageWrite, "remote_storage_write", stats.RemoteStorageWrite)
+
+	for key, value := range stats.Counters {
+		if !isGenericCounter(key) {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.counter, prometheus.CounterValue, float64(value), key)
+	}
 
 	// gauges
-	ch <- prometheus.MustNewConstMetric(c.cacheHitRatio, prometheus.GaugeValue, stats.CacheHitRatio)
+	ch <- prometheus.MustNewConstMetric(c.cacheHitRatio, prometheus.GaugeValue, stats.HitRatio())
 	ch <- prometheus.MustNewConstMetric(c.filesInCache, prometheus.GaugeValue, float64(stats.FilesInCache))
 	ch <- prometheus.MustNewConstMetric(c.cacheSizeBytes, prometheus.GaugeValue, float64(stats.CacheSizeBytes))
 	ch <- prometheus.MustNewConstMetric(c.maxCacheSizeBytes, prometheus.GaugeValue, float64(config.MaxCacheSizeBytes))
 
-	// version
-	ch <- prometheus.MustNewConstMetric(c.version, prometheus.UntypedValue, 1, c.wrapper.Version())
+	// remote storage, with credentials redacted from URLs; backends that only
+	// differ by unexported attributes are sent once, as the registry rejects
+	// duplicate series
+	remoteStorageSeries := make(map[[5]string]bool)
+
+	for _, backend := range config.RemoteStorageBackends {
+		labelValues := [5]string{
+			backend.URL,
+			backend.Scheme,
+			backend.Host,
+			strconv.FormatBool(backend.ReadOnly),
+			backend.Shards,
+		}
+
+		if remoteStorageSeries[labelValues] {
+			continue
+		}
+		remoteStorageSeries[labelValues] = true
+
+		ch <- prometheus.MustNewConstMetric(c.remoteStorageInfo, prometheus.GaugeValue, 1, labelValues[:]...)
+	}
+
+	// version, unknown when reading statistics from the cache directory
+	if version := c.source.Version(); version != "" {
+		ch <- prometheus.MustNewConstMetric(c.version, prometheus.UntypedValue, 1, version)
+	}
+
+	// build features and libraries
+	if source, ok := c.source.(versionInfoSource); ok {
+		versionInfo := source.VersionInfo()
+
+		for _, feature := range versionInfo.Features {
+			ch <- prometheus.MustNewConstMetric(c.featureInfo, prometheus.GaugeValue, 1, feature)
+		}
+
+		libraries := make([]string, 0, len(versionInfo.Libraries))
+		for name, version := range versionInfo.Libraries {
+			libraries = append(libraries, name+"="+version)
+		}
+		slices.Sort(libraries)
+
+		ch <- prometheus.MustNewConstMetric(
+			c.buildInfo,
+			prometheus.GaugeValue,
+			1,
+			versionInfo.Version,
+			strings.Join(versionInfo.Features, ","),
+			strings.Join(libraries, ","),
+		)
+	}
+}
+
+// capabilities returns the capabilities of the running version of ccache, or
+// nil if the source cannot tell, in which case all metrics are sent.
+func (c *collector) capabilities(ctx context.Context) (*ccache.Capabilities, error) {
+	source, ok := c.source.(capabilitiesSource)
+	if !ok {
+		return nil, nil
+	}
+
+	return source.Capabilities(ctx)
+}
+
+// configuration returns the current ccache configuration, skipping malformed
+// settings if the source supports it.
+func (c *collector) configuration(ctx context.Context) (*ccache.Configuration, error) {
+	source, ok := c.source.(lenientConfigurationSource)
+	if !ok {
+		return c.source.Configuration(ctx)
+	}
+
+	config, warnings, err := source.ConfigurationWithMode(ctx, ccache.ParseModeLenient)
+	if err != nil {
+		return config, err
+	}
+
+	for _, warning := range warnings {
+		log.Debug().Err(warning).Msg("ccache: skipped malformed configuration setting")
+		skippedFields.WithLabelValues(warning.Key).Inc()
+	}
+
+	return config, nil
+}
+
+// statistics returns the current ccache statistics, skipping malformed fields
+// if the source supports it.
+func (c *collector) statistics(ctx context.Context) (*ccache.Statistics, error) {
+	source, ok := c.source.(lenientSource)
+	if !ok {
+		return c.source.Statistics(ctx)
+	}
+
+	stats, warnings, err := source.StatisticsWithMode(ctx, ccache.ParseModeLenient)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, warning := range warnings {
+		log.Debug().Err(warning).Msg("ccache: skipped malformed statistics field")
+		skippedFields.WithLabelValues(warning.Key).Inc()
+	}
+
+	return stats, nil
+}
+
+// scrapeCollector gathers metrics from ccache for a single scrape, which
+// bounds the time spent invoking ccache.
+type scrapeCollector struct {
+	*collector
+
+	ctx context.Context
+}
+
+// Collect gathers metrics from ccache, until the scrape context is done.
+func (c *scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(c.ctx, ch)
 }
@@ -0,0 +1,173 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/virtualtam/ccache_exporter/v4/pkg/ccache"
+)
+
+// fakeSource returns fixed configuration and statistics.
+type fakeSource struct {
+	config *ccache.Configuration
+	stats  *ccache.Statistics
+}
+
+func (s *fakeSource) Configuration(_ context.Context) (*ccache.Configuration, error) {
+	if s.config == nil {
+		return &ccache.Configuration{}, nil
+	}
+
+	return s.config, nil
+}
+
+func (s *fakeSource) Statistics(_ context.Context) (*ccache.Statistics, error) {
+	if s.stats == nil {
+		return &ccache.Statistics{}, nil
+	}
+
+	return s.stats, nil
+}
+
+func (s *fakeSource) Version() string {
+	return "4.10.2"
+}
+
+// configOutputSource parses the given ccache configuration output, and
+// returns fixed statistics.
+type configOutputSource struct {
+	fakeSource
+
+	configOutput string
+}
+
+func (s *configOutputSource) Configuration(_ context.Context) (*ccache.Configuration, error) {
+	return ccache.ParseConfiguration(s.configOutput)
+}
+
+func (s *configOutputSource) ConfigurationWithMode(_ context.Context, mode ccache.ParseMode) (*ccache.Configuration, []*ccache.ParseError, error) {
+	return ccache.ParseConfigurationWithMode(mode, s.configOutput)
+}
+
+// collectMetrics returns the ccache metrics collected from the source, in the
+// Prometheus text format.
+func collectMetrics(t *testing.T, source Source) string {
+	t.Helper()
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(newCcacheCollector(source))
+
+	recorder := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	return recorder.Body.String()
+}
+
+// assertMetrics checks that the collected metrics contain every wanted line,
+// and none of the unwanted substrings.
+func assertMetrics(t *testing.T, metrics string, wantMetrics []string, wantMissing []string) {
+	t.Helper()
+
+	for _, want := range wantMetrics {
+		if !strings.Contains(metrics, want+"\n") {
+			t.Errorf("want metric %q, got:\n%s", want, metrics)
+		}
+	}
+
+	for _, missing := range wantMissing {
+		if strings.Contains(metrics, missing) {
+			t.Errorf("want no metric matching %q, got:\n%s", missing, metrics)
+		}
+	}
+}
+
+func TestCollectorGenericCounters(t *testing.T) {
+	source := &fakeSource{
+		stats: &ccache.Statistics{
+			CacheMiss: 3,
+			Counters: map[string]int64{
+				"cache_miss":              3,
+				"some_future_counter":     12,
+				"stats_updated_timestamp": 1708109988,
+				"new_\xffkey":             3,
+				"New-Counter":             4,
+			},
+		},
+	}
+
+	metrics := collectMetrics(t, source)
+
+	assertMetrics(
+		t,
+		metrics,
+		[]string{
+			`ccache_counter_total{counter="some_future_counter"} 12`,
+		},
+		[]string{
+			`counter="cache_miss"`,
+			`counter="stats_updated_timestamp"`,
+			`counter="new_`,
+			`counter="New-Counter"`,
+		},
+	)
+}
+
+func TestCollectorSkipsMalformedConfiguration(t *testing.T) {
+	source := &configOutputSource{
+		fakeSource: fakeSource{
+			stats: &ccache.Statistics{
+				CacheMiss: 3,
+			},
+		},
+		configOutput: `(environment) direct_mode = maybe
+(/etc/ccache.conf) max_size = 10G
+`,
+	}
+
+	metrics := collectMetrics(t, source)
+
+	assertMetrics(
+		t,
+		metrics,
+		[]string{
+			`ccache_cache_size_max_bytes 1e+10`,
+			`ccache_call_total 3`,
+		},
+		nil,
+	)
+}
+
+func TestCollectorRemoteStorageInfo(t *testing.T) {
+	source := &configOutputSource{
+		configOutput: `(environment) remote_storage = file:///a file:///b redis://s3cr3t@redis.example.com redis://s3cr3t@redis.example.com|connect-timeout=50
+`,
+	}
+
+	metrics := collectMetrics(t, source)
+
+	assertMetrics(
+		t,
+		metrics,
+		[]string{
+			`ccache_remote_storage_info{host="",read_only="false",scheme="file",shards="",url="file:///a"} 1`,
+			`ccache_remote_storage_info{host="",read_only="false",scheme="file",shards="",url="file:///b"} 1`,
+			`ccache_remote_storage_info{host="redis.example.com",read_only="false",scheme="redis",shards="",url="redis://xxxxx@redis.example.com"} 1`,
+		},
+		[]string{
+			"s3cr3t",
+		},
+	)
+}
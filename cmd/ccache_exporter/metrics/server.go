@@ -4,7 +4,9 @@
 package metrics
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/justinas/alice"
@@ -14,7 +16,6 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/virtualtam/ccache_exporter/v4/internal/version"
-	"github.com/virtualtam/ccache_exporter/v4/pkg/ccache"
 )
 
 const (
@@ -25,6 +26,26 @@ const (
     <p><a href="/metrics">Metrics</a></p>
   </body>
 </html>`
+
+	// DefaultScrapeTimeout is the time allowed to collect ccache metrics,
+	// unless Prometheus sends its own scrape timeout.
+	DefaultScrapeTimeout = 10 * time.Second
+
+	// scrapeTimeoutHeader is set by Prometheus to the scrape timeout, in
+	// seconds.
+	scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+	// scrapeTimeoutOffset is subtracted from the scrape timeout sent by
+	// Prometheus, leaving time to send metrics before Prometheus gives up.
+	scrapeTimeoutOffset = 500 * time.Millisecond
+
+	// serverWriteTimeout is the time allowed to handle a request and write
+	// its response.
+	serverWriteTimeout = 15 * time.Second
+
+	// maxScrapeTimeout is the maximum time allowed to collect ccache metrics,
+	// so that they are sent before the server times out.
+	maxScrapeTimeout = serverWriteTimeout - scrapeTimeoutOffset
 )
 
 func accessLogger(r *http.Request, status, size int, dur time.Duration) {
@@ -37,19 +58,62 @@ func accessLogger(r *http.Request, status, size int, dur time.Duration) {
 		Msg("handle request")
 }
 
+// scrapeTimeout returns the scrape timeout sent by Prometheus minus
+// scrapeTimeoutOffset, or the default timeout if the request has none.
+//
+// The timeout is capped to maxScrapeTimeout.
+func scrapeTimeout(r *http.Request, defaultTimeout time.Duration) time.Duration {
+	timeout := defaultTimeout
+
+	seconds, err := strconv.ParseFloat(r.Header.Get(scrapeTimeoutHeader), 64)
+	if err == nil && seconds > 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+
+		// keep very short timeouts as is, rather than cancelling right away
+		if timeout > scrapeTimeoutOffset {
+			timeout -= scrapeTimeoutOffset
+		}
+	}
+
+	return min(timeout, maxScrapeTimeout)
+}
+
+// newMetricsHandler returns a HTTP handler exposing metrics from the default
+// registry, and ccache metrics collected within the scrape timeout.
+//
+// As Prometheus collectors have no notion of context, ccache metrics are
+// gathered through a registry created for each scrape.
+func newMetricsHandler(ccacheCollector *collector, defaultTimeout time.Duration) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), scrapeTimeout(r, defaultTimeout))
+		defer cancel()
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(&scrapeCollector{collector: ccacheCollector, ctx: ctx})
+
+		// gather ccache metrics first, so that collector errors are reported
+		// in the same scrape
+		gatherers := prometheus.Gatherers{registry, prometheus.DefaultGatherer}
+
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler)
+}
+
 // NewServer registers metrics collectors and returns a HTTP server to expose them.
-func NewServer(ccacheWrapper *ccache.Wrapper, listenAddr string, versionDetails *version.Details) *http.Server {
-	ccacheCollector := newCcacheCollector(ccacheWrapper)
+//
+// ccache metrics are collected within the scrape timeout sent by Prometheus,
+// or within scrapeTimeout otherwise.
+func NewServer(source Source, listenAddr string, versionDetails *version.Details, scrapeTimeout time.Duration) *http.Server {
+	ccacheCollector := newCcacheCollector(source)
 	versionCollector := newVersionCollector("ccache_exporter", versionDetails)
 
-	prometheus.MustRegister(
-		ccacheCollector,
-		versionCollector,
-	)
+	prometheus.MustRegister(versionCollector)
 
 	router := http.NewServeMux()
 
-	router.Handle("/metrics", promhttp.Handler())
+	router.Handle("/metrics", newMetricsHandler(ccacheCollector, scrapeTimeout))
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(webroot))
 		if err != nil {
@@ -64,7 +128,7 @@ func NewServer(ccacheWrapper *ccache.Wrapper, listenAddr string, versionDetails
 		Addr:         listenAddr,
 		Handler:      chain.Then(router),
 		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: serverWriteTimeout,
 	}
 
 	return server
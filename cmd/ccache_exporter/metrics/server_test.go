@@ -0,0 +1,221 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/virtualtam/ccache_exporter/v4/internal/version"
+	"github.com/virtualtam/ccache_exporter/v4/pkg/ccache"
+	"github.com/virtualtam/ccache_exporter/v4/pkg/ccache/ccachetest"
+)
+
+// scrape returns the metrics exposed by the server, collected within the
+// given scrape timeout.
+func scrape(t *testing.T, url string, timeout string) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url+"/metrics", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %q", err)
+	}
+
+	req.Header.Set(scrapeTimeoutHeader, timeout)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to scrape metrics: %q", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %q", err)
+	}
+
+	return string(body)
+}
+
+func TestScrapeTimeout(t *testing.T) {
+	cases := []struct {
+		tname          string
+		header         string
+		defaultTimeout time.Duration
+		want           time.Duration
+	}{
+		{
+			tname:          "no header",
+			defaultTimeout: DefaultScrapeTimeout,
+			want:           DefaultScrapeTimeout,
+		},
+		{
+			tname:          "invalid header",
+			header:         "ten",
+			defaultTimeout: DefaultScrapeTimeout,
+			want:           DefaultScrapeTimeout,
+		},
+		{
+			tname:          "negative header",
+			header:         "-1",
+			defaultTimeout: DefaultScrapeTimeout,
+			want:           DefaultScrapeTimeout,
+		},
+		{
+			tname:          "Prometheus timeout minus offset",
+			header:         "10",
+			defaultTimeout: DefaultScrapeTimeout,
+			want:           9500 * time.Millisecond,
+		},
+		{
+			tname:          "Prometheus timeout shorter than offset",
+			header:         "0.2",
+			defaultTimeout: DefaultScrapeTimeout,
+			want:           200 * time.Millisecond,
+		},
+		{
+			tname:          "Prometheus timeout capped to write timeout",
+			header:         "60",
+			defaultTimeout: DefaultScrapeTimeout,
+			want:           14500 * time.Millisecond,
+		},
+		{
+			tname:          "default timeout capped to write timeout",
+			defaultTimeout: 30 * time.Second,
+			want:           14500 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.header != "" {
+				r.Header.Set(scrapeTimeoutHeader, tc.header)
+			}
+
+			if got := scrapeTimeout(r, tc.defaultTimeout); got != tc.want {
+				t.Errorf("want timeout %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestServerWithFakeCcache(t *testing.T) {
+	fake := ccachetest.New(t, filepath.Join("..", "..", "..", "pkg", "ccache", "testdata", "debian-12-ccache-4.7.5"))
+
+	cmd, err := ccache.NewLocalCommand(context.Background(), fake.Path)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	wrapper, err := ccache.NewWrapper(context.Background(), cmd)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	server := NewServer(wrapper, "", version.NewDetails(wrapper.Version()), DefaultScrapeTimeout)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	cases := []struct {
+		tname       string
+		setup       func()
+		wantMetrics []string
+		wantMissing []string
+	}{
+		{
+			tname: "first build",
+			setup: func() {},
+			wantMetrics: []string{
+				`ccache_version{version="4.7.5"} 1`,
+				"ccache_call_total 146",
+				"ccache_local_storage_hit_total ",
+				"ccache_collector_parsing_errors_total 0",
+			},
+		},
+		{
+			tname: "second build",
+			setup: func() {
+				fake.SetSnapshot("secondbuild")
+			},
+			wantMetrics: []string{
+				"ccache_call_total 292",
+			},
+		},
+		{
+			tname: "timeout",
+			setup: func() {
+				fake.SetLatency(5 * time.Second)
+			},
+			wantMetrics: []string{
+				"ccache_collector_parsing_errors_total 1",
+			},
+			wantMissing: []string{
+				"ccache_call_total",
+			},
+		},
+		{
+			tname: "exit code",
+			setup: func() {
+				fake.SetLatency(0)
+				fake.SetExitCode(1, "ccache: error: Permission denied")
+			},
+			wantMetrics: []string{
+				"ccache_collector_parsing_errors_total 2",
+			},
+			wantMissing: []string{
+				"ccache_call_total",
+			},
+		},
+		{
+			tname: "garbage",
+			setup: func() {
+				fake.SetExitCode(0, "")
+				fake.SetGarbage(ccachetest.Garbage)
+			},
+			wantMetrics: []string{
+				"ccache_collector_parsing_errors_total 3",
+			},
+			wantMissing: []string{
+				"ccache_call_total",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			tc.setup()
+
+			start := time.Now()
+			metrics := scrape(t, ts.URL, "1")
+
+			if elapsed := time.Since(start); elapsed >= 5*time.Second {
+				t.Errorf("want the scrape to complete within its timeout, took %s", elapsed)
+			}
+
+			for _, want := range tc.wantMetrics {
+				if !strings.Contains(metrics, "\n"+want) {
+					t.Errorf("want metric %q, got:\n%s", want, metrics)
+				}
+			}
+
+			for _, unwanted := range tc.wantMissing {
+				if strings.Contains(metrics, "\n"+unwanted) {
+					t.Errorf("want no metric %q", unwanted)
+				}
+			}
+		})
+	}
+}
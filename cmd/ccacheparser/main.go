@@ -4,9 +4,10 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/rs/zerolog"
@@ -20,6 +21,9 @@ func main() {
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
 
+	format := flag.String("format", "", fmt.Sprintf("statistics format %v (default: detected from the input)", ccache.StatisticsFormats()))
+	flag.Parse()
+
 	stat, err := os.Stdin.Stat()
 	if err != nil {
 		panic(err)
@@ -28,17 +32,23 @@ func main() {
 	if stat.Mode()&os.ModeNamedPipe == 0 {
 		// TODO add flags, read from stdin / file(s)
 		// TODO add help
-		// TODO switch between legacy / TSV parsers
 		panic("No data piped to stdin")
 	}
 
-	var text string
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		text += scanner.Text() + "\n"
+	// parsers reject inputs larger than ccache.MaxOutputSize
+	input, err := io.ReadAll(io.LimitReader(os.Stdin, ccache.MaxOutputSize+1))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Read")
 	}
 
-	stats, err := ccache.ParseTSVStatistics(text)
+	text := string(input)
+
+	var stats *ccache.Statistics
+	if *format == "" {
+		stats, err = ccache.ParseStatistics(text)
+	} else {
+		stats, err = ccache.ParseStatisticsFormat(ccache.StatisticsFormat(*format), text)
+	}
 	if err != nil {
 		log.Fatal().Err(err).Msg("Parse")
 	}
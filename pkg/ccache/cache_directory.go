@@ -0,0 +1,332 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// default maximum cache size of ccache 3.x and 4.x
+	defaultMaxCacheSizeV3 = "5G"
+	defaultMaxCacheSizeV4 = "5Gi"
+
+	configFileName = "ccache.conf"
+	statsFileName  = "stats"
+
+	// index of the first per-subdirectory entry, stored by ccache >= 4.0 in
+	// level 1 stats files; these entries are not counters
+	statsFileSubdirectoryIndex = 65
+)
+
+var (
+	ErrCacheDirectoryInvalid error = errors.New("cache directory: not a directory")
+	ErrStatsFileInvalid      error = errors.New("stats file: invalid value")
+)
+
+var (
+	cacheSubdirectories = strings.Split("0123456789abcdef", "")
+)
+
+// statsFileCounters lists the counter keys stored in ccache stats files, in
+// the order in which they are stored.
+//
+// ccache 3.x stores the first 32 (or 33 for ccache >= 3.7) counters; ccache 4.x
+// appends new counters at the end of the list. Empty keys are not counters,
+// or are obsolete.
+//
+// See https://github.com/ccache/ccache/blob/master/src/ccache/core/statistic.hpp
+var statsFileCounters = []string{
+	"",                                 // none
+	"compiler_produced_stdout",         // 1
+	"compile_failed",                   // 2
+	"internal_error",                   // 3
+	"cache_miss",                       // 4
+	"preprocessor_error",               // 5
+	"could_not_find_compiler",          // 6
+	"missing_cache_file",               // 7
+	"preprocessed_cache_hit",           // 8
+	"bad_compiler_arguments",           // 9
+	"called_for_link",                  // 10
+	"files_in_cache",                   // 11
+	"cache_size_kibibyte",              // 12
+	"",                                 // 13: obsolete_max_files
+	"",                                 // 14: obsolete_max_size
+	"unsupported_source_language",      // 15
+	"bad_output_file",                  // 16
+	"no_input_file",                    // 17
+	"multiple_source_files",            // 18
+	"autoconf_test",                    // 19
+	"unsupported_compiler_option",      // 20
+	"output_to_stdout",                 // 21
+	"direct_cache_hit",                 // 22
+	"compiler_produced_no_output",      // 23
+	"compiler_produced_empty_output",   // 24
+	"error_hashing_extra_file",         // 25
+	"compiler_check_failed",            // 26
+	"could_not_use_precompiled_header", // 27
+	"called_for_preprocessing",         // 28
+	"cleanups_performed",               // 29
+	"unsupported_code_directive",       // 30
+	"stats_zeroed_timestamp",           // 31
+	"could_not_use_modules",            // 32
+	"direct_cache_miss",                // 33
+	"preprocessed_cache_miss",          // 34
+	"local_storage_hit",                // 35
+	"local_storage_miss",               // 36
+	"remote_storage_hit",               // 37
+	"remote_storage_miss",              // 38
+	"remote_storage_error",             // 39
+	"remote_storage_timeout",           // 40
+	"recache",                          // 41
+	"unsupported_environment_variable", // 42
+	"modified_input_file",              // 43
+	"bad_input_file",                   // 44
+	"local_storage_read_hit",           // 45
+	"local_storage_read_miss",          // 46
+	"local_storage_write",              // 47
+	"remote_storage_read_hit",          // 48
+	"remote_storage_read_miss",         // 49
+	"remote_storage_write",             // 50
+}
+
+// CacheDirectory reads ccache configuration and statistics from the files
+// stored in a cache directory, without invoking the ccache executable.
+//
+// Both the ccache 3.x layout, where statistics are stored in the 16 level 1
+// subdirectories, and the ccache 4.x layout, where statistics are also stored
+// in level 2 subdirectories, are supported.
+type CacheDirectory struct {
+	path string
+}
+
+// NewCacheDirectory ensures the cache directory exists, and returns an
+// initialized CacheDirectory.
+func NewCacheDirectory(path string) (*CacheDirectory, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return &CacheDirectory{}, err
+	}
+
+	if !info.IsDir() {
+		return &CacheDirectory{}, fmt.Errorf("%w: %q", ErrCacheDirectoryInvalid, path)
+	}
+
+	return &CacheDirectory{path: path}, nil
+}
+
+// Configuration returns the ccache configuration stored in the cache
+// directory.
+//
+// Only the configuration file stored in the cache directory is read; settings
+// from the system-wide configuration file or environment variables are not
+// taken into account. When the maximum cache size is not set, it defaults to
+// 5 GB for caches written by ccache 3.x, and 5 GiB otherwise.
+func (d *CacheDirectory) Configuration(ctx context.Context) (*Configuration, error) {
+	configuration, _, err := d.ConfigurationWithMode(ctx, ParseModeDefault)
+
+	return configuration, err
+}
+
+// ConfigurationWithMode returns the ccache configuration stored in the cache
+// directory, parsed with the given mode.
+//
+// In lenient mode, settings with a malformed value are returned as warnings.
+func (d *CacheDirectory) ConfigurationWithMode(ctx context.Context, mode ParseMode) (*Configuration, []*ParseError, error) {
+	if err := ctx.Err(); err != nil {
+		return &Configuration{}, nil, err
+	}
+
+	configuration := &Configuration{
+		CacheDirectory: d.path,
+		PrimaryConfig:  filepath.Join(d.path, configFileName),
+	}
+
+	if err := configuration.setMaxCacheSize(d.defaultMaxCacheSize()); err != nil {
+		return &Configuration{}, nil, err
+	}
+
+	file, err := os.Open(configuration.PrimaryConfig)
+	if errors.Is(err, os.ErrNotExist) {
+		return configuration, nil, nil
+	}
+	if err != nil {
+		return &Configuration{}, nil, err
+	}
+	defer file.Close()
+
+	p := newParseState(configurationFormat, mode)
+	scanner := newLineScanner(file)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		// <key> = <value>
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found || strings.HasPrefix(strings.TrimSpace(key), "#") {
+			continue
+		}
+
+		if err := configuration.set(p, lineNumber, strings.TrimSpace(key), strings.TrimSpace(value), configuration.PrimaryConfig); err != nil {
+			return &Configuration{}, nil, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return &Configuration{}, nil, err
+	}
+
+	return configuration, p.warnings, nil
+}
+
+// defaultMaxCacheSize returns the default maximum cache size of the version of
+// ccache that wrote the cache directory: 5 GB for ccache 3.x, which only
+// stores statistics in level 1 subdirectories, and 5 GiB for ccache 4.x.
+//
+// Directories holding no stats file, e.g. new caches, are assumed to be
+// written by ccache 4.x.
+func (d *CacheDirectory) defaultMaxCacheSize() string {
+	legacy := false
+
+	for _, level1 := range cacheSubdirectories {
+		for _, level2 := range cacheSubdirectories {
+			if _, err := os.Stat(filepath.Join(d.path, level1, level2, statsFileName)); err == nil {
+				return defaultMaxCacheSizeV4
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(d.path, level1, statsFileName)); err == nil {
+			legacy = true
+		}
+	}
+
+	if legacy {
+		return defaultMaxCacheSizeV3
+	}
+
+	return defaultMaxCacheSizeV4
+}
+
+// Statistics returns the sum of the statistics stored in the cache directory.
+//
+// Reading stops as soon as the context is done.
+func (d *CacheDirectory) Statistics(ctx context.Context) (*Statistics, error) {
+	statsFilepaths := []string{filepath.Join(d.path, statsFileName)}
+
+	for _, level1 := range cacheSubdirectories {
+		statsFilepaths = append(statsFilepaths, filepath.Join(d.path, level1, statsFileName))
+
+		for _, level2 := range cacheSubdirectories {
+			statsFilepaths = append(statsFilepaths, filepath.Join(d.path, level1, level2, statsFileName))
+		}
+	}
+
+	var counters []int64
+	var statsTime time.Time
+
+	for _, statsFilepath := range statsFilepaths {
+		if err := ctx.Err(); err != nil {
+			return &Statistics{}, err
+		}
+
+		content, err := os.ReadFile(statsFilepath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return &Statistics{}, err
+		}
+
+		info, err := os.Stat(statsFilepath)
+		if err != nil {
+			return &Statistics{}, err
+		}
+
+		if info.ModTime().After(statsTime) {
+			statsTime = info.ModTime()
+		}
+
+		fileCounters, err := ParseStatsFile(string(content))
+		if err != nil {
+			return &Statistics{}, fmt.Errorf("%s: %w", statsFilepath, err)
+		}
+
+		for index, value := range fileCounters {
+			if index >= len(statsFileCounters) {
+				break
+			}
+
+			if index >= len(counters) {
+				counters = append(counters, 0)
+			}
+
+			if statsFileCounters[index] == "stats_zeroed_timestamp" {
+				// the most recent reset
+				counters[index] = max(counters[index], value)
+				continue
+			}
+
+			counters[index] += value
+		}
+	}
+
+	stats := &Statistics{
+		CacheDirectory: d.path,
+	}
+
+	for index, value := range counters {
+		if key := statsFileCounters[index]; key != "" {
+			stats.setValue(key, value)
+		}
+	}
+
+	if !statsTime.IsZero() {
+		stats.setValue("stats_updated_timestamp", statsTime.Unix())
+	}
+
+	stats.updateDerivedFields()
+
+	return stats, nil
+}
+
+// Version returns an empty string, as the version of ccache cannot be
+// determined from the content of the cache directory.
+func (d *CacheDirectory) Version() string {
+	return ""
+}
+
+// ParseStatsFile reads the counters stored in a ccache stats file, where each
+// line holds the value of a counter.
+//
+// Per-subdirectory entries stored by ccache >= 4.0 are not returned.
+func ParseStatsFile(text string) ([]int64, error) {
+	if err := checkOutputSize(text); err != nil {
+		return []int64{}, err
+	}
+
+	counters := make([]int64, 0, statsFileSubdirectoryIndex)
+
+	for field := range strings.FieldsSeq(text) {
+		if len(counters) >= statsFileSubdirectoryIndex {
+			break
+		}
+
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return []int64{}, fmt.Errorf("%w: %q", ErrStatsFileInvalid, field)
+		}
+
+		counters = append(counters, value)
+	}
+
+	return counters, nil
+}
@@ -0,0 +1,265 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+func TestCacheDirectoryStatistics(t *testing.T) {
+	cases := []struct {
+		tname     string
+		directory string
+		wantStats Statistics
+	}{
+		{
+			tname:     "ccache 3.7",
+			directory: "cache-directory-ccache-3.7",
+			wantStats: Statistics{
+				StatsZeroTime:        time.Date(2023, time.November, 14, 22, 30, 0, 0, time.UTC),
+				CacheHitDirect:       8,
+				CacheHitPreprocessed: 3,
+				CacheMiss:            20,
+				CacheHitRate:         35.48,
+				CacheHitRatio:        0.3548,
+				CalledForLink:        3,
+				NoInputFile:          1,
+				CleanupsPerformed:    1,
+				FilesInCache:         40,
+				CacheSize:            "786KB",
+				CacheSizeBytes:       786432,
+			},
+		},
+		{
+			tname:     "ccache 4.9.1",
+			directory: "cache-directory-ccache-4.9.1",
+			wantStats: Statistics{
+				StatsZeroTime:         time.Date(2024, time.March, 9, 16, 0, 0, 0, time.UTC),
+				CacheHitDirect:        6,
+				CacheHitPreprocessed:  1,
+				CacheMiss:             10,
+				CacheMissDirect:       10,
+				CacheMissPreprocessed: 9,
+				CacheHitRate:          41.18,
+				CacheHitRatio:         0.4118,
+				CalledForLink:         2,
+				CleanupsPerformed:     2,
+				FilesInCache:          16,
+				CacheSize:             "512KB",
+				CacheSizeBytes:        512000,
+				LocalStorageHit:       7,
+				LocalStorageMiss:      10,
+				LocalStorageReadHit:   13,
+				LocalStorageReadMiss:  20,
+				LocalStorageWrite:     30,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			directoryPath := filepath.Join("testdata", tc.directory)
+			tc.wantStats.CacheDirectory = directoryPath
+
+			directory, err := NewCacheDirectory(directoryPath)
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			got, err := directory.Statistics(context.Background())
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertStatisticsEqual(t, got, &tc.wantStats)
+			assertTimeFieldEquals(t, "StatsZeroTime", got.StatsZeroTime, tc.wantStats.StatsZeroTime)
+
+			if got.StatsTime.IsZero() {
+				t.Error("StatsTime: want the modification time of the most recent stats file, got zero")
+			}
+		})
+	}
+}
+
+func TestCacheDirectoryConfiguration(t *testing.T) {
+	cases := []struct {
+		tname     string
+		directory string
+		want      Configuration
+	}{
+		{
+			tname:     "configuration file",
+			directory: filepath.Join("testdata", "cache-directory-ccache-3.7"),
+			want: Configuration{
+				MaxCacheSize:      "2.0GB",
+				MaxCacheSizeBytes: 2 * units.GB,
+			},
+		},
+		{
+			tname:     "default configuration, ccache 4.x",
+			directory: filepath.Join("testdata", "cache-directory-ccache-4.9.1"),
+			want: Configuration{
+				MaxCacheSize:      "5GiB",
+				MaxCacheSizeBytes: units.MetricBytes(5 * units.GiB),
+			},
+		},
+		{
+			tname:     "default configuration, ccache 3.x",
+			directory: legacyCacheDirectory(t),
+			want: Configuration{
+				MaxCacheSize:      "5GB",
+				MaxCacheSizeBytes: 5 * units.GB,
+			},
+		},
+		{
+			tname:     "default configuration, new cache",
+			directory: t.TempDir(),
+			want: Configuration{
+				MaxCacheSize:      "5GiB",
+				MaxCacheSizeBytes: units.MetricBytes(5 * units.GiB),
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			directoryPath := tc.directory
+
+			directory, err := NewCacheDirectory(directoryPath)
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			got, err := directory.Configuration(context.Background())
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			if got.CacheDirectory != directoryPath {
+				t.Errorf("want cache directory %q, got %q", directoryPath, got.CacheDirectory)
+			}
+
+			wantPrimaryConfig := filepath.Join(directoryPath, "ccache.conf")
+			if got.PrimaryConfig != wantPrimaryConfig {
+				t.Errorf("want primary config %q, got %q", wantPrimaryConfig, got.PrimaryConfig)
+			}
+
+			if got.MaxCacheSize != tc.want.MaxCacheSize {
+				t.Errorf("want max cache size %q, got %q", tc.want.MaxCacheSize, got.MaxCacheSize)
+			}
+
+			if got.MaxCacheSizeBytes != tc.want.MaxCacheSizeBytes {
+				t.Errorf("want max cache size %d bytes, got %d", tc.want.MaxCacheSizeBytes, got.MaxCacheSizeBytes)
+			}
+
+			for _, entry := range got.Entries {
+				if entry.Origin != wantPrimaryConfig {
+					t.Errorf("%s: want origin %q, got %q", entry.Key, wantPrimaryConfig, entry.Origin)
+				}
+			}
+		})
+	}
+}
+
+// legacyCacheDirectory returns a cache directory written by ccache 3.x, with
+// no configuration file.
+func legacyCacheDirectory(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	stats, err := os.ReadFile(filepath.Join("testdata", "cache-directory-ccache-3.7", "0", "stats"))
+	if err != nil {
+		t.Fatalf("failed to read test data: %q", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "0"), 0o755); err != nil {
+		t.Fatalf("failed to create cache subdirectory: %q", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "0", "stats"), stats, 0o644); err != nil {
+		t.Fatalf("failed to write stats file: %q", err)
+	}
+
+	return dir
+}
+
+func TestNewCacheDirectory(t *testing.T) {
+	_, err := NewCacheDirectory(filepath.Join("testdata", "cache-directory-ccache-3.7", "ccache.conf"))
+	if !errors.Is(err, ErrCacheDirectoryInvalid) {
+		t.Errorf("want error %q, got %q", ErrCacheDirectoryInvalid, err)
+	}
+}
+
+func TestParseStatsFile(t *testing.T) {
+	cases := []struct {
+		tname   string
+		input   string
+		want    []int64
+		wantErr error
+	}{
+		{
+			tname: "empty",
+			input: "",
+			want:  []int64{},
+		},
+		{
+			tname: "counters",
+			input: "0\n3\n12\n",
+			want:  []int64{0, 3, 12},
+		},
+		{
+			tname: "64-bit counters",
+			input: "0\n8589934592\n",
+			want:  []int64{0, 8589934592},
+		},
+		{
+			tname: "per-subdirectory entries are skipped",
+			input: "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n18\n19\n20\n21\n22\n23\n24\n25\n26\n27\n28\n29\n30\n31\n32\n33\n34\n35\n36\n37\n38\n39\n40\n41\n42\n43\n44\n45\n46\n47\n48\n49\n50\n51\n52\n53\n54\n55\n56\n57\n58\n59\n60\n61\n62\n63\n64\n65\n66\n",
+			want:  []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63, 64},
+		},
+
+		// error cases
+		{
+			tname:   "invalid value",
+			input:   "0\nmany\n",
+			wantErr: ErrStatsFileInvalid,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			got, err := ParseStatsFile(tc.input)
+
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("want error %q, got %q", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("want %d counters, got %d", len(tc.want), len(got))
+			}
+
+			for index, value := range tc.want {
+				if got[index] != value {
+					t.Errorf("counter %d: want %d, got %d", index, value, got[index])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"slices"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// CapabilityKind is the kind of a ccache capability.
+type CapabilityKind string
+
+const (
+	CapabilityKindCommand   CapabilityKind = "command"
+	CapabilityKindCounter   CapabilityKind = "counter"
+	CapabilityKindConfigKey CapabilityKind = "config"
+)
+
+// Command-line options of ccache commands.
+const (
+	CommandShowStats      = "--show-stats"
+	CommandPrintStats     = "--print-stats"
+	CommandPrintStatsJSON = "--print-stats --format=json"
+	CommandPrintConfig    = "--print-config"
+	CommandShowConfig     = "--show-config"
+	CommandZeroStats      = "--zero-stats"
+	CommandCleanup        = "--cleanup"
+	CommandClear          = "--clear"
+	CommandMaxSize        = "--max-size"
+	CommandSetConfig      = "--set-config"
+	CommandRecompress     = "--recompress"
+	CommandEvictOlderThan = "--evict-older-than"
+	CommandDir            = "--dir"
+	CommandConfigPath     = "--config-path"
+)
+
+// Capability is a command, statistics counter or configuration key, and the
+// range of ccache versions providing it.
+type Capability struct {
+	Kind CapabilityKind `json:"kind"`
+
+	// Command-line option, canonical counter key, or configuration key.
+	Name string `json:"name"`
+
+	// First version providing the capability; nil if provided by all versions
+	// supported by the exporter.
+	From *semver.Version `json:"from,omitempty"`
+
+	// First version no longer providing the capability; nil if it is still
+	// provided.
+	Until *semver.Version `json:"until,omitempty"`
+}
+
+// SupportedBy returns whether the given version of ccache provides the
+// capability.
+func (c Capability) SupportedBy(version *semver.Version) bool {
+	if c.From != nil && version.LessThan(c.From) {
+		return false
+	}
+
+	if c.Until != nil && !version.LessThan(c.Until) {
+		return false
+	}
+
+	return true
+}
+
+// VersionRange returns the range of ccache versions providing the capability,
+// e.g. ">= 4.4, < 4.8".
+func (c Capability) VersionRange() string {
+	switch {
+	case c.From == nil && c.Until == nil:
+		return "all"
+	case c.Until == nil:
+		return ">= " + c.From.Original()
+	case c.From == nil:
+		return "< " + c.Until.Original()
+	default:
+		return ">= " + c.From.Original() + ", < " + c.Until.Original()
+	}
+}
+
+func capability(kind CapabilityKind, name string, from string, until string) Capability {
+	c := Capability{
+		Kind: kind,
+		Name: name,
+	}
+
+	if from != "" {
+		c.From = semver.MustParse(from)
+	}
+
+	if until != "" {
+		c.Until = semver.MustParse(until)
+	}
+
+	return c
+}
+
+// capabilityMatrix lists the commands, statistics counters and configuration
+// keys of ccache, and the versions providing them; versions older than 3.3 are
+// not supported by the exporter.
+//
+// Counters are listed under their current name: ccache 4.4 to 4.6 report
+// local and remote storage hits and misses as primary and secondary storage
+// counters. A capability may be listed several times, e.g. the maximum number
+// of files is printed by `ccache --show-stats` before 3.7, and by
+// `ccache --print-stats` since 4.8.
+var capabilityMatrix = []Capability{
+	// commands
+	capability(CapabilityKindCommand, CommandShowStats, "", ""),
+	capability(CapabilityKindCommand, CommandPrintStats, "3.7", ""),
+	capability(CapabilityKindCommand, CommandPrintStatsJSON, "4.10", ""),
+	capability(CapabilityKindCommand, CommandPrintConfig, "", ""),
+	capability(CapabilityKindCommand, CommandShowConfig, "3.7", ""),
+	capability(CapabilityKindCommand, CommandZeroStats, "", ""),
+	capability(CapabilityKindCommand, CommandCleanup, "", ""),
+	capability(CapabilityKindCommand, CommandClear, "", ""),
+	capability(CapabilityKindCommand, CommandMaxSize, "", ""),
+	capability(CapabilityKindCommand, CommandSetConfig, "", ""),
+	capability(CapabilityKindCommand, CommandRecompress, "4.0", ""),
+	capability(CapabilityKindCommand, CommandEvictOlderThan, "4.4", ""),
+	capability(CapabilityKindCommand, CommandDir, "4.4", ""),
+	capability(CapabilityKindCommand, CommandConfigPath, "4.4", ""),
+
+	// counters: cache status
+	capability(CapabilityKindCounter, "cleanups_performed", "", ""),
+	capability(CapabilityKindCounter, "files_in_cache", "", ""),
+	capability(CapabilityKindCounter, "cache_size_kibibyte", "", ""),
+	capability(CapabilityKindCounter, "max_files_in_cache", "", "3.7"),
+	capability(CapabilityKindCounter, "max_files_in_cache", "4.8", ""),
+	capability(CapabilityKindCounter, "max_cache_size_kibibyte", "", "3.7"),
+	capability(CapabilityKindCounter, "max_cache_size_kibibyte", "4.8", ""),
+
+	// counters: cache usage
+	capability(CapabilityKindCounter, "cache_miss", "", ""),
+	capability(CapabilityKindCounter, "called_for_link", "", ""),
+	capability(CapabilityKindCounter, "called_for_preprocessing", "", ""),
+	capability(CapabilityKindCounter, "direct_cache_hit", "", ""),
+	capability(CapabilityKindCounter, "direct_cache_miss", "4.4", ""),
+	capability(CapabilityKindCounter, "preprocessed_cache_hit", "", ""),
+	capability(CapabilityKindCounter, "preprocessed_cache_miss", "4.4", ""),
+
+	// counters: uncacheable
+	capability(CapabilityKindCounter, "autoconf_test", "", ""),
+	capability(CapabilityKindCounter, "bad_compiler_arguments", "", ""),
+	capability(CapabilityKindCounter, "compile_failed", "", ""),
+	capability(CapabilityKindCounter, "compiler_produced_empty_output", "", ""),
+	capability(CapabilityKindCounter, "compiler_produced_no_output", "", ""),
+	capability(CapabilityKindCounter, "compiler_produced_stdout", "", ""),
+	capability(CapabilityKindCounter, "could_not_use_modules", "4.0", ""),
+	capability(CapabilityKindCounter, "could_not_use_precompiled_header", "", ""),
+	capability(CapabilityKindCounter, "disabled", "4.8", ""),
+	capability(CapabilityKindCounter, "multiple_source_files", "", ""),
+	capability(CapabilityKindCounter, "no_input_file", "", ""),
+	capability(CapabilityKindCounter, "output_to_stdout", "", ""),
+	capability(CapabilityKindCounter, "preprocessor_error", "", ""),
+	capability(CapabilityKindCounter, "recache", "4.4", ""),
+	capability(CapabilityKindCounter, "unsupported_code_directive", "", ""),
+	capability(CapabilityKindCounter, "unsupported_compiler_option", "", ""),
+	capability(CapabilityKindCounter, "unsupported_environment_variable", "4.6", ""),
+	capability(CapabilityKindCounter, "unsupported_source_language", "", ""),
+
+	// counters: errors
+	capability(CapabilityKindCounter, "bad_input_file", "4.8", ""),
+	capability(CapabilityKindCounter, "bad_output_file", "", ""),
+	capability(CapabilityKindCounter, "compiler_check_failed", "", ""),
+	capability(CapabilityKindCounter, "could_not_find_compiler", "", ""),
+	capability(CapabilityKindCounter, "error_hashing_extra_file", "", ""),
+	capability(CapabilityKindCounter, "internal_error", "", ""),
+	capability(CapabilityKindCounter, "missing_cache_file", "", ""),
+	capability(CapabilityKindCounter, "modified_input_file", "4.8", ""),
+
+	// counters: local storage
+	capability(CapabilityKindCounter, "local_storage_hit", "4.4", ""),
+	capability(CapabilityKindCounter, "local_storage_miss", "4.4", ""),
+	capability(CapabilityKindCounter, "local_storage_read_hit", "4.7", ""),
+	capability(CapabilityKindCounter, "local_storage_read_miss", "4.7", ""),
+	capability(CapabilityKindCounter, "local_storage_write", "4.7", ""),
+
+	// counters: remote storage
+	capability(CapabilityKindCounter, "remote_storage_error", "4.4", ""),
+	capability(CapabilityKindCounter, "remote_storage_hit", "4.4", ""),
+	capability(CapabilityKindCounter, "remote_storage_miss", "4.4", ""),
+	capability(CapabilityKindCounter, "remote_storage_timeout", "4.4", ""),
+	capability(CapabilityKindCounter, "remote_storage_read_hit", "4.7", ""),
+	capability(CapabilityKindCounter, "remote_storage_read_miss", "4.7", ""),
+	capability(CapabilityKindCounter, "remote_storage_write", "4.7", ""),
+
+	// configuration keys
+	capability(CapabilityKindConfigKey, "absolute_paths_in_stderr", "4.0", ""),
+	capability(CapabilityKindConfigKey, "base_dir", "", ""),
+	capability(CapabilityKindConfigKey, "cache_dir", "", ""),
+	capability(CapabilityKindConfigKey, "cache_dir_levels", "", "4.0"),
+	capability(CapabilityKindConfigKey, "compiler", "", ""),
+	capability(CapabilityKindConfigKey, "compiler_check", "", ""),
+	capability(CapabilityKindConfigKey, "compiler_type", "4.0", ""),
+	capability(CapabilityKindConfigKey, "compression", "", ""),
+	capability(CapabilityKindConfigKey, "compression_level", "", ""),
+	capability(CapabilityKindConfigKey, "cpp_extension", "", ""),
+	capability(CapabilityKindConfigKey, "debug", "3.5", ""),
+	capability(CapabilityKindConfigKey, "debug_dir", "4.0", ""),
+	capability(CapabilityKindConfigKey, "debug_level", "4.8", ""),
+	capability(CapabilityKindConfigKey, "depend_mode", "3.6", ""),
+	capability(CapabilityKindConfigKey, "direct_mode", "", ""),
+	capability(CapabilityKindConfigKey, "disable", "", ""),
+	capability(CapabilityKindConfigKey, "extra_files_to_hash", "", ""),
+	capability(CapabilityKindConfigKey, "file_clone", "4.0", ""),
+	capability(CapabilityKindConfigKey, "hard_link", "", ""),
+	capability(CapabilityKindConfigKey, "hash_dir", "", ""),
+	capability(CapabilityKindConfigKey, "ignore_headers_in_manifest", "", ""),
+	capability(CapabilityKindConfigKey, "ignore_options", "4.0", ""),
+	capability(CapabilityKindConfigKey, "inode_cache", "4.0", ""),
+	capability(CapabilityKindConfigKey, "keep_comments_cpp", "", ""),
+	capability(CapabilityKindConfigKey, "limit_multiple", "", "4.9"),
+	capability(CapabilityKindConfigKey, "log_file", "", ""),
+	capability(CapabilityKindConfigKey, "max_files", "", ""),
+	capability(CapabilityKindConfigKey, "max_size", "", ""),
+	capability(CapabilityKindConfigKey, "msvc_dep_prefix", "4.7", ""),
+	capability(CapabilityKindConfigKey, "namespace", "4.4", ""),
+	capability(CapabilityKindConfigKey, "path", "", ""),
+	capability(CapabilityKindConfigKey, "pch_external_checksum", "3.4", ""),
+	capability(CapabilityKindConfigKey, "prefix_command", "", ""),
+	capability(CapabilityKindConfigKey, "prefix_command_cpp", "", ""),
+	capability(CapabilityKindConfigKey, "read_only", "", ""),
+	capability(CapabilityKindConfigKey, "read_only_direct", "", ""),
+	capability(CapabilityKindConfigKey, "recache", "", ""),
+	capability(CapabilityKindConfigKey, "remote_only", "4.7", ""),
+	capability(CapabilityKindConfigKey, "remote_storage", "4.7", ""),
+	capability(CapabilityKindConfigKey, "reshare", "4.4", ""),
+	capability(CapabilityKindConfigKey, "response_file_format", "4.10", ""),
+	capability(CapabilityKindConfigKey, "run_second_cpp", "", ""),
+	capability(CapabilityKindConfigKey, "secondary_storage", "4.4", "4.7"),
+	capability(CapabilityKindConfigKey, "sloppiness", "", ""),
+	capability(CapabilityKindConfigKey, "stats", "", ""),
+	capability(CapabilityKindConfigKey, "stats_log", "4.4", ""),
+	capability(CapabilityKindConfigKey, "temporary_dir", "", ""),
+	capability(CapabilityKindConfigKey, "umask", "", ""),
+	capability(CapabilityKindConfigKey, "unify", "", "3.7"),
+}
+
+// CapabilityMatrix returns the capabilities of ccache, and the range of
+// versions providing each of them.
+func CapabilityMatrix() []Capability {
+	return slices.Clone(capabilityMatrix)
+}
+
+// Capabilities lists the commands, statistics counters and configuration keys
+// provided by a version of ccache.
+type Capabilities struct {
+	Version    string   `json:"version"`
+	Commands   []string `json:"commands"`
+	Counters   []string `json:"counters"`
+	ConfigKeys []string `json:"config_keys"`
+}
+
+// CapabilitiesFor returns the capabilities of the given version of ccache.
+func CapabilitiesFor(version *semver.Version) *Capabilities {
+	c := &Capabilities{
+		Version: version.Original(),
+	}
+
+	for _, capability := range capabilityMatrix {
+		if !capability.SupportedBy(version) {
+			continue
+		}
+
+		switch capability.Kind {
+		case CapabilityKindCommand:
+			c.Commands = append(c.Commands, capability.Name)
+		case CapabilityKindCounter:
+			c.Counters = append(c.Counters, capability.Name)
+		case CapabilityKindConfigKey:
+			c.ConfigKeys = append(c.ConfigKeys, capability.Name)
+		}
+	}
+
+	return c
+}
+
+// HasCommand returns whether ccache provides the given command-line option,
+// e.g. CommandRecompress.
+func (c *Capabilities) HasCommand(name string) bool {
+	return slices.Contains(c.Commands, name)
+}
+
+// HasCounter returns whether ccache reports the given statistics counter,
+// under its current name.
+//
+// Counters that are not listed in the capability matrix, e.g. those added by
+// newer ccache versions, are assumed to be reported.
+func (c *Capabilities) HasCounter(key string) bool {
+	key = canonicalStatisticsKey(key)
+
+	if slices.Contains(c.Counters, key) {
+		return true
+	}
+
+	_, listed := capabilityFor(CapabilityKindCounter, key)
+
+	return !listed
+}
+
+// HasConfigKey returns whether ccache reads the given configuration key.
+//
+// Keys that are not listed in the capability matrix are assumed to be read.
+func (c *Capabilities) HasConfigKey(key string) bool {
+	if slices.Contains(c.ConfigKeys, key) {
+		return true
+	}
+
+	_, listed := capabilityFor(CapabilityKindConfigKey, key)
+
+	return !listed
+}
+
+// capabilityFor returns the capability of the given kind and name.
+func capabilityFor(kind CapabilityKind, name string) (Capability, bool) {
+	i := slices.IndexFunc(capabilityMatrix, func(capability Capability) bool {
+		return capability.Kind == kind && capability.Name == name
+	})
+	if i < 0 {
+		return Capability{}, false
+	}
+
+	return capabilityMatrix[i], true
+}
@@ -0,0 +1,252 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+func TestCapabilitiesFor(t *testing.T) {
+	cases := []struct {
+		tname          string
+		version        string
+		wantCommands   map[string]bool
+		wantCounters   map[string]bool
+		wantConfigKeys map[string]bool
+	}{
+		{
+			tname:   "ccache 3.6",
+			version: "3.6",
+			wantCommands: map[string]bool{
+				CommandShowStats:      true,
+				CommandPrintStats:     false,
+				CommandPrintConfig:    true,
+				CommandShowConfig:     false,
+				CommandRecompress:     false,
+				CommandEvictOlderThan: false,
+			},
+			wantCounters: map[string]bool{
+				"cache_miss":         true,
+				"local_storage_hit":  false,
+				"remote_storage_hit": false,
+			},
+			wantConfigKeys: map[string]bool{
+				"max_size":          true,
+				"secondary_storage": false,
+				"remote_storage":    false,
+			},
+		},
+		{
+			tname:   "ccache 4.4",
+			version: "4.4",
+			wantCommands: map[string]bool{
+				CommandPrintStats:     true,
+				CommandPrintStatsJSON: false,
+				CommandShowConfig:     true,
+				CommandEvictOlderThan: true,
+				CommandDir:            true,
+			},
+			wantCounters: map[string]bool{
+				"primary_storage_hit":     true,
+				"remote_storage_hit":      true,
+				"remote_storage_read_hit": false,
+			},
+			wantConfigKeys: map[string]bool{
+				"secondary_storage": true,
+				"remote_storage":    false,
+			},
+		},
+		{
+			tname:   "ccache 4.10.2",
+			version: "4.10.2",
+			wantCommands: map[string]bool{
+				CommandPrintStatsJSON: true,
+			},
+			wantCounters: map[string]bool{
+				"local_storage_write":     true,
+				"remote_storage_read_hit": true,
+				"counter_from_the_future": true,
+			},
+			wantConfigKeys: map[string]bool{
+				"secondary_storage": false,
+				"remote_storage":    true,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			caps := CapabilitiesFor(semver.MustParse(tc.version))
+
+			if caps.Version != tc.version {
+				t.Errorf("want version %q, got %q", tc.version, caps.Version)
+			}
+
+			for command, want := range tc.wantCommands {
+				if got := caps.HasCommand(command); got != want {
+					t.Errorf("command %q: want %t, got %t", command, want, got)
+				}
+			}
+
+			for counter, want := range tc.wantCounters {
+				if got := caps.HasCounter(counter); got != want {
+					t.Errorf("counter %q: want %t, got %t", counter, want, got)
+				}
+			}
+
+			for key, want := range tc.wantConfigKeys {
+				if got := caps.HasConfigKey(key); got != want {
+					t.Errorf("configuration key %q: want %t, got %t", key, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCapabilityMatrixCoversParsers(t *testing.T) {
+	for key := range statisticsCounters {
+		if _, listed := capabilityFor(CapabilityKindCounter, key); !listed {
+			t.Errorf("counter %q: want a capability, got none", key)
+		}
+	}
+
+	for key := range configurationFields {
+		if _, listed := capabilityFor(CapabilityKindConfigKey, key); !listed {
+			t.Errorf("configuration key %q: want a capability, got none", key)
+		}
+	}
+}
+
+func TestCapabilitiesForTestdata(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "*-ccache-*"))
+	if err != nil {
+		t.Fatalf("failed to list test data: %q", err)
+	}
+
+	for _, dir := range dirs {
+		_, versionStr, _ := strings.Cut(filepath.Base(dir), "-ccache-")
+		versionStr, _, _ = strings.Cut(versionStr, "-")
+
+		caps := CapabilitiesFor(semver.MustParse(versionStr))
+
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			// all configuration keys are printed by ccache
+			if configBytes, err := os.ReadFile(filepath.Join(dir, "config")); err == nil {
+				config, err := ParseConfiguration(string(configBytes))
+				if err != nil {
+					t.Fatalf("expected no error, got %q", err)
+				}
+
+				var keys []string
+				for _, entry := range config.Entries {
+					keys = append(keys, entry.Key)
+				}
+
+				slices.Sort(keys)
+				wantKeys := slices.Sorted(slices.Values(caps.ConfigKeys))
+
+				if !slices.Equal(keys, wantKeys) {
+					t.Errorf("want configuration keys %q, got %q", wantKeys, keys)
+				}
+			}
+
+			tsvFilepaths, err := filepath.Glob(filepath.Join(dir, "*.tsv"))
+			if err != nil {
+				t.Fatalf("failed to list test data: %q", err)
+			}
+
+			for _, tsvFilepath := range tsvFilepaths {
+				tsvBytes, err := os.ReadFile(tsvFilepath)
+				if err != nil {
+					t.Fatalf("failed to read test data: %q", err)
+				}
+
+				for line := range strings.Lines(string(tsvBytes)) {
+					key, _, _ := strings.Cut(line, "\t")
+					if strings.HasPrefix(key, "stats_") {
+						// timestamps
+						continue
+					}
+
+					if !slices.Contains(caps.Counters, canonicalStatisticsKey(key)) {
+						t.Errorf("%s: want counter %q in capabilities", filepath.Base(tsvFilepath), key)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCapabilityVersionRange(t *testing.T) {
+	cases := []struct {
+		tname      string
+		capability Capability
+		want       string
+	}{
+		{
+			tname:      "all versions",
+			capability: capability(CapabilityKindCommand, CommandShowStats, "", ""),
+			want:       "all",
+		},
+		{
+			tname:      "since",
+			capability: capability(CapabilityKindCommand, CommandRecompress, "4.0", ""),
+			want:       ">= 4.0",
+		},
+		{
+			tname:      "until",
+			capability: capability(CapabilityKindConfigKey, "run_second_cpp", "", "4.0"),
+			want:       "< 4.0",
+		},
+		{
+			tname:      "range",
+			capability: capability(CapabilityKindConfigKey, "secondary_storage", "4.4", "4.8"),
+			want:       ">= 4.4, < 4.8",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			if got := tc.capability.VersionRange(); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWrapperCapabilities(t *testing.T) {
+	cmd := &upgradableCommand{
+		fakeCommand: &fakeCommand{},
+		version:     "ccache version 4.2",
+	}
+
+	wrapper := newTestWrapper(t, cmd)
+
+	caps, err := wrapper.Capabilities(context.Background())
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if caps.HasCounter("remote_storage_hit") {
+		t.Error("want no remote storage counters with ccache 4.2")
+	}
+
+	cmd.upgrade("4.9.1")
+
+	caps, err = wrapper.Capabilities(context.Background())
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if caps.Version != "4.9.1" || !caps.HasCounter("remote_storage_hit") {
+		t.Errorf("want the capabilities of ccache 4.9.1, got %v", caps)
+	}
+}
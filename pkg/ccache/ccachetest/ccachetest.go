@@ -0,0 +1,333 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+// Package ccachetest provides a fake ccache executable, to test programs
+// invoking ccache against captured outputs of any ccache version.
+//
+// The fake executable is a shell script answering ccache commands with the
+// outputs stored in a profile directory, such as those of the
+// pkg/ccache/testdata directory of this repository:
+//
+//   - empty, firstbuild, secondbuild: output of `ccache --show-stats`; if
+//     missing, nothing is printed
+//   - empty.tsv, firstbuild.tsv, secondbuild.tsv: output of `ccache --print-stats`
+//   - empty.json, firstbuild.json, secondbuild.json: output of
+//     `ccache --print-stats --format=json`
+//   - config: output of `ccache --show-config`; if missing, the configuration
+//     is empty
+//   - version: output of `ccache --version`; if missing, the version is read
+//     from the name of the directory, e.g. "debian-12-ccache-4.7.5"
+//
+// Commands whose output was not captured fail as unsupported options, as
+// ccache does.
+//
+// Latency, non-zero exit codes and garbage output can be injected, and changed
+// while a test runs.
+//
+// The fake executable requires a POSIX shell, and is not available on Windows.
+package ccachetest
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// DefaultSnapshot is the snapshot replayed by a new Fake.
+	DefaultSnapshot = "firstbuild"
+
+	// Garbage is an output that no ccache parser understands.
+	Garbage = "\x00\xff\xfe garbage\toutput\nccache: ???\n{\"cache_miss\": \n"
+
+	callsFileName    = "calls"
+	exitCodeFileName = "exit_code"
+	garbageFileName  = "garbage"
+	latencyFileName  = "latency"
+	profileDirName   = "profile"
+	snapshotFileName = "snapshot"
+	stderrFileName   = "stderr"
+	versionFileName  = "version"
+)
+
+var (
+	// version of ccache in the name of a profile directory, e.g.
+	// "debian-12-ccache-4.7.5"
+	profileVersionRegex = regexp.MustCompile(`ccache-(\d+(?:\.\d+)*)`)
+)
+
+// script answers ccache commands with the files of the fake's directory, which
+// is passed as the first format argument, quoted for the shell.
+const script = `#!/bin/sh
+dir=%s
+
+printf '%%s\n' "$*" >> "$dir/calls"
+
+# options selecting the cache directory and configuration file
+while [ "$1" = "--dir" ] || [ "$1" = "--config-path" ]; do
+	shift 2
+done
+
+if [ -f "$dir/latency" ]; then
+	sleep "$(cat "$dir/latency")"
+fi
+
+if [ -f "$dir/exit_code" ]; then
+	cat "$dir/stderr" >&2
+	exit "$(cat "$dir/exit_code")"
+fi
+
+if [ -f "$dir/garbage" ]; then
+	cat "$dir/garbage"
+	exit 0
+fi
+
+profile="$dir/profile"
+snapshot="$(cat "$dir/snapshot")"
+
+reply() {
+	if [ ! -f "$1" ]; then
+		echo "ccache: unrecognized option '$2'" >&2
+		exit 1
+	fi
+
+	cat "$1"
+}
+
+case "$*" in
+--version|-V) cat "$dir/version" ;;
+--show-config|--print-config|-p) cat "$profile/config" 2>/dev/null || true ;;
+"--print-stats --format=json") reply "$profile/$snapshot.json" "--format=json" ;;
+--print-stats) reply "$profile/$snapshot.tsv" "$1" ;;
+--show-stats|-s) cat "$profile/$snapshot" 2>/dev/null || true ;;
+--zero-stats|-z) echo "Statistics zeroed" ;;
+--cleanup|-c) echo "Cleaned cache" ;;
+--clear|-C) echo "Cleared cache" ;;
+"--max-size "*|"-M "*) echo "Set cache size limit to $2" ;;
+--set-config=*|"--evict-older-than "*) ;;
+*)
+	echo "ccache: unrecognized option '$1'" >&2
+	exit 1
+	;;
+esac
+`
+
+// Fake is a fake ccache executable.
+type Fake struct {
+	// Path to the fake executable.
+	Path string
+
+	t   testing.TB
+	dir string
+}
+
+// Option configures a Fake.
+type Option func(*Fake)
+
+// WithSnapshot replays the given snapshot, e.g. "empty" or "secondbuild".
+func WithSnapshot(name string) Option {
+	return func(f *Fake) {
+		f.SetSnapshot(name)
+	}
+}
+
+// WithVersion sets the version printed by `ccache --version`, e.g. "4.10.2",
+// overriding the version of the profile.
+func WithVersion(version string) Option {
+	return func(f *Fake) {
+		f.SetVersion(version)
+	}
+}
+
+// WithLatency delays every command by the given duration, rounded up to the
+// second.
+func WithLatency(latency time.Duration) Option {
+	return func(f *Fake) {
+		f.SetLatency(latency)
+	}
+}
+
+// WithExitCode makes every command print stderr and exit with the given code.
+func WithExitCode(code int, stderr string) Option {
+	return func(f *Fake) {
+		f.SetExitCode(code, stderr)
+	}
+}
+
+// WithGarbage makes every command print the given output, e.g. Garbage.
+func WithGarbage(output string) Option {
+	return func(f *Fake) {
+		f.SetGarbage(output)
+	}
+}
+
+// New writes a fake ccache executable answering commands with the outputs
+// stored in profileDir, and returns it.
+//
+// The fake executable is removed when the test completes. The test is skipped
+// on Windows.
+func New(t testing.TB, profileDir string, options ...Option) *Fake {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("ccachetest: the fake ccache executable requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+
+	f := &Fake{
+		Path: filepath.Join(dir, "ccache"),
+		t:    t,
+		dir:  dir,
+	}
+
+	if err := os.CopyFS(filepath.Join(dir, profileDirName), os.DirFS(profileDir)); err != nil {
+		t.Fatalf("ccachetest: failed to copy profile: %q", err)
+	}
+
+	version, err := os.ReadFile(filepath.Join(profileDir, versionFileName))
+	switch {
+	case err == nil:
+		f.writeFile(versionFileName, string(version))
+
+	case os.IsNotExist(err):
+		matches := profileVersionRegex.FindStringSubmatch(filepath.Base(profileDir))
+		if len(matches) != 2 {
+			t.Fatalf("ccachetest: no version found for profile %q", profileDir)
+		}
+
+		f.writeFile(versionFileName, "ccache version "+matches[1]+"\n")
+
+	default:
+		t.Fatalf("ccachetest: failed to read version: %q", err)
+	}
+
+	f.SetSnapshot(DefaultSnapshot)
+
+	if err := os.WriteFile(f.Path, fmt.Appendf(nil, script, shellQuote(dir)), 0o755); err != nil {
+		t.Fatalf("ccachetest: failed to write fake ccache: %q", err)
+	}
+
+	for _, option := range options {
+		option(f)
+	}
+
+	return f
+}
+
+// shellQuote quotes a string for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeFile writes a file read by the fake executable.
+func (f *Fake) writeFile(name string, content string) {
+	f.t.Helper()
+
+	if err := os.WriteFile(filepath.Join(f.dir, name), []byte(content), 0o644); err != nil {
+		f.t.Fatalf("ccachetest: failed to write %s: %q", name, err)
+	}
+}
+
+// removeFile removes a file read by the fake executable, if it exists.
+func (f *Fake) removeFile(name string) {
+	f.t.Helper()
+
+	if err := os.Remove(filepath.Join(f.dir, name)); err != nil && !os.IsNotExist(err) {
+		f.t.Fatalf("ccachetest: failed to remove %s: %q", name, err)
+	}
+}
+
+// SetVersion sets the version printed by `ccache --version` from now on, e.g.
+// "4.10.2".
+func (f *Fake) SetVersion(version string) {
+	f.t.Helper()
+
+	f.writeFile(versionFileName, "ccache version "+version+"\n")
+}
+
+// SetSnapshot replays the given snapshot from now on, e.g. "empty" or
+// "secondbuild".
+func (f *Fake) SetSnapshot(name string) {
+	f.t.Helper()
+
+	f.writeFile(snapshotFileName, name)
+}
+
+// SetLatency delays every command by the given duration from now on, rounded
+// up to the second as POSIX sleep only accepts whole seconds; 0 removes the
+// delay.
+func (f *Fake) SetLatency(latency time.Duration) {
+	f.t.Helper()
+
+	if latency <= 0 {
+		f.removeFile(latencyFileName)
+		return
+	}
+
+	seconds := int64((latency + time.Second - 1) / time.Second)
+
+	f.writeFile(latencyFileName, strconv.FormatInt(seconds, 10))
+}
+
+// SetExitCode makes every command print stderr and exit with the given code
+// from now on; 0 restores normal answers.
+func (f *Fake) SetExitCode(code int, stderr string) {
+	f.t.Helper()
+
+	if code == 0 {
+		f.removeFile(exitCodeFileName)
+		f.removeFile(stderrFileName)
+		return
+	}
+
+	f.writeFile(stderrFileName, stderr)
+	f.writeFile(exitCodeFileName, strconv.Itoa(code))
+}
+
+// SetGarbage makes every command print the given output from now on, e.g.
+// Garbage; an empty output restores normal answers.
+func (f *Fake) SetGarbage(output string) {
+	f.t.Helper()
+
+	if output == "" {
+		f.removeFile(garbageFileName)
+		return
+	}
+
+	f.writeFile(garbageFileName, output)
+}
+
+// Calls returns the arguments of every command run so far, in order.
+func (f *Fake) Calls() []string {
+	f.t.Helper()
+
+	file, err := os.Open(filepath.Join(f.dir, callsFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		f.t.Fatalf("ccachetest: failed to read calls: %q", err)
+	}
+	defer file.Close()
+
+	var calls []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		calls = append(calls, strings.TrimSpace(scanner.Text()))
+	}
+
+	if err := scanner.Err(); err != nil {
+		f.t.Fatalf("ccachetest: failed to read calls: %q", err)
+	}
+
+	return calls
+}
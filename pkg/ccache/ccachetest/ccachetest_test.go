@@ -0,0 +1,224 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccachetest_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/virtualtam/ccache_exporter/v4/pkg/ccache"
+	"github.com/virtualtam/ccache_exporter/v4/pkg/ccache/ccachetest"
+)
+
+var (
+	testdataDir = filepath.Join("..", "testdata")
+)
+
+// newWrapper returns a Wrapper invoking the fake ccache executable.
+func newWrapper(t *testing.T, fake *ccachetest.Fake) *ccache.Wrapper {
+	t.Helper()
+
+	cmd, err := ccache.NewLocalCommand(context.Background(), fake.Path)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	wrapper, err := ccache.NewWrapper(context.Background(), cmd)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	return wrapper
+}
+
+func TestFakeProfiles(t *testing.T) {
+	profileDirs, err := filepath.Glob(filepath.Join(testdataDir, "*-ccache-*"))
+	if err != nil {
+		t.Fatalf("failed to list profiles: %q", err)
+	}
+
+	for _, profileDir := range profileDirs {
+		if strings.Contains(profileDir, "cache-directory") {
+			continue
+		}
+
+		t.Run(filepath.Base(profileDir), func(t *testing.T) {
+			fake := ccachetest.New(t, profileDir, ccachetest.WithSnapshot("secondbuild"))
+			wrapper := newWrapper(t, fake)
+
+			if _, err := wrapper.Configuration(context.Background()); err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			got, err := wrapper.Statistics(context.Background())
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			// statistics are read with --print-stats since ccache 3.7
+			fixture := filepath.Join(profileDir, "secondbuild.tsv")
+			if _, err := os.Stat(fixture); err != nil {
+				fixture = filepath.Join(profileDir, "secondbuild")
+			}
+
+			input, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatalf("failed to open fixture: %q", err)
+			}
+
+			want, err := ccache.ParseStatistics(string(input))
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			if got.CacheableCalls() != want.CacheableCalls() {
+				t.Errorf("want %d cacheable calls, got %d", want.CacheableCalls(), got.CacheableCalls())
+			}
+
+			if got.FilesInCache != want.FilesInCache {
+				t.Errorf("want %d files in cache, got %d", want.FilesInCache, got.FilesInCache)
+			}
+		})
+	}
+}
+
+func TestFakeSnapshots(t *testing.T) {
+	fake := ccachetest.New(t, filepath.Join(testdataDir, "ubuntu-24.04-ccache-4.9.1"), ccachetest.WithSnapshot("empty"))
+	wrapper := newWrapper(t, fake)
+
+	var calls []int64
+
+	for _, snapshot := range []string{"empty", "firstbuild", "secondbuild"} {
+		fake.SetSnapshot(snapshot)
+
+		stats, err := wrapper.Statistics(context.Background())
+		if err != nil {
+			t.Fatalf("want no error, got %q", err)
+		}
+
+		calls = append(calls, stats.CacheableCalls())
+	}
+
+	if calls[0] != 0 || calls[1] == 0 || calls[2] <= calls[1] {
+		t.Errorf("want cacheable calls to increase through snapshots, got %v", calls)
+	}
+
+	wantCalls := []string{"-s", "--version", "--print-stats", "--print-stats", "--print-stats"}
+	if got := fake.Calls(); !slices.Equal(got, wantCalls) {
+		t.Errorf("want calls %q, got %q", wantCalls, got)
+	}
+}
+
+func TestFakeUnsupportedCommand(t *testing.T) {
+	// ccache 4.10 prints statistics as JSON, which was not captured
+	fake := ccachetest.New(t, filepath.Join(testdataDir, "ubuntu-20.04-ccache-3.7.7"), ccachetest.WithVersion("4.10.2"))
+	wrapper := newWrapper(t, fake)
+
+	if _, err := wrapper.Statistics(context.Background()); err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	calls := fake.Calls()
+	wantCalls := []string{"--print-stats --format=json", "--print-stats"}
+
+	if !slices.Equal(calls[len(calls)-2:], wantCalls) {
+		t.Errorf("want a fallback to tab-separated values, got calls %q", calls)
+	}
+}
+
+func TestFakeLatency(t *testing.T) {
+	fake := ccachetest.New(t, filepath.Join(testdataDir, "debian-12-ccache-4.7.5"))
+	wrapper := newWrapper(t, fake)
+
+	fake.SetLatency(5 * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err := wrapper.Statistics(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want error %q, got %q", context.DeadlineExceeded, err)
+	}
+
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Errorf("want the command to be interrupted, returned after %s", elapsed)
+	}
+
+	// rounded up to the second
+	fake.SetLatency(10 * time.Millisecond)
+
+	start = time.Now()
+
+	if _, err := wrapper.Statistics(context.Background()); err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("want the command to be delayed by one second, returned after %s", elapsed)
+	}
+
+	fake.SetLatency(0)
+
+	if _, err := wrapper.Statistics(context.Background()); err != nil {
+		t.Errorf("want no error, got %q", err)
+	}
+}
+
+func TestFakeExitCode(t *testing.T) {
+	fake := ccachetest.New(
+		t,
+		filepath.Join(testdataDir, "debian-12-ccache-4.7.5"),
+		ccachetest.WithExitCode(2, "ccache: error: Failed to create directory"),
+	)
+
+	_, err := ccache.NewLocalCommand(context.Background(), fake.Path)
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("want an exec.ExitError, got %q", err)
+	}
+
+	if exitErr.ExitCode() != 2 {
+		t.Errorf("want exit code 2, got %d", exitErr.ExitCode())
+	}
+
+	if !strings.Contains(string(exitErr.Stderr), "Failed to create directory") {
+		t.Errorf("want the error message in stderr, got %q", exitErr.Stderr)
+	}
+}
+
+func TestFakeGarbage(t *testing.T) {
+	fake := ccachetest.New(t, filepath.Join(testdataDir, "debian-12-ccache-4.7.5"))
+	wrapper := newWrapper(t, fake)
+
+	fake.SetGarbage(ccachetest.Garbage)
+
+	if _, _, err := wrapper.StatisticsWithMode(context.Background(), ccache.ParseModeStrict); err == nil {
+		t.Error("want an error in strict mode, got none")
+	}
+
+	cmd, err := ccache.NewLocalCommand(context.Background(), fake.Path)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if _, err := ccache.NewWrapper(context.Background(), cmd); !errors.Is(err, ccache.ErrVersionMissing) {
+		t.Errorf("want error %q, got %q", ccache.ErrVersionMissing, err)
+	}
+
+	fake.SetGarbage("")
+
+	if _, _, err := wrapper.StatisticsWithMode(context.Background(), ccache.ParseModeStrict); err != nil {
+		t.Errorf("want no error, got %q", err)
+	}
+}
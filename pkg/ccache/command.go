@@ -3,78 +3,393 @@
 
 package ccache
 
-import "os/exec"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
 
 const (
 	DefaultBinaryPath = "/usr/bin/ccache"
+
+	// delay after which the output pipes of a cancelled command are closed,
+	// should a process outlive it
+	commandWaitDelay = time.Second
+)
+
+var (
+	ErrBinaryIdentityUnavailable error = errors.New("command: binary identity unavailable")
 )
 
+// DefaultEnvironment lists the environment variables passed to ccache by
+// default; a trailing "*" matches any variable starting with the given prefix.
+//
+// CCACHE_* variables are not passed, so that the settings of the current
+// process do not affect ccache; the cache directory and configuration file are
+// set with WithCacheDirectory and WithConfigPath.
+var DefaultEnvironment = []string{
+	"HOME",
+	"PATH",
+	"TMPDIR",
+	"XDG_CACHE_HOME",
+	"XDG_CONFIG_HOME",
+}
+
 var _ Command = &LocalCommand{}
 
 // Command exposes supported ccache commands.
+//
+// Commands are aborted when the context is cancelled or its deadline expires.
 type Command interface {
-	PrintConfig() (string, error)
-	ShowConfig() (string, error)
+	PrintConfig(ctx context.Context) (string, error)
+	ShowConfig(ctx context.Context) (string, error)
 
-	PrintStats() (string, error)
-	ShowStats() (string, error)
+	PrintStats(ctx context.Context) (string, error)
+	PrintStatsJSON(ctx context.Context) (string, error)
+	ShowStats(ctx context.Context) (string, error)
+
+	Version(ctx context.Context) (string, error)
+
+	ZeroStats(ctx context.Context) (string, error)
+	Cleanup(ctx context.Context) (string, error)
+	Clear(ctx context.Context) (string, error)
+	EvictOlderThan(ctx context.Context, age string) (string, error)
+	Recompress(ctx context.Context, level string) (string, error)
+	SetConfig(ctx context.Context, key string, value string) (string, error)
+	SetMaxSize(ctx context.Context, size string) (string, error)
+}
+
+// BinaryIdentity identifies a ccache executable, to detect when it is
+// replaced, e.g. when ccache is upgraded in place.
+type BinaryIdentity struct {
+	Path    string
+	Inode   uint64
+	ModTime time.Time
+}
+
+// Equal returns whether both identities designate the same executable.
+func (b BinaryIdentity) Equal(other BinaryIdentity) bool {
+	return b.Path == other.Path && b.Inode == other.Inode && b.ModTime.Equal(other.ModTime)
+}
 
-	Version() (string, error)
+// String returns the path, inode and modification time of the executable.
+func (b BinaryIdentity) String() string {
+	return fmt.Sprintf("%s (inode %d, modified %s)", b.Path, b.Inode, b.ModTime.Format(time.RFC3339Nano))
 }
 
+// BinaryIdentifier is implemented by Commands that can identify the ccache
+// executable they invoke.
+type BinaryIdentifier interface {
+	BinaryIdentity() (BinaryIdentity, error)
+}
+
+var _ BinaryIdentifier = &LocalCommand{}
+
 // LocalCommand runs ccache commands in a local shell.
 type LocalCommand struct {
 	path string
+
+	// command line prepended to ccache commands, e.g. `sudo -u builder`
+	prefix []string
+
+	cacheDirectory string
+	configPath     string
+
+	// environment variables passed to ccache
+	environment []string
+
+	// whether ccache supports the --dir and --config-path options
+	supportsDirOptions bool
 }
 
-func (c *LocalCommand) exec(option string) (string, error) {
-	out, err := exec.Command(c.path, option).Output()
+// LocalCommandOption configures a LocalCommand.
+type LocalCommandOption func(*LocalCommand)
+
+// WithCacheDirectory runs ccache commands against the given cache directory.
+//
+// The directory is passed with the --dir option (ccache >= 4.4), or the
+// CCACHE_DIR environment variable otherwise.
+func WithCacheDirectory(path string) LocalCommandOption {
+	return func(c *LocalCommand) {
+		c.cacheDirectory = path
+	}
+}
+
+// WithConfigPath runs ccache commands with the given configuration file.
+//
+// The path is passed with the --config-path option (ccache >= 4.4), or the
+// CCACHE_CONFIGPATH environment variable otherwise.
+func WithConfigPath(path string) LocalCommandOption {
+	return func(c *LocalCommand) {
+		c.configPath = path
+	}
+}
+
+// WithEnvironment sets the environment variables passed to ccache, replacing
+// DefaultEnvironment; a trailing "*" matches any variable starting with the
+// given prefix.
+//
+// Other variables of the current process are not passed to ccache.
+func WithEnvironment(names ...string) LocalCommandOption {
+	return func(c *LocalCommand) {
+		c.environment = names
+	}
+}
+
+// BinaryIdentity returns the path, inode and modification time of the ccache
+// executable, looked up in PATH if needed.
+func (c *LocalCommand) BinaryIdentity() (BinaryIdentity, error) {
+	path, err := exec.LookPath(c.path)
+	if err != nil {
+		return BinaryIdentity{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return BinaryIdentity{}, err
+	}
+
+	return BinaryIdentity{
+		Path:    path,
+		Inode:   fileInode(info),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// args returns the options selecting the cache directory and configuration
+// file, followed by the given arguments.
+func (c *LocalCommand) args(args ...string) []string {
+	if !c.supportsDirOptions {
+		return args
+	}
+
+	var options []string
+
+	if c.cacheDirectory != "" {
+		options = append(options, "--dir", c.cacheDirectory)
+	}
+
+	if c.configPath != "" {
+		options = append(options, "--config-path", c.configPath)
+	}
+
+	return append(options, args...)
+}
+
+// env returns the allowed environment variables of the current process, and
+// the variables selecting the cache directory and configuration file.
+func (c *LocalCommand) env() []string {
+	env := []string{}
+
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+
+		if environmentAllows(c.environment, name) {
+			env = append(env, entry)
+		}
+	}
+
+	if c.supportsDirOptions {
+		return env
+	}
+
+	// the last value of a variable takes precedence
+	if c.cacheDirectory != "" {
+		env = append(env, "CCACHE_DIR="+c.cacheDirectory)
+	}
+
+	if c.configPath != "" {
+		env = append(env, "CCACHE_CONFIGPATH="+c.configPath)
+	}
+
+	return env
+}
+
+// environmentAllows returns whether an environment variable is matched by an
+// allow-list.
+func environmentAllows(allowList []string, name string) bool {
+	for _, allowed := range allowList {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+
+			continue
+		}
+
+		if name == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exec runs ccache with the given arguments, and returns its output.
+//
+// Outputs larger than MaxOutputSize are discarded, and ErrOutputTooLarge is
+// returned. If ccache fails, its error output is returned in the Stderr field
+// of the exec.ExitError.
+//
+// When the context is done, the whole process group of the command is killed
+// (on Unix systems), and the context error is returned.
+func (c *LocalCommand) exec(ctx context.Context, args ...string) (string, error) {
+	var cmd *exec.Cmd
+
+	if len(c.prefix) > 0 {
+		prefixArgs := append(c.prefix[1:len(c.prefix):len(c.prefix)], c.path)
+		cmd = exec.CommandContext(ctx, c.prefix[0], append(prefixArgs, c.args(args...)...)...)
+	} else {
+		cmd = exec.CommandContext(ctx, c.path, c.args(args...)...)
+	}
+
+	cmd.Env = c.env()
+	cmd.WaitDelay = commandWaitDelay
+	killProcessGroupOnCancel(cmd, len(c.prefix) > 0)
+
+	var stdout, stderr outputBuffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", ctxErr
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// as set by exec.Cmd.Output
+		exitErr.Stderr = stderr.buffer.Bytes()
+	}
 
 	if err != nil {
 		return "", err
 	}
 
-	return string(out[:]), nil
+	return stdout.Output()
 }
 
 // PrintConfig returns the result of `ccache --print-config`.
 //
 // Available for ccache < 3.7
-func (c *LocalCommand) PrintConfig() (string, error) {
-	return c.exec("--print-config")
+func (c *LocalCommand) PrintConfig(ctx context.Context) (string, error) {
+	return c.exec(ctx, "--print-config")
 }
 
 // ShowConfig returns the result of `ccache --show-config`.
 //
 // Available since ccache 3.7
-func (c *LocalCommand) ShowConfig() (string, error) {
-	return c.exec("--show-config")
+func (c *LocalCommand) ShowConfig(ctx context.Context) (string, error) {
+	return c.exec(ctx, "--show-config")
 }
 
 // PrintStats returns the result of `ccache --print-stats`.
 //
 // Available since ccache 3.7
-func (c *LocalCommand) PrintStats() (string, error) {
-	return c.exec("--print-stats")
+func (c *LocalCommand) PrintStats(ctx context.Context) (string, error) {
+	return c.exec(ctx, "--print-stats")
+}
+
+// PrintStatsJSON returns the result of `ccache --print-stats --format=json`.
+//
+// Available since ccache 4.10
+func (c *LocalCommand) PrintStatsJSON(ctx context.Context) (string, error) {
+	return c.exec(ctx, "--print-stats", "--format=json")
 }
 
 // ShowStats returns the result of “ccache --show-stats”.
-func (c *LocalCommand) ShowStats() (string, error) {
-	return c.exec("--show-stats")
+func (c *LocalCommand) ShowStats(ctx context.Context) (string, error) {
+	return c.exec(ctx, "--show-stats")
 }
 
 // Version returns the result of “ccache --version”.
-func (c *LocalCommand) Version() (string, error) {
-	return c.exec("--version")
+func (c *LocalCommand) Version(ctx context.Context) (string, error) {
+	return c.exec(ctx, "--version")
+}
+
+// ZeroStats returns the result of `ccache --zero-stats`.
+func (c *LocalCommand) ZeroStats(ctx context.Context) (string, error) {
+	return c.exec(ctx, "--zero-stats")
+}
+
+// Cleanup returns the result of `ccache --cleanup`.
+func (c *LocalCommand) Cleanup(ctx context.Context) (string, error) {
+	return c.exec(ctx, "--cleanup")
+}
+
+// Clear returns the result of `ccache --clear`.
+func (c *LocalCommand) Clear(ctx context.Context) (string, error) {
+	return c.exec(ctx, "--clear")
+}
+
+// EvictOlderThan returns the result of `ccache --evict-older-than <age>`.
+//
+// Available since ccache 4.4
+func (c *LocalCommand) EvictOlderThan(ctx context.Context, age string) (string, error) {
+	return c.exec(ctx, "--evict-older-than", age)
+}
+
+// Recompress returns the result of `ccache --recompress <level>`.
+//
+// Available since ccache 4.0
+func (c *LocalCommand) Recompress(ctx context.Context, level string) (string, error) {
+	return c.exec(ctx, "--recompress", level)
+}
+
+// SetConfig returns the result of `ccache --set-config <key>=<value>`.
+func (c *LocalCommand) SetConfig(ctx context.Context, key string, value string) (string, error) {
+	return c.exec(ctx, "--set-config="+key+"="+value)
+}
+
+// SetMaxSize returns the result of `ccache --max-size <size>`.
+func (c *LocalCommand) SetMaxSize(ctx context.Context, size string) (string, error) {
+	return c.exec(ctx, "--max-size", size)
 }
 
 // NewLocalCommand ensures the ccache executable exists and can be invoked, and
-// returns an initialized BinaryWrapper.
-func NewLocalCommand(path string) (*LocalCommand, error) {
-	err := exec.Command(path, "-s").Run()
-	if err != nil {
+// returns an initialized LocalCommand.
+//
+// If a cache directory or configuration file is set, the version of ccache is
+// checked to determine how to pass them.
+func NewLocalCommand(ctx context.Context, path string, options ...LocalCommandOption) (*LocalCommand, error) {
+	c := &LocalCommand{
+		path:        path,
+		environment: DefaultEnvironment,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	if err := c.init(ctx); err != nil {
 		return &LocalCommand{}, err
 	}
 
-	return &LocalCommand{path: path}, nil
+	return c, nil
+}
+
+// init checks the version of ccache if a cache directory or configuration
+// file is set, and ensures ccache can be invoked.
+func (c *LocalCommand) init(ctx context.Context) error {
+	if c.cacheDirectory != "" || c.configPath != "" {
+		out, err := c.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		version, err := parseVersion(out)
+		if err != nil {
+			return err
+		}
+
+		c.supportsDirOptions = CapabilitiesFor(version).HasCommand(CommandDir)
+	}
+
+	_, err := c.exec(ctx, "-s")
+
+	return err
 }
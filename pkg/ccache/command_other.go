@@ -0,0 +1,21 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+//go:build !unix
+
+package ccache
+
+import (
+	"os"
+	"os/exec"
+)
+
+// fileInode returns 0, as inode numbers are not exposed on this platform; the
+// modification time still identifies a replaced file.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
+
+// killProcessGroupOnCancel keeps the default behaviour of exec.CommandContext,
+// which only kills the command process, as process groups are not supported.
+func killProcessGroupOnCancel(cmd *exec.Cmd, prefixed bool) {}
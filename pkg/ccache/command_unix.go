@@ -0,0 +1,46 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+//go:build unix
+
+package ccache
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// fileInode returns the inode number of a file.
+func fileInode(info os.FileInfo) uint64 {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	return uint64(stat.Ino)
+}
+
+// killProcessGroupOnCancel runs the command in a new process group, which is
+// killed when the context of the command is done.
+//
+// This ensures processes spawned by ccache, e.g. a compiler check or a remote
+// storage helper, do not outlive it.
+//
+// A prefixed command may run ccache as another user, which cannot be killed;
+// the process group is then terminated, so that the prefix command, e.g. sudo,
+// relays the signal to ccache. The prefix command is killed if it is still
+// running after commandWaitDelay.
+func killProcessGroupOnCancel(cmd *exec.Cmd, prefixed bool) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	signal := syscall.SIGKILL
+	if prefixed {
+		signal = syscall.SIGTERM
+	}
+
+	cmd.Cancel = func() error {
+		// a negative PID designates the process group
+		return syscall.Kill(-cmd.Process.Pid, signal)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+//go:build unix
+
+package ccache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processIsRunning returns whether a process exists and is not a zombie.
+func processIsRunning(t *testing.T, pid int) bool {
+	t.Helper()
+
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		t.Skipf("cannot read process status: %q", err)
+	}
+
+	// <pid> (<comm>) <state> ...
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestLocalCommandKillsProcessGroupOnTimeout(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("procfs is not available")
+	}
+
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "child.pid")
+	script := filepath.Join(dir, "ccache")
+
+	// simulate a hung ccache process, waiting for a child process
+	content := "#!/bin/sh\nsleep 60 &\necho $! > " + pidFile + "\nwait\n"
+
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatalf("failed to write fake ccache: %q", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	c := &LocalCommand{path: script}
+
+	start := time.Now()
+
+	_, err := c.PrintStats(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want error %q, got %q", context.DeadlineExceeded, err)
+	}
+
+	if elapsed := time.Since(start); elapsed >= commandWaitDelay {
+		t.Errorf("want the command to be killed on timeout, returned after %s", elapsed)
+	}
+
+	pidContent, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("failed to read child PID: %q", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidContent)))
+	if err != nil {
+		t.Fatalf("failed to parse child PID: %q", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+
+	for processIsRunning(t, pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("want child process %d to be killed, still running", pid)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLocalCommandDiscardsLargeOutput(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ccache")
+
+	// simulate a binary printing more than MaxOutputSize bytes
+	content := "#!/bin/sh\nhead -c " + strconv.Itoa(2*MaxOutputSize) + " /dev/zero\n"
+
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatalf("failed to write fake ccache: %q", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := &LocalCommand{path: script}
+
+	out, err := c.PrintStats(ctx)
+	if !errors.Is(err, ErrOutputTooLarge) {
+		t.Fatalf("want error %q, got %q", ErrOutputTooLarge, err)
+	}
+
+	if out != "" {
+		t.Errorf("want no output, got %d bytes", len(out))
+	}
+}
+
+// writeFakeCcache writes a shell script reporting the given version, and
+// printing its arguments and environment otherwise.
+func writeFakeCcache(t *testing.T, version string) string {
+	t.Helper()
+
+	script := filepath.Join(t.TempDir(), "ccache")
+
+	content := `#!/bin/sh
+case "$*" in
+*--version*) echo "ccache version ` + version + `"; exit 0 ;;
+esac
+echo "args=$*"
+env | sort
+`
+
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatalf("failed to write fake ccache: %q", err)
+	}
+
+	return script
+}
+
+func TestLocalCommandOptions(t *testing.T) {
+	cases := []struct {
+		tname       string
+		version     string
+		options     []LocalCommandOption
+		wantArgs    string
+		wantEnv     []string
+		wantMissing []string
+	}{
+		{
+			tname:       "default environment",
+			version:     "4.9.1",
+			wantArgs:    "args=--print-stats",
+			wantEnv:     []string{"HOME=/home/cached"},
+			wantMissing: []string{"CCACHE_DIR=", "CCACHE_MAXSIZE=", "EXPORTER_SECRET="},
+		},
+		{
+			tname:   "cache directory with ccache 4.9.1",
+			version: "4.9.1",
+			options: []LocalCommandOption{
+				WithCacheDirectory("/var/cache/ccache/gcc"),
+				WithConfigPath("/etc/ccache/gcc.conf"),
+			},
+			wantArgs:    "args=--dir /var/cache/ccache/gcc --config-path /etc/ccache/gcc.conf --print-stats",
+			wantEnv:     []string{"HOME=/home/cached"},
+			wantMissing: []string{"CCACHE_DIR=", "CCACHE_CONFIGPATH=", "CCACHE_MAXSIZE=", "EXPORTER_SECRET="},
+		},
+		{
+			tname:   "cache directory with ccache 4.2",
+			version: "4.2",
+			options: []LocalCommandOption{
+				WithCacheDirectory("/var/cache/ccache/gcc"),
+				WithConfigPath("/etc/ccache/gcc.conf"),
+			},
+			wantArgs:    "args=--print-stats",
+			wantEnv:     []string{"CCACHE_DIR=/var/cache/ccache/gcc", "CCACHE_CONFIGPATH=/etc/ccache/gcc.conf"},
+			wantMissing: []string{"CCACHE_DIR=/home/cached/.ccache", "CCACHE_MAXSIZE=", "EXPORTER_SECRET="},
+		},
+		{
+			tname:   "explicit environment",
+			version: "3.7.7",
+			options: []LocalCommandOption{
+				WithCacheDirectory("/var/cache/ccache/clang"),
+				WithEnvironment("PATH", "EXPORTER_*"),
+			},
+			wantArgs:    "args=--print-stats",
+			wantEnv:     []string{"CCACHE_DIR=/var/cache/ccache/clang", "EXPORTER_SECRET=hunter2"},
+			wantMissing: []string{"CCACHE_MAXSIZE=", "HOME="},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			t.Setenv("CCACHE_DIR", "/home/cached/.ccache")
+			t.Setenv("CCACHE_MAXSIZE", "5G")
+			t.Setenv("EXPORTER_SECRET", "hunter2")
+			t.Setenv("HOME", "/home/cached")
+
+			c, err := NewLocalCommand(context.Background(), writeFakeCcache(t, tc.version), tc.options...)
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			out, err := c.PrintStats(context.Background())
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			lines := strings.Split(out, "\n")
+
+			if lines[0] != tc.wantArgs {
+				t.Errorf("want %q, got %q", tc.wantArgs, lines[0])
+			}
+
+			for _, want := range tc.wantEnv {
+				found := false
+
+				for _, line := range lines[1:] {
+					if line == want {
+						found = true
+						break
+					}
+				}
+
+				if !found {
+					t.Errorf("want %q in the environment, got:\n%s", want, out)
+				}
+			}
+
+			for _, unwanted := range tc.wantMissing {
+				for _, line := range lines[1:] {
+					if strings.HasPrefix(line, unwanted) {
+						t.Errorf("want no %q in the environment, got %q", unwanted, line)
+					}
+				}
+			}
+		})
+	}
+}
+
+// writeFakePrefix writes a shell script printing its arguments to a file, and
+// running the command passed as arguments.
+func writeFakePrefix(t *testing.T) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "prefix")
+	argsFile := filepath.Join(dir, "args")
+
+	content := "#!/bin/sh\necho \"$*\" >> " + argsFile + "\nshift\nexec \"$@\"\n"
+
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatalf("failed to write fake prefix: %q", err)
+	}
+
+	return script, argsFile
+}
+
+func TestPrefixCommand(t *testing.T) {
+	prefix, argsFile := writeFakePrefix(t)
+	ccachePath := writeFakeCcache(t, "4.9.1")
+
+	c, err := NewPrefixCommand(
+		context.Background(),
+		[]string{prefix, "--user=builder"},
+		ccachePath,
+		WithCacheDirectory("/var/cache/ccache/gcc"),
+	)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if !c.supportsDirOptions {
+		t.Error("want the version to be detected through the prefix")
+	}
+
+	out, err := c.PrintStats(context.Background())
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	wantArgs := "args=--dir /var/cache/ccache/gcc --print-stats"
+	if got := strings.Split(out, "\n")[0]; got != wantArgs {
+		t.Errorf("want %q, got %q", wantArgs, got)
+	}
+
+	prefixArgs, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("failed to read prefix arguments: %q", err)
+	}
+
+	wantPrefixArgs := []string{
+		"--user=builder " + ccachePath + " --version",
+		"--user=builder " + ccachePath + " --dir /var/cache/ccache/gcc -s",
+		"--user=builder " + ccachePath + " --dir /var/cache/ccache/gcc --print-stats",
+	}
+
+	gotPrefixArgs := strings.Split(strings.TrimSpace(string(prefixArgs)), "\n")
+
+	if len(gotPrefixArgs) != len(wantPrefixArgs) {
+		t.Fatalf("want prefix invocations %q, got %q", wantPrefixArgs, gotPrefixArgs)
+	}
+
+	for i, want := range wantPrefixArgs {
+		if gotPrefixArgs[i] != want {
+			t.Errorf("want prefix invocation %q, got %q", want, gotPrefixArgs[i])
+		}
+	}
+}
+
+func TestPrefixCommandErrors(t *testing.T) {
+	_, err := NewPrefixCommand(context.Background(), nil, DefaultBinaryPath)
+	if !errors.Is(err, ErrCommandPrefixEmpty) {
+		t.Errorf("want error %q, got %q", ErrCommandPrefixEmpty, err)
+	}
+
+	prefix, _ := writeFakePrefix(t)
+
+	_, err = NewPrefixCommand(context.Background(), []string{prefix, "--user=builder"}, filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Error("want an error for a missing ccache binary, got none")
+	}
+}
+
+func TestWrapperDetectsReplacedBinary(t *testing.T) {
+	path := writeFakeCcache(t, "4.2")
+
+	c, err := NewLocalCommand(context.Background(), path)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	wrapper, err := NewWrapper(context.Background(), c)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	// replace the executable, as package managers do
+	upgraded := writeFakeCcache(t, "4.9.1")
+	if err := os.Rename(upgraded, path); err != nil {
+		t.Fatalf("failed to replace fake ccache: %q", err)
+	}
+
+	// the fake prints its arguments instead of statistics
+	if _, err := wrapper.Statistics(context.Background()); err != nil && !errors.Is(err, ErrStatisticsNoEntry) {
+		t.Fatalf("want error %q, got %q", ErrStatisticsNoEntry, err)
+	}
+
+	if got := wrapper.Version(); got != "4.9.1" {
+		t.Errorf("want version %q, got %q", "4.9.1", got)
+	}
+}
@@ -4,24 +4,215 @@
 package ccache
 
 import (
-	"bufio"
+	"errors"
+	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"unicode"
 
 	"github.com/alecthomas/units"
 )
 
+const (
+	ConfigurationOriginDefault     = "default"
+	ConfigurationOriginEnvironment = "environment"
+)
+
+const (
+	// configurationFormat identifies ccache configuration outputs in parse
+	// errors.
+	configurationFormat StatisticsFormat = "config"
+)
+
+var (
+	ErrConfigurationValueInvalid error = errors.New("configuration: invalid value")
+)
+
+// ConfigurationEntry represents a configuration setting, and where its value
+// comes from.
+//
+// The origin is either ConfigurationOriginDefault,
+// ConfigurationOriginEnvironment, or the path to the configuration file
+// setting the value.
+type ConfigurationEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Origin string `json:"origin"`
+}
+
 // Configuration represents information about ccache configuration.
+//
+// Credentials contained in remote storage settings are redacted.
+//
+// See https://ccache.dev/manual/latest.html#_configuration_options
 type Configuration struct {
 	CacheDirectory    string            `json:"cache_directory"`
 	PrimaryConfig     string            `json:"primary_config"`
 	MaxCacheSize      string            `json:"max_cache_size"`
 	MaxCacheSizeBytes units.MetricBytes `json:"max_cache_size_bytes"`
+
+	AbsolutePathsInStderr   bool                   `json:"absolute_paths_in_stderr"`
+	BaseDirectory           string                 `json:"base_dir"`
+	CacheDirectoryLevels    int64                  `json:"cache_dir_levels"`
+	Compiler                string                 `json:"compiler"`
+	CompilerCheck           string                 `json:"compiler_check"`
+	CompilerType            string                 `json:"compiler_type"`
+	Compression             bool                   `json:"compression"`
+	CompressionLevel        int64                  `json:"compression_level"`
+	CppExtension            string                 `json:"cpp_extension"`
+	Debug                   bool                   `json:"debug"`
+	DebugDirectory          string                 `json:"debug_dir"`
+	DebugLevel              int64                  `json:"debug_level"`
+	DependMode              bool                   `json:"depend_mode"`
+	DirectMode              bool                   `json:"direct_mode"`
+	Disable                 bool                   `json:"disable"`
+	ExtraFilesToHash        string                 `json:"extra_files_to_hash"`
+	FileClone               bool                   `json:"file_clone"`
+	HardLink                bool                   `json:"hard_link"`
+	HashDirectory           bool                   `json:"hash_dir"`
+	IgnoreHeadersInManifest string                 `json:"ignore_headers_in_manifest"`
+	IgnoreOptions           string                 `json:"ignore_options"`
+	InodeCache              bool                   `json:"inode_cache"`
+	KeepCommentsCpp         bool                   `json:"keep_comments_cpp"`
+	LimitMultiple           float64                `json:"limit_multiple"`
+	LogFile                 string                 `json:"log_file"`
+	MaxFiles                int64                  `json:"max_files"`
+	MSVCDepPrefix           string                 `json:"msvc_dep_prefix"`
+	Namespace               string                 `json:"namespace"`
+	Path                    string                 `json:"path"`
+	PCHExternalChecksum     bool                   `json:"pch_external_checksum"`
+	PrefixCommand           string                 `json:"prefix_command"`
+	PrefixCommandCpp        string                 `json:"prefix_command_cpp"`
+	ReadOnly                bool                   `json:"read_only"`
+	ReadOnlyDirect          bool                   `json:"read_only_direct"`
+	Recache                 bool                   `json:"recache"`
+	RemoteOnly              bool                   `json:"remote_only"`
+	RemoteStorage           string                 `json:"remote_storage"`
+	RemoteStorageBackends   []RemoteStorageBackend `json:"remote_storage_backends,omitempty"`
+	Reshare                 bool                   `json:"reshare"`
+	ResponseFileFormat      string                 `json:"response_file_format"`
+	RunSecondCpp            bool                   `json:"run_second_cpp"`
+	Sloppiness              []string               `json:"sloppiness"`
+	Stats                   bool                   `json:"stats"`
+	StatsLog                string                 `json:"stats_log"`
+	TemporaryDirectory      string                 `json:"temporary_dir"`
+	Umask                   string                 `json:"umask"`
+	Unify                   bool                   `json:"unify"`
+
+	// Entries lists all configuration settings, in the order in which they
+	// are reported by ccache.
+	Entries []ConfigurationEntry `json:"entries,omitempty"`
+}
+
+// configurationFields maps configuration keys to the function setting the
+// corresponding Configuration field.
+var configurationFields = map[string]func(*Configuration, string) error{
+	"absolute_paths_in_stderr":   boolField(func(c *Configuration) *bool { return &c.AbsolutePathsInStderr }),
+	"base_dir":                   stringField(func(c *Configuration) *string { return &c.BaseDirectory }),
+	"cache_dir":                  (*Configuration).setCacheDirectory,
+	"cache_dir_levels":           intField(func(c *Configuration) *int64 { return &c.CacheDirectoryLevels }),
+	"compiler":                   stringField(func(c *Configuration) *string { return &c.Compiler }),
+	"compiler_check":             stringField(func(c *Configuration) *string { return &c.CompilerCheck }),
+	"compiler_type":              stringField(func(c *Configuration) *string { return &c.CompilerType }),
+	"compression":                boolField(func(c *Configuration) *bool { return &c.Compression }),
+	"compression_level":          intField(func(c *Configuration) *int64 { return &c.CompressionLevel }),
+	"cpp_extension":              stringField(func(c *Configuration) *string { return &c.CppExtension }),
+	"debug":                      boolField(func(c *Configuration) *bool { return &c.Debug }),
+	"debug_dir":                  stringField(func(c *Configuration) *string { return &c.DebugDirectory }),
+	"debug_level":                intField(func(c *Configuration) *int64 { return &c.DebugLevel }),
+	"depend_mode":                boolField(func(c *Configuration) *bool { return &c.DependMode }),
+	"direct_mode":                boolField(func(c *Configuration) *bool { return &c.DirectMode }),
+	"disable":                    boolField(func(c *Configuration) *bool { return &c.Disable }),
+	"extra_files_to_hash":        stringField(func(c *Configuration) *string { return &c.ExtraFilesToHash }),
+	"file_clone":                 boolField(func(c *Configuration) *bool { return &c.FileClone }),
+	"hard_link":                  boolField(func(c *Configuration) *bool { return &c.HardLink }),
+	"hash_dir":                   boolField(func(c *Configuration) *bool { return &c.HashDirectory }),
+	"ignore_headers_in_manifest": stringField(func(c *Configuration) *string { return &c.IgnoreHeadersInManifest }),
+	"ignore_options":             stringField(func(c *Configuration) *string { return &c.IgnoreOptions }),
+	"inode_cache":                boolField(func(c *Configuration) *bool { return &c.InodeCache }),
+	"keep_comments_cpp":          boolField(func(c *Configuration) *bool { return &c.KeepCommentsCpp }),
+	"limit_multiple":             floatField(func(c *Configuration) *float64 { return &c.LimitMultiple }),
+	"log_file":                   stringField(func(c *Configuration) *string { return &c.LogFile }),
+	"max_files":                  intField(func(c *Configuration) *int64 { return &c.MaxFiles }),
+	"max_size":                   (*Configuration).setMaxCacheSize,
+	"msvc_dep_prefix":            stringField(func(c *Configuration) *string { return &c.MSVCDepPrefix }),
+	"namespace":                  stringField(func(c *Configuration) *string { return &c.Namespace }),
+	"path":                       stringField(func(c *Configuration) *string { return &c.Path }),
+	"pch_external_checksum":      boolField(func(c *Configuration) *bool { return &c.PCHExternalChecksum }),
+	"prefix_command":             stringField(func(c *Configuration) *string { return &c.PrefixCommand }),
+	"prefix_command_cpp":         stringField(func(c *Configuration) *string { return &c.PrefixCommandCpp }),
+	"read_only":                  boolField(func(c *Configuration) *bool { return &c.ReadOnly }),
+	"read_only_direct":           boolField(func(c *Configuration) *bool { return &c.ReadOnlyDirect }),
+	"recache":                    boolField(func(c *Configuration) *bool { return &c.Recache }),
+	"remote_only":                boolField(func(c *Configuration) *bool { return &c.RemoteOnly }),
+	"remote_storage":             (*Configuration).setRemoteStorage,
+	"reshare":                    boolField(func(c *Configuration) *bool { return &c.Reshare }),
+	"response_file_format":       stringField(func(c *Configuration) *string { return &c.ResponseFileFormat }),
+	"run_second_cpp":             boolField(func(c *Configuration) *bool { return &c.RunSecondCpp }),
+	"sloppiness":                 (*Configuration).setSloppiness,
+	"stats":                      boolField(func(c *Configuration) *bool { return &c.Stats }),
+	"stats_log":                  stringField(func(c *Configuration) *string { return &c.StatsLog }),
+	"temporary_dir":              stringField(func(c *Configuration) *string { return &c.TemporaryDirectory }),
+	"umask":                      stringField(func(c *Configuration) *string { return &c.Umask }),
+	"unify":                      boolField(func(c *Configuration) *bool { return &c.Unify }),
+
+	// renamed to remote_storage in ccache 4.8
+	"secondary_storage": (*Configuration).setRemoteStorage,
 }
 
-func splitConfigurationField(c rune) bool {
-	return unicode.IsSpace(c) || c == '=' || c == '(' || c == ')'
+// sensitiveConfigurationKeys lists the configuration keys whose value may
+// contain credentials.
+var sensitiveConfigurationKeys = map[string]bool{
+	"remote_storage":    true,
+	"secondary_storage": true,
+}
+
+func boolField(field func(*Configuration) *bool) func(*Configuration, string) error {
+	return func(c *Configuration, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		*field(c) = b
+
+		return nil
+	}
+}
+
+func floatField(field func(*Configuration) *float64) func(*Configuration, string) error {
+	return func(c *Configuration, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+
+		*field(c) = f
+
+		return nil
+	}
+}
+
+func intField(field func(*Configuration) *int64) func(*Configuration, string) error {
+	return func(c *Configuration, value string) error {
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		*field(c) = i
+
+		return nil
+	}
+}
+
+func stringField(field func(*Configuration) *string) func(*Configuration, string) error {
+	return func(c *Configuration, value string) error {
+		*field(c) = value
+
+		return nil
+	}
 }
 
 // ParseConfiguration parses ccache configuration returned by the
@@ -30,47 +221,169 @@ func splitConfigurationField(c rune) bool {
 //
 // See https://ccache.dev/releasenotes.html#_ccache_3_7
 func ParseConfiguration(text string) (*Configuration, error) {
-	reader := strings.NewReader(text)
-	scanner := bufio.NewScanner(reader)
+	configuration, _, err := ParseConfigurationWithMode(ParseModeDefault, text)
+
+	return configuration, err
+}
+
+// ParseConfigurationWithMode parses ccache configuration with the given mode.
+//
+// In lenient mode, settings with a malformed value are kept in Entries with
+// their raw value, and returned as warnings; the corresponding Configuration
+// fields are left unset.
+func ParseConfigurationWithMode(mode ParseMode, text string) (*Configuration, []*ParseError, error) {
+	p := newParseState(configurationFormat, mode)
+	scanner := newOutputScanner(text)
 
 	configuration := &Configuration{}
-	var err error
+	lineNumber := 0
 
 	for scanner.Scan() {
+		lineNumber++
+
 		// split each configuration line into 3 fields:
 		//
 		// (<configuration source>) <key> = <value>
-		fields := strings.FieldsFunc(scanner.Text(), splitConfigurationField)
-		if len(fields) < 3 {
+		line, found := strings.CutPrefix(scanner.Text(), "(")
+		if !found {
 			continue
 		}
 
-		switch fields[1] {
-		case "cache_dir":
-			configuration.CacheDirectory = fields[2]
-			configuration.PrimaryConfig = filepath.Join(fields[2], "ccache.conf")
-
-		case "max_size":
-			var sanitizedMaxCacheSize string
-			if len(fields) == 4 {
-				sanitizedMaxCacheSize = fields[2] + fields[3]
-			} else {
-				sanitizedMaxCacheSize = fields[2]
-			}
+		origin, setting, found := strings.Cut(line, ") ")
+		if !found {
+			continue
+		}
+
+		key, value, found := strings.Cut(setting, "=")
+		if !found {
+			continue
+		}
+
+		if err := configuration.set(p, lineNumber, strings.TrimSpace(key), strings.TrimSpace(value), origin); err != nil {
+			return &Configuration{}, nil, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return &Configuration{}, nil, err
+	}
 
-			sanitizedMaxCacheSize = strings.Replace(strings.ToUpper(sanitizedMaxCacheSize), " ", "", -1)
+	return configuration, p.warnings, nil
+}
 
-			if !strings.HasSuffix(sanitizedMaxCacheSize, "B") {
-				sanitizedMaxCacheSize += "B"
+// Lookup returns the configuration entry for the given key, if it has been
+// reported by ccache.
+func (c *Configuration) Lookup(key string) (ConfigurationEntry, bool) {
+	for _, entry := range c.Entries {
+		if entry.Key == key {
+			return entry, true
+		}
+	}
+
+	return ConfigurationEntry{}, false
+}
+
+// set records a configuration entry, and sets the corresponding Configuration
+// field if the key is modelled.
+//
+// Values that may contain credentials are redacted. In lenient mode, malformed
+// values are recorded as warnings, and kept in the entry.
+func (c *Configuration) set(p *parseState, line int, key, value, origin string) error {
+	entry := ConfigurationEntry{
+		Key:    key,
+		Value:  value,
+		Origin: origin,
+	}
+
+	if setField, ok := configurationFields[key]; ok {
+		if err := setField(c, value); err != nil {
+			if p.mode != ParseModeLenient {
+				if sensitiveConfigurationKeys[key] {
+					return fmt.Errorf("%w: %s: %w", ErrConfigurationValueInvalid, key, err)
+				}
+
+				return fmt.Errorf("%w: %s: %q: %w", ErrConfigurationValueInvalid, key, value, err)
 			}
 
-			configuration.MaxCacheSize = sanitizedMaxCacheSize
-			configuration.MaxCacheSizeBytes, err = units.ParseMetricBytes(sanitizedMaxCacheSize)
-			if err != nil {
-				return &Configuration{}, err
+			if errors.Is(err, ErrRemoteStorageAttributeInvalid) {
+				entry.Value = c.RemoteStorage
+			} else if sensitiveConfigurationKeys[key] {
+				entry.Value = redactedValue
 			}
+
+			p.warnings = append(p.warnings, &ParseError{
+				Format: p.format,
+				Line:   line,
+				Key:    key,
+				Value:  entry.Value,
+				Err:    fmt.Errorf("%w: %w", ErrConfigurationValueInvalid, err),
+			})
+			c.Entries = append(c.Entries, entry)
+
+			return nil
 		}
 	}
 
-	return configuration, nil
+	if sensitiveConfigurationKeys[key] {
+		entry.Value = c.RemoteStorage
+	}
+
+	c.Entries = append(c.Entries, entry)
+
+	return nil
+}
+
+func (c *Configuration) setCacheDirectory(value string) error {
+	c.CacheDirectory = value
+	c.PrimaryConfig = filepath.Join(value, configFileName)
+
+	return nil
+}
+
+// setMaxCacheSize parses and sets the maximum cache size, as formatted in
+// ccache configuration files.
+//
+// As for ccache, the size is expressed in gigabytes if it has no unit.
+func (c *Configuration) setMaxCacheSize(value string) error {
+	value = strings.TrimSpace(value)
+
+	if strings.IndexFunc(value, unicode.IsLetter) == -1 {
+		value += "G"
+	}
+
+	maxCacheSizeBytes, err := ParseSize(value)
+	if err != nil {
+		return err
+	}
+
+	c.MaxCacheSize = normalizeSize(value)
+	c.MaxCacheSizeBytes = maxCacheSizeBytes
+
+	return nil
+}
+
+// setRemoteStorage parses the list of remote storage backends, and sets the
+// remote storage setting with credentials redacted.
+//
+// Backends are set even if some of their attributes are invalid.
+func (c *Configuration) setRemoteStorage(value string) error {
+	backends, err := ParseRemoteStorage(value)
+	if err != nil && !errors.Is(err, ErrRemoteStorageAttributeInvalid) {
+		return err
+	}
+
+	c.RemoteStorage = formatRemoteStorage(backends)
+	c.RemoteStorageBackends = backends
+
+	return err
+}
+
+// setSloppiness parses the list of sloppiness options, that may be separated
+// by commas and/or spaces.
+func (c *Configuration) setSloppiness(value string) error {
+	c.Sloppiness = strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	return nil
 }
@@ -4,6 +4,9 @@
 package ccache
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/alecthomas/units"
@@ -39,6 +42,30 @@ func TestParseConfiguration(t *testing.T) {
 				MaxCacheSizeBytes: units.MetricBytes(15000000000),
 			},
 		},
+		{
+			tname: "configured via file (without size unit)",
+			input: `(default) cache_dir = /home/cached/.ccache
+(/home/cached/.ccache/ccache.conf) max_size = 10
+`,
+			want: Configuration{
+				CacheDirectory:    "/home/cached/.ccache",
+				PrimaryConfig:     "/home/cached/.ccache/ccache.conf",
+				MaxCacheSize:      "10GB",
+				MaxCacheSizeBytes: units.MetricBytes(10000000000),
+			},
+		},
+		{
+			tname: "configured via file (binary size unit)",
+			input: `(default) cache_dir = /home/cached/.ccache
+(default) max_size = 5.0 GiB
+`,
+			want: Configuration{
+				CacheDirectory:    "/home/cached/.ccache",
+				PrimaryConfig:     "/home/cached/.ccache/ccache.conf",
+				MaxCacheSize:      "5.0GiB",
+				MaxCacheSizeBytes: units.MetricBytes(5368709120),
+			},
+		},
 		{
 			tname: "configured via file",
 			input: `(default) cache_dir = /home/cached/.ccache
@@ -73,3 +100,340 @@ func assertConfigurationsEqual(t *testing.T, got, want *Configuration) {
 	assertStringFieldEquals(t, "MaxCacheSize", got.MaxCacheSize, want.MaxCacheSize)
 	assertMetricByteFieldEquals(t, "MaxCacheSizeBytes", got.MaxCacheSizeBytes, want.MaxCacheSizeBytes)
 }
+
+func TestParseConfigurationEntries(t *testing.T) {
+	input := `(default) base_dir = 
+(environment) cache_dir = /home/cached/.ccache
+(/etc/ccache.conf) compression = true
+(/home/cached/.ccache/ccache.conf) max_size = 5.0G
+(default) msvc_dep_prefix = Note: including file:
+(environment) some_future_setting = enabled
+`
+
+	want := []ConfigurationEntry{
+		{Key: "base_dir", Value: "", Origin: ConfigurationOriginDefault},
+		{Key: "cache_dir", Value: "/home/cached/.ccache", Origin: ConfigurationOriginEnvironment},
+		{Key: "compression", Value: "true", Origin: "/etc/ccache.conf"},
+		{Key: "max_size", Value: "5.0G", Origin: "/home/cached/.ccache/ccache.conf"},
+		{Key: "msvc_dep_prefix", Value: "Note: including file:", Origin: ConfigurationOriginDefault},
+		{Key: "some_future_setting", Value: "enabled", Origin: ConfigurationOriginEnvironment},
+	}
+
+	got, err := ParseConfiguration(input)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if len(got.Entries) != len(want) {
+		t.Fatalf("want %d entries, got %d", len(want), len(got.Entries))
+	}
+
+	for index, wantEntry := range want {
+		if got.Entries[index] != wantEntry {
+			t.Errorf("entry %d: want %#v, got %#v", index, wantEntry, got.Entries[index])
+		}
+	}
+
+	entry, ok := got.Lookup("compression")
+	if !ok {
+		t.Fatal("compression: want entry, got none")
+	}
+	assertStringFieldEquals(t, "Origin", entry.Origin, "/etc/ccache.conf")
+
+	if _, ok := got.Lookup("namespace"); ok {
+		t.Error("namespace: want no entry, got one")
+	}
+
+	assertStringFieldEquals(t, "MSVCDepPrefix", got.MSVCDepPrefix, "Note: including file:")
+}
+
+func TestParseConfigurationFields(t *testing.T) {
+	cases := []struct {
+		tname     string
+		inputPath string
+		want      Configuration
+	}{
+		{
+			tname:     "ccache 3.3.4",
+			inputPath: filepath.Join("testdata", "debian-9-ccache-3.3.4", "config"),
+			want: Configuration{
+				CacheDirectory:       "/home/cached/.ccache",
+				PrimaryConfig:        "/home/cached/.ccache/ccache.conf",
+				MaxCacheSize:         "5.0GB",
+				MaxCacheSizeBytes:    units.MetricBytes(5000000000),
+				CacheDirectoryLevels: 2,
+				CompilerCheck:        "mtime",
+				Compression:          false,
+				CompressionLevel:     6,
+				DirectMode:           true,
+				HashDirectory:        true,
+				LimitMultiple:        0.8,
+				RunSecondCpp:         true,
+				Stats:                true,
+			},
+		},
+		{
+			tname:     "ccache 4.7.5",
+			inputPath: filepath.Join("testdata", "debian-12-ccache-4.7.5", "config"),
+			want: Configuration{
+				CacheDirectory:     "/home/cached/.ccache",
+				PrimaryConfig:      "/home/cached/.ccache/ccache.conf",
+				MaxCacheSize:       "5.0GB",
+				MaxCacheSizeBytes:  units.MetricBytes(5000000000),
+				CompilerCheck:      "mtime",
+				CompilerType:       "auto",
+				Compression:        true,
+				DirectMode:         true,
+				HashDirectory:      true,
+				LimitMultiple:      0.8,
+				MSVCDepPrefix:      "Note: including file:",
+				RunSecondCpp:       true,
+				Stats:              true,
+				TemporaryDirectory: "/home/cached/.ccache/tmp",
+			},
+		},
+		{
+			tname:     "ccache 4.9.1",
+			inputPath: filepath.Join("testdata", "ubuntu-24.04-ccache-4.9.1", "config"),
+			want: Configuration{
+				CacheDirectory:     "/home/cached/.ccache",
+				PrimaryConfig:      "/home/cached/.ccache/ccache.conf",
+				MaxCacheSize:       "5.0GiB",
+				MaxCacheSizeBytes:  units.MetricBytes(5368709120),
+				CompilerCheck:      "mtime",
+				CompilerType:       "auto",
+				Compression:        true,
+				DirectMode:         true,
+				HashDirectory:      true,
+				MSVCDepPrefix:      "Note: including file:",
+				RunSecondCpp:       true,
+				Stats:              true,
+				TemporaryDirectory: "/home/cached/.ccache/tmp",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			input, err := os.ReadFile(tc.inputPath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			got, err := ParseConfiguration(string(input))
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			assertConfigurationsEqual(t, got, &tc.want)
+
+			assertIntFieldEquals(t, "CacheDirectoryLevels", got.CacheDirectoryLevels, tc.want.CacheDirectoryLevels)
+			assertStringFieldEquals(t, "CompilerCheck", got.CompilerCheck, tc.want.CompilerCheck)
+			assertStringFieldEquals(t, "CompilerType", got.CompilerType, tc.want.CompilerType)
+			assertBoolFieldEquals(t, "Compression", got.Compression, tc.want.Compression)
+			assertIntFieldEquals(t, "CompressionLevel", got.CompressionLevel, tc.want.CompressionLevel)
+			assertBoolFieldEquals(t, "DependMode", got.DependMode, tc.want.DependMode)
+			assertBoolFieldEquals(t, "DirectMode", got.DirectMode, tc.want.DirectMode)
+			assertBoolFieldEquals(t, "HashDirectory", got.HashDirectory, tc.want.HashDirectory)
+			assertFloatFieldAlmostEquals(t, "LimitMultiple", got.LimitMultiple, tc.want.LimitMultiple)
+			assertIntFieldEquals(t, "MaxFiles", got.MaxFiles, tc.want.MaxFiles)
+			assertStringFieldEquals(t, "MSVCDepPrefix", got.MSVCDepPrefix, tc.want.MSVCDepPrefix)
+			assertBoolFieldEquals(t, "ReadOnly", got.ReadOnly, tc.want.ReadOnly)
+			assertBoolFieldEquals(t, "RunSecondCpp", got.RunSecondCpp, tc.want.RunSecondCpp)
+			assertBoolFieldEquals(t, "Stats", got.Stats, tc.want.Stats)
+			assertStringFieldEquals(t, "TemporaryDirectory", got.TemporaryDirectory, tc.want.TemporaryDirectory)
+		})
+	}
+}
+
+func TestParseConfigurationSettings(t *testing.T) {
+	cases := []struct {
+		tname string
+		input string
+		check func(t *testing.T, c *Configuration)
+	}{
+		{
+			tname: "remote storage",
+			input: `(environment) remote_only = true
+(environment) remote_storage = redis://ccache-testdata-ubuntu-24.04-redis:6379
+`,
+			check: func(t *testing.T, c *Configuration) {
+				assertBoolFieldEquals(t, "RemoteOnly", c.RemoteOnly, true)
+				assertStringFieldEquals(t, "RemoteStorage", c.RemoteStorage, "redis://ccache-testdata-ubuntu-24.04-redis:6379")
+			},
+		},
+		{
+			tname: "remote storage with credentials",
+			input: `(environment) remote_storage = redis://s3cr3t@redis.example.com http://cache.example.com|bearer-token=s3cr3t
+`,
+			check: func(t *testing.T, c *Configuration) {
+				want := "redis://xxxxx@redis.example.com http://cache.example.com|bearer-token=xxxxx"
+
+				assertStringFieldEquals(t, "RemoteStorage", c.RemoteStorage, want)
+				assertStringFieldEquals(t, "Entries[0].Value", c.Entries[0].Value, want)
+
+				if len(c.RemoteStorageBackends) != 2 {
+					t.Fatalf("RemoteStorageBackends: want 2 backends, got %d", len(c.RemoteStorageBackends))
+				}
+
+				assertStringFieldEquals(t, "RemoteStorageBackends[0].Host", c.RemoteStorageBackends[0].Host, "redis.example.com")
+				assertStringFieldEquals(t, "RemoteStorageBackends[1].Host", c.RemoteStorageBackends[1].Host, "cache.example.com")
+			},
+		},
+		{
+			tname: "secondary storage (ccache < 4.8)",
+			input: `(/etc/ccache.conf) secondary_storage = http://localhost:8080|read-only=true
+`,
+			check: func(t *testing.T, c *Configuration) {
+				assertStringFieldEquals(t, "RemoteStorage", c.RemoteStorage, "http://localhost:8080|read-only=true")
+			},
+		},
+		{
+			tname: "sloppiness",
+			input: `(/home/cached/.ccache/ccache.conf) sloppiness = include_file_ctime, time_macros,pch_defines
+`,
+			check: func(t *testing.T, c *Configuration) {
+				want := []string{"include_file_ctime", "time_macros", "pch_defines"}
+
+				if len(c.Sloppiness) != len(want) {
+					t.Fatalf("Sloppiness: want %q, got %q", want, c.Sloppiness)
+				}
+
+				for index, option := range want {
+					assertStringFieldEquals(t, "Sloppiness", c.Sloppiness[index], option)
+				}
+			},
+		},
+		{
+			tname: "namespace and max files",
+			input: `(environment) namespace = ci-runner
+(/etc/ccache.conf) max_files = 100000
+`,
+			check: func(t *testing.T, c *Configuration) {
+				assertStringFieldEquals(t, "Namespace", c.Namespace, "ci-runner")
+				assertIntFieldEquals(t, "MaxFiles", c.MaxFiles, 100000)
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			got, err := ParseConfiguration(tc.input)
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			tc.check(t, got)
+		})
+	}
+}
+
+func TestParseConfigurationInvalidRemoteStorage(t *testing.T) {
+	_, err := ParseConfiguration(`(environment) remote_storage = redis://s3cr3t@redis.example.com http://ci:s3cr3t@[::1
+`)
+
+	if !errors.Is(err, ErrRemoteStorageInvalid) {
+		t.Fatalf("want error %q, got %q", ErrRemoteStorageInvalid, err)
+	}
+
+	want := `configuration: invalid value: remote_storage: backend 1: remote storage: invalid backend`
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err)
+	}
+}
+
+func TestParseConfigurationInvalidValue(t *testing.T) {
+	_, err := ParseConfiguration(`(environment) direct_mode = maybe
+`)
+
+	if !errors.Is(err, ErrConfigurationValueInvalid) {
+		t.Fatalf("want error %q, got %q", ErrConfigurationValueInvalid, err)
+	}
+
+	want := `configuration: invalid value: direct_mode: "maybe": strconv.ParseBool: parsing "maybe": invalid syntax`
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err)
+	}
+}
+
+func TestParseConfigurationWithModeLenient(t *testing.T) {
+	input := `(environment) direct_mode = maybe
+(/etc/ccache.conf) max_size = 10G
+(environment) remote_storage = redis://s3cr3t@redis.example.com http://ci:s3cr3t@[::1
+`
+
+	got, warnings, err := ParseConfigurationWithMode(ParseModeLenient, input)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	assertBoolFieldEquals(t, "DirectMode", got.DirectMode, false)
+	assertIntFieldEquals(t, "MaxCacheSizeBytes", int64(got.MaxCacheSizeBytes), 10_000_000_000)
+	assertStringFieldEquals(t, "RemoteStorage", got.RemoteStorage, "")
+
+	wantEntries := []ConfigurationEntry{
+		{Key: "direct_mode", Value: "maybe", Origin: "environment"},
+		{Key: "max_size", Value: "10G", Origin: "/etc/ccache.conf"},
+		{Key: "remote_storage", Value: "xxxxx", Origin: "environment"},
+	}
+
+	if len(got.Entries) != len(wantEntries) {
+		t.Fatalf("want %d entries, got %d", len(wantEntries), len(got.Entries))
+	}
+
+	for i, want := range wantEntries {
+		if got.Entries[i] != want {
+			t.Errorf("want entry %v, got %v", want, got.Entries[i])
+		}
+	}
+
+	wantWarnings := []string{
+		`config: line 1: direct_mode: configuration: invalid value: strconv.ParseBool: parsing "maybe": invalid syntax`,
+		`config: line 3: remote_storage: configuration: invalid value: backend 1: remote storage: invalid backend`,
+	}
+
+	if len(warnings) != len(wantWarnings) {
+		t.Fatalf("want %d warnings, got %d: %q", len(wantWarnings), len(warnings), warnings)
+	}
+
+	for i, want := range wantWarnings {
+		if !errors.Is(warnings[i], ErrConfigurationValueInvalid) {
+			t.Errorf("want error %q, got %q", ErrConfigurationValueInvalid, warnings[i])
+		}
+
+		if warnings[i].Error() != want {
+			t.Errorf("want warning %q, got %q", want, warnings[i])
+		}
+	}
+}
+
+func TestParseConfigurationInvalidRemoteStorageAttribute(t *testing.T) {
+	input := `(environment) remote_storage = redis://s3cr3t@redis.example.com|read-only=maybe file:///mnt/cache|read-only
+`
+
+	_, err := ParseConfiguration(input)
+	if !errors.Is(err, ErrRemoteStorageAttributeInvalid) {
+		t.Fatalf("want error %q, got %q", ErrRemoteStorageAttributeInvalid, err)
+	}
+
+	got, warnings, err := ParseConfigurationWithMode(ParseModeLenient, input)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrRemoteStorageAttributeInvalid) {
+		t.Fatalf("want warning %q, got %q", ErrRemoteStorageAttributeInvalid, warnings)
+	}
+
+	want := "redis://xxxxx@redis.example.com|read-only=maybe file:///mnt/cache|read-only"
+
+	assertStringFieldEquals(t, "RemoteStorage", got.RemoteStorage, want)
+	assertStringFieldEquals(t, "Entries[0].Value", got.Entries[0].Value, want)
+
+	if len(got.RemoteStorageBackends) != 2 {
+		t.Fatalf("RemoteStorageBackends: want 2 backends, got %d", len(got.RemoteStorageBackends))
+	}
+
+	assertBoolFieldEquals(t, "RemoteStorageBackends[0].ReadOnly", got.RemoteStorageBackends[0].ReadOnly, false)
+	assertBoolFieldEquals(t, "RemoteStorageBackends[1].ReadOnly", got.RemoteStorageBackends[1].ReadOnly, true)
+}
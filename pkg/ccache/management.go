@@ -0,0 +1,332 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+var (
+	ErrEvictionAgeInvalid   error = errors.New("command: eviction age must be at least one second")
+	ErrOperationUnsupported error = errors.New("command: unsupported by this ccache version")
+	ErrOutputInvalid        error = errors.New("command: invalid output")
+)
+
+var (
+	maxSizeRegex         = regexp.MustCompile(`(?m)^Set cache size limit to (.+)$`)
+	unsetMaxSizeRegex    = regexp.MustCompile(`(?m)^Unset cache size limit$`)
+	recompressLineRegex  = regexp.MustCompile(`^\s*(?:-\s*)?([A-Za-z ]+):\s*(.*)$`)
+	recompressSizeRegex  = regexp.MustCompile(`^([+-]?)\s*(\d+(?:\.\d+)?\s*(?:[kKMGT]i?)?(?:B|bytes))`)
+	recompressRatioRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*x`)
+)
+
+// UnsupportedOperationError is returned when an operation is not supported by
+// the version of ccache.
+type UnsupportedOperationError struct {
+	// Command-line option of the operation, e.g. "--recompress".
+	Operation string
+
+	// Version of ccache.
+	Version string
+
+	// First version of ccache supporting the operation.
+	MinVersion string
+}
+
+// Error describes the operation and the required version of ccache.
+func (e *UnsupportedOperationError) Error() string {
+	return fmt.Sprintf("command: %s is unsupported by ccache %s (requires ccache >= %s)", e.Operation, e.Version, e.MinVersion)
+}
+
+// Unwrap returns ErrOperationUnsupported.
+func (e *UnsupportedOperationError) Unwrap() error {
+	return ErrOperationUnsupported
+}
+
+// EvictionResult summarizes the files removed from the cache by a cleanup,
+// clear or eviction operation.
+//
+// As ccache does not report the files it removes, the result is computed from
+// the statistics before and after the operation.
+type EvictionResult struct {
+	FilesRemoved int64             `json:"files_removed"`
+	BytesFreed   units.MetricBytes `json:"bytes_freed"`
+}
+
+// RecompressResult summarizes the result of `ccache --recompress`.
+type RecompressResult struct {
+	// Size of the cached data, uncompressed.
+	OriginalSize units.MetricBytes `json:"original_size"`
+
+	OldCompressedSize   units.MetricBytes `json:"old_compressed_size"`
+	OldCompressionRatio float64           `json:"old_compression_ratio"`
+	NewCompressedSize   units.MetricBytes `json:"new_compressed_size"`
+	NewCompressionRatio float64           `json:"new_compression_ratio"`
+
+	// Difference between the new and old compressed sizes, in bytes; negative
+	// when space was saved.
+	SizeChange int64 `json:"size_change"`
+}
+
+// requireCommand returns an UnsupportedOperationError if the version of ccache
+// does not provide the given command.
+func (w *Wrapper) requireCommand(ctx context.Context, command string) error {
+	state, err := w.state(ctx)
+	if err != nil {
+		return err
+	}
+
+	if state.capabilities.HasCommand(command) {
+		return nil
+	}
+
+	err = &UnsupportedOperationError{
+		Operation: command,
+		Version:   state.versionStr,
+	}
+
+	if capability, ok := capabilityFor(CapabilityKindCommand, command); ok && capability.From != nil {
+		err.(*UnsupportedOperationError).MinVersion = capability.From.Original()
+	}
+
+	return err
+}
+
+// ZeroStatistics resets the ccache statistics.
+func (w *Wrapper) ZeroStatistics(ctx context.Context) error {
+	_, err := w.command.ZeroStats(ctx)
+
+	return err
+}
+
+// Cleanup removes files from the cache until it fits the configured limits.
+func (w *Wrapper) Cleanup(ctx context.Context) (*EvictionResult, error) {
+	return w.evict(ctx, w.command.Cleanup)
+}
+
+// Clear removes all cached files.
+func (w *Wrapper) Clear(ctx context.Context) (*EvictionResult, error) {
+	return w.evict(ctx, w.command.Clear)
+}
+
+// EvictOlderThan removes cached files that have not been used for the given
+// duration, rounded down to the second.
+//
+// Ages under one second are rejected, as ccache would evict the whole cache.
+//
+// Available since ccache 4.4
+func (w *Wrapper) EvictOlderThan(ctx context.Context, age time.Duration) (*EvictionResult, error) {
+	if age < time.Second {
+		return &EvictionResult{}, fmt.Errorf("%w: %s", ErrEvictionAgeInvalid, age)
+	}
+
+	if err := w.requireCommand(ctx, CommandEvictOlderThan); err != nil {
+		return &EvictionResult{}, err
+	}
+
+	return w.evict(ctx, func(ctx context.Context) (string, error) {
+		return w.command.EvictOlderThan(ctx, fmt.Sprintf("%ds", int64(age/time.Second)))
+	})
+}
+
+// evict runs an operation removing files from the cache, and compares the
+// statistics before and after it.
+func (w *Wrapper) evict(ctx context.Context, operation func(ctx context.Context) (string, error)) (*EvictionResult, error) {
+	before, _, err := w.StatisticsWithMode(ctx, ParseModeLenient)
+	if err != nil {
+		return &EvictionResult{}, err
+	}
+
+	if _, err := operation(ctx); err != nil {
+		return &EvictionResult{}, err
+	}
+
+	after, _, err := w.StatisticsWithMode(ctx, ParseModeLenient)
+	if err != nil {
+		return &EvictionResult{}, err
+	}
+
+	return &EvictionResult{
+		FilesRemoved: max(before.FilesInCache-after.FilesInCache, 0),
+		BytesFreed:   max(before.CacheSizeBytes-after.CacheSizeBytes, 0),
+	}, nil
+}
+
+// Recompress recompresses the cache with the given compression level, either
+// an integer or "uncompressed".
+//
+// Available since ccache 4.0
+func (w *Wrapper) Recompress(ctx context.Context, level string) (*RecompressResult, error) {
+	if err := w.requireCommand(ctx, CommandRecompress); err != nil {
+		return &RecompressResult{}, err
+	}
+
+	out, err := w.command.Recompress(ctx, level)
+	if err != nil {
+		return &RecompressResult{}, err
+	}
+
+	return ParseRecompressResult(out)
+}
+
+// SetConfig sets a configuration setting in the primary configuration file.
+func (w *Wrapper) SetConfig(ctx context.Context, key string, value string) error {
+	_, err := w.command.SetConfig(ctx, key, value)
+
+	return err
+}
+
+// SetMaxSize sets the maximum size of the cache, e.g. "5G" or "500Mi", and
+// returns the limit reported by ccache; 0 means no limit.
+//
+// The size is checked with ParseSize before invoking ccache.
+func (w *Wrapper) SetMaxSize(ctx context.Context, size string) (units.MetricBytes, error) {
+	if _, err := ParseSize(size); err != nil {
+		return 0, err
+	}
+
+	if err := w.requireCommand(ctx, CommandMaxSize); err != nil {
+		return 0, err
+	}
+
+	out, err := w.command.SetMaxSize(ctx, size)
+	if err != nil {
+		return 0, err
+	}
+
+	return ParseMaxSizeResult(out)
+}
+
+// ParseMaxSizeResult reads the cache size limit printed by
+// `ccache --max-size`, e.g. "Set cache size limit to 5.0 GB".
+func ParseMaxSizeResult(text string) (units.MetricBytes, error) {
+	if err := checkOutputSize(text); err != nil {
+		return 0, err
+	}
+
+	if unsetMaxSizeRegex.MatchString(text) {
+		return 0, nil
+	}
+
+	matches := maxSizeRegex.FindStringSubmatch(text)
+	if len(matches) != 2 {
+		return 0, fmt.Errorf("%w: %q", ErrOutputInvalid, text)
+	}
+
+	return ParseSize(strings.TrimSpace(matches[1]))
+}
+
+// ParseRecompressResult reads the summary printed by `ccache --recompress`
+// (ccache >= 4.0).
+func ParseRecompressResult(text string) (*RecompressResult, error) {
+	result := &RecompressResult{}
+	found := false
+
+	var section string
+
+	scanner := newOutputScanner(text)
+
+	for scanner.Scan() {
+		matches := recompressLineRegex.FindStringSubmatch(scanner.Text())
+		if len(matches) != 3 {
+			continue
+		}
+
+		label := strings.TrimSpace(matches[1])
+		value := strings.TrimSpace(matches[2])
+
+		var err error
+
+		switch label {
+		case "Original data":
+			result.OriginalSize, _, err = parseRecompressSize(value)
+
+		case "Old compressed data":
+			result.OldCompressedSize, _, err = parseRecompressSize(value)
+
+		case "New compressed data":
+			result.NewCompressedSize, _, err = parseRecompressSize(value)
+
+		case "Compression ratio":
+			var ratio float64
+			ratio, err = parseRecompressRatio(value)
+
+			switch section {
+			case "Old compressed data":
+				result.OldCompressionRatio = ratio
+			case "New compressed data":
+				result.NewCompressionRatio = ratio
+			}
+
+		case "Size change":
+			var size units.MetricBytes
+			var negative bool
+
+			size, negative, err = parseRecompressSize(value)
+
+			result.SizeChange = int64(size)
+			if negative {
+				result.SizeChange = -result.SizeChange
+			}
+
+		default:
+			continue
+		}
+
+		if err != nil {
+			return &RecompressResult{}, err
+		}
+
+		if label != "Compression ratio" {
+			section = label
+		}
+
+		found = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return &RecompressResult{}, err
+	}
+
+	if !found {
+		return &RecompressResult{}, fmt.Errorf("%w: %q", ErrOutputInvalid, text)
+	}
+
+	return result, nil
+}
+
+// parseRecompressSize parses a size printed by `ccache --recompress`, with an
+// optional sign, e.g. "-3.0 MB".
+func parseRecompressSize(value string) (units.MetricBytes, bool, error) {
+	matches := recompressSizeRegex.FindStringSubmatch(value)
+	if len(matches) != 3 {
+		return 0, false, fmt.Errorf("%w: %q", ErrOutputInvalid, value)
+	}
+
+	size, err := ParseSize(matches[2])
+	if err != nil {
+		return 0, false, err
+	}
+
+	return size, matches[1] == "-", nil
+}
+
+// parseRecompressRatio parses a compression ratio printed by
+// `ccache --recompress`, e.g. "5.285 x  (81.1% space savings)".
+func parseRecompressRatio(value string) (float64, error) {
+	matches := recompressRatioRegex.FindStringSubmatch(value)
+	if len(matches) != 2 {
+		return 0, fmt.Errorf("%w: %q", ErrOutputInvalid, value)
+	}
+
+	return strconv.ParseFloat(matches[1], 64)
+}
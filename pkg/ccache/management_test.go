@@ -0,0 +1,406 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+func TestWrapperEviction(t *testing.T) {
+	cases := []struct {
+		tname          string
+		run            func(w *Wrapper) (*EvictionResult, error)
+		wantOperation  string
+		wantStatsAfter string
+		wantResult     EvictionResult
+	}{
+		{
+			tname: "cleanup",
+			run: func(w *Wrapper) (*EvictionResult, error) {
+				return w.Cleanup(context.Background())
+			},
+			wantOperation:  "--cleanup",
+			wantStatsAfter: "files_in_cache\t300\ncache_size_kibibyte\t1024\n",
+			wantResult: EvictionResult{
+				FilesRemoved: 50,
+				BytesFreed:   units.MetricBytes(1024 * 1024),
+			},
+		},
+		{
+			tname: "clear",
+			run: func(w *Wrapper) (*EvictionResult, error) {
+				return w.Clear(context.Background())
+			},
+			wantOperation:  "--clear",
+			wantStatsAfter: "files_in_cache\t0\ncache_size_kibibyte\t0\n",
+			wantResult: EvictionResult{
+				FilesRemoved: 350,
+				BytesFreed:   units.MetricBytes(2048 * 1024),
+			},
+		},
+		{
+			tname: "evict older than",
+			run: func(w *Wrapper) (*EvictionResult, error) {
+				return w.EvictOlderThan(context.Background(), 36*time.Hour+500*time.Millisecond)
+			},
+			wantOperation:  "--evict-older-than 129600s",
+			wantStatsAfter: "files_in_cache\t349\ncache_size_kibibyte\t2040\n",
+			wantResult: EvictionResult{
+				FilesRemoved: 1,
+				BytesFreed:   units.MetricBytes(8 * 1024),
+			},
+		},
+		{
+			tname: "no file removed",
+			run: func(w *Wrapper) (*EvictionResult, error) {
+				return w.Cleanup(context.Background())
+			},
+			wantOperation:  "--cleanup",
+			wantStatsAfter: "files_in_cache\t351\ncache_size_kibibyte\t2049\n",
+			wantResult:     EvictionResult{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			cmd := &fakeCommand{
+				version:                  "ccache version 4.9.1",
+				printStats:               "files_in_cache\t350\ncache_size_kibibyte\t2048\n",
+				printStatsAfterOperation: tc.wantStatsAfter,
+			}
+
+			got, err := tc.run(newTestWrapper(t, cmd))
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			if len(cmd.operations) != 1 || cmd.operations[0] != tc.wantOperation {
+				t.Errorf("want operation %q, got %q", tc.wantOperation, cmd.operations)
+			}
+
+			assertIntFieldEquals(t, "FilesRemoved", got.FilesRemoved, tc.wantResult.FilesRemoved)
+			assertMetricByteFieldEquals(t, "BytesFreed", got.BytesFreed, tc.wantResult.BytesFreed)
+		})
+	}
+}
+
+func TestWrapperOperations(t *testing.T) {
+	cmd := &fakeCommand{
+		version:         "ccache version 4.9.1",
+		operationOutput: "Set cache size limit to 5.0 GB\n",
+	}
+
+	w := newTestWrapper(t, cmd)
+
+	if err := w.ZeroStatistics(context.Background()); err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if err := w.SetConfig(context.Background(), "compression_level", "5"); err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	maxSize, err := w.SetMaxSize(context.Background(), "5G")
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	assertMetricByteFieldEquals(t, "MaxSize", maxSize, units.MetricBytes(5000000000))
+
+	wantOperations := []string{
+		"--zero-stats",
+		"--set-config=compression_level=5",
+		"--max-size 5G",
+	}
+
+	if len(cmd.operations) != len(wantOperations) {
+		t.Fatalf("want operations %q, got %q", wantOperations, cmd.operations)
+	}
+
+	for i, want := range wantOperations {
+		if cmd.operations[i] != want {
+			t.Errorf("want operation %q, got %q", want, cmd.operations[i])
+		}
+	}
+}
+
+func TestWrapperOperationsUnsupported(t *testing.T) {
+	cases := []struct {
+		tname          string
+		version        string
+		run            func(w *Wrapper) error
+		wantOperation  string
+		wantMinVersion string
+	}{
+		{
+			tname:   "evict older than with ccache 4.2",
+			version: "ccache version 4.2",
+			run: func(w *Wrapper) error {
+				_, err := w.EvictOlderThan(context.Background(), time.Hour)
+				return err
+			},
+			wantOperation:  "--evict-older-than",
+			wantMinVersion: "4.4",
+		},
+		{
+			tname:   "recompress with ccache 3.7.7",
+			version: "ccache version 3.7.7",
+			run: func(w *Wrapper) error {
+				_, err := w.Recompress(context.Background(), "5")
+				return err
+			},
+			wantOperation:  "--recompress",
+			wantMinVersion: "4.0",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			cmd := &fakeCommand{
+				version: tc.version,
+			}
+
+			err := tc.run(newTestWrapper(t, cmd))
+
+			if !errors.Is(err, ErrOperationUnsupported) {
+				t.Fatalf("want error %q, got %q", ErrOperationUnsupported, err)
+			}
+
+			var unsupportedErr *UnsupportedOperationError
+			if !errors.As(err, &unsupportedErr) {
+				t.Fatalf("want an UnsupportedOperationError, got %T", err)
+			}
+
+			if unsupportedErr.Operation != tc.wantOperation {
+				t.Errorf("want operation %q, got %q", tc.wantOperation, unsupportedErr.Operation)
+			}
+
+			if unsupportedErr.MinVersion != tc.wantMinVersion {
+				t.Errorf("want minimum version %q, got %q", tc.wantMinVersion, unsupportedErr.MinVersion)
+			}
+
+			if len(cmd.operations) != 0 {
+				t.Errorf("want no operation, got %q", cmd.operations)
+			}
+		})
+	}
+}
+
+func TestWrapperOperationsInvalidInput(t *testing.T) {
+	cases := []struct {
+		tname   string
+		run     func(w *Wrapper) error
+		wantErr error
+	}{
+		{
+			tname: "evict older than 0",
+			run: func(w *Wrapper) error {
+				_, err := w.EvictOlderThan(context.Background(), 0)
+				return err
+			},
+			wantErr: ErrEvictionAgeInvalid,
+		},
+		{
+			tname: "evict older than 500ms",
+			run: func(w *Wrapper) error {
+				_, err := w.EvictOlderThan(context.Background(), 500*time.Millisecond)
+				return err
+			},
+			wantErr: ErrEvictionAgeInvalid,
+		},
+		{
+			tname: "evict older than a negative age",
+			run: func(w *Wrapper) error {
+				_, err := w.EvictOlderThan(context.Background(), -time.Hour)
+				return err
+			},
+			wantErr: ErrEvictionAgeInvalid,
+		},
+		{
+			tname: "set max size to an invalid size",
+			run: func(w *Wrapper) error {
+				_, err := w.SetMaxSize(context.Background(), "5 parsecs")
+				return err
+			},
+			wantErr: ErrSizeInvalid,
+		},
+		{
+			tname: "set max size to a negative size",
+			run: func(w *Wrapper) error {
+				_, err := w.SetMaxSize(context.Background(), "-5G")
+				return err
+			},
+			wantErr: ErrSizeInvalid,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			cmd := &fakeCommand{
+				version: "ccache version 4.9.1",
+			}
+
+			err := tc.run(newTestWrapper(t, cmd))
+
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("want error %q, got %q", tc.wantErr, err)
+			}
+
+			if len(cmd.operations) != 0 {
+				t.Errorf("want no operation, got %q", cmd.operations)
+			}
+		})
+	}
+}
+
+func TestParseMaxSizeResult(t *testing.T) {
+	cases := []struct {
+		tname   string
+		input   string
+		want    units.MetricBytes
+		wantErr error
+	}{
+		{
+			tname: "ccache 3.x",
+			input: "Set cache size limit to 5.0 GB\n",
+			want:  units.MetricBytes(5000000000),
+		},
+		{
+			tname: "ccache 4.x with a binary prefix",
+			input: "Set cache size limit to 500.0 MiB\n",
+			want:  units.MetricBytes(500 * 1024 * 1024),
+		},
+		{
+			tname: "no limit",
+			input: "Unset cache size limit\n",
+			want:  0,
+		},
+
+		// error cases
+		{
+			tname:   "unexpected output",
+			input:   "ccache: invalid size: 5X\n",
+			wantErr: ErrOutputInvalid,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			got, err := ParseMaxSizeResult(tc.input)
+
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("want error %q, got %q", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertMetricByteFieldEquals(t, "MaxSize", got, tc.want)
+		})
+	}
+}
+
+func TestParseRecompressResult(t *testing.T) {
+	cases := []struct {
+		tname   string
+		input   string
+		want    RecompressResult
+		wantErr error
+	}{
+		{
+			tname: "space saved",
+			input: `Original data:           53.4 MB
+Old compressed data:     10.1 MB (18.9% of original size)
+  - Compression ratio:  5.285 x  (81.1% space savings)
+New compressed data:      7.1 MB (13.3% of original size)
+  - Compression ratio:  7.519 x  (86.7% space savings)
+Size change:             -3.0 MB
+`,
+			want: RecompressResult{
+				OriginalSize:        units.MetricBytes(53400000),
+				OldCompressedSize:   units.MetricBytes(10100000),
+				OldCompressionRatio: 5.285,
+				NewCompressedSize:   units.MetricBytes(7100000),
+				NewCompressionRatio: 7.519,
+				SizeChange:          -3000000,
+			},
+		},
+		{
+			tname: "uncompressed",
+			input: `Original data:           53.4 MB
+Old compressed data:     10.1 MB (18.9% of original size)
+  - Compression ratio:  5.285 x  (81.1% space savings)
+New compressed data:     53.4 MB (100.0% of original size)
+  - Compression ratio:  1.000 x  ( 0.0% space savings)
+Size change:            +43.3 MB
+`,
+			want: RecompressResult{
+				OriginalSize:        units.MetricBytes(53400000),
+				OldCompressedSize:   units.MetricBytes(10100000),
+				OldCompressionRatio: 5.285,
+				NewCompressedSize:   units.MetricBytes(53400000),
+				NewCompressionRatio: 1,
+				SizeChange:          43300000,
+			},
+		},
+		{
+			tname: "empty cache",
+			input: `Original data:            0 bytes
+Old compressed data:      0 bytes (0.0% of original size)
+  - Compression ratio:  0.000 x  (0.0% space savings)
+New compressed data:      0 bytes (0.0% of original size)
+  - Compression ratio:  0.000 x  (0.0% space savings)
+Size change:              0 bytes
+`,
+			want: RecompressResult{},
+		},
+
+		// error cases
+		{
+			tname:   "unexpected output",
+			input:   "ccache: invalid compression level: \"max\"\n",
+			wantErr: ErrOutputInvalid,
+		},
+		{
+			tname:   "unexpected size",
+			input:   "Original data:           lots\n",
+			wantErr: ErrOutputInvalid,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			got, err := ParseRecompressResult(tc.input)
+
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("want error %q, got %q", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertMetricByteFieldEquals(t, "OriginalSize", got.OriginalSize, tc.want.OriginalSize)
+			assertMetricByteFieldEquals(t, "OldCompressedSize", got.OldCompressedSize, tc.want.OldCompressedSize)
+			assertFloatFieldAlmostEquals(t, "OldCompressionRatio", got.OldCompressionRatio, tc.want.OldCompressionRatio)
+			assertMetricByteFieldEquals(t, "NewCompressedSize", got.NewCompressedSize, tc.want.NewCompressedSize)
+			assertFloatFieldAlmostEquals(t, "NewCompressionRatio", got.NewCompressionRatio, tc.want.NewCompressionRatio)
+			assertIntFieldEquals(t, "SizeChange", got.SizeChange, tc.want.SizeChange)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Limits on the output of ccache commands.
+//
+// Parsers read the output of whatever binary is configured as ccache, and
+// reject outputs exceeding these limits rather than buffering them; actual
+// ccache outputs are a few kilobytes long.
+const (
+	// MaxOutputSize is the maximum size of an output, in bytes.
+	MaxOutputSize = 1 << 20
+
+	// MaxOutputLineLength is the maximum length of a line, in bytes, excluding
+	// the line terminator.
+	MaxOutputLineLength = 64 << 10
+
+	// MaxOutputRows is the maximum number of rows of an output: lines of text
+	// outputs, or entries of JSON objects.
+	MaxOutputRows = 4096
+)
+
+var (
+	ErrOutputTooLarge    error = errors.New("output: too large")
+	ErrOutputLineTooLong error = errors.New("output: line too long")
+	ErrOutputTooManyRows error = errors.New("output: too many rows")
+)
+
+var (
+	errOutputSizeExceeded = fmt.Errorf("%w: more than %d bytes", ErrOutputTooLarge, MaxOutputSize)
+)
+
+// checkOutputSize returns an error if the output exceeds MaxOutputSize.
+func checkOutputSize(text string) error {
+	if len(text) > MaxOutputSize {
+		return errOutputSizeExceeded
+	}
+
+	return nil
+}
+
+// checkOutputRows returns an error if the output has more than MaxOutputRows
+// rows.
+func checkOutputRows(rows int) error {
+	if rows > MaxOutputRows {
+		return fmt.Errorf("%w: more than %d", ErrOutputTooManyRows, MaxOutputRows)
+	}
+
+	return nil
+}
+
+// lineScanner reads an output line by line, as a bufio.Scanner does, and stops
+// with an error when it exceeds the output limits.
+type lineScanner struct {
+	scanner *bufio.Scanner
+	lines   int
+	size    int
+	err     error
+}
+
+// newLineScanner returns a lineScanner reading from r.
+func newLineScanner(r io.Reader) *lineScanner {
+	scanner := bufio.NewScanner(r)
+
+	// the buffer holds a line and its terminator
+	scanner.Buffer(make([]byte, 0, 4096), MaxOutputLineLength+1)
+
+	return &lineScanner{
+		scanner: scanner,
+	}
+}
+
+// newOutputScanner returns a lineScanner reading the given output.
+func newOutputScanner(text string) *lineScanner {
+	s := newLineScanner(strings.NewReader(text))
+	s.err = checkOutputSize(text)
+
+	return s
+}
+
+// Scan advances to the next line, and returns false when the output is
+// exhausted, cannot be read, or exceeds the output limits.
+func (s *lineScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	if !s.scanner.Scan() {
+		s.err = s.scanner.Err()
+
+		if errors.Is(s.err, bufio.ErrTooLong) {
+			s.err = fmt.Errorf("%w: line %d: more than %d bytes", ErrOutputLineTooLong, s.lines+1, MaxOutputLineLength)
+		}
+
+		return false
+	}
+
+	s.lines++
+	s.size += len(s.scanner.Bytes()) + 1
+
+	if s.size > MaxOutputSize {
+		s.err = errOutputSizeExceeded
+	} else {
+		s.err = checkOutputRows(s.lines)
+	}
+
+	return s.err == nil
+}
+
+// Text returns the current line, without its terminator.
+func (s *lineScanner) Text() string {
+	return s.scanner.Text()
+}
+
+// Err returns the error that stopped the scanner, if any.
+func (s *lineScanner) Err() error {
+	return s.err
+}
+
+// outputBuffer captures the output of a command up to MaxOutputSize bytes.
+//
+// Further output is discarded rather than rejected, so that the command does
+// not block on a full pipe.
+type outputBuffer struct {
+	buffer   bytes.Buffer
+	exceeded bool
+}
+
+// Write appends p to the buffer, or discards it if the buffer would exceed
+// MaxOutputSize.
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	if b.exceeded || b.buffer.Len()+len(p) > MaxOutputSize {
+		b.exceeded = true
+		return len(p), nil
+	}
+
+	return b.buffer.Write(p)
+}
+
+// Output returns the captured output, or an error if it exceeded
+// MaxOutputSize.
+func (b *outputBuffer) Output() (string, error) {
+	if b.exceeded {
+		return "", errOutputSizeExceeded
+	}
+
+	return b.buffer.String(), nil
+}
@@ -0,0 +1,171 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseOutputLimits(t *testing.T) {
+	parsers := []struct {
+		tname string
+		parse func(text string) error
+	}{
+		{
+			tname: "configuration",
+			parse: func(text string) error {
+				_, err := ParseConfiguration(text)
+				return err
+			},
+		},
+		{
+			tname: "tsv statistics",
+			parse: func(text string) error {
+				_, err := ParseTSVStatistics(text)
+				return err
+			},
+		},
+		{
+			tname: "pre-3.7 statistics",
+			parse: func(text string) error {
+				_, err := ParsePre37Statistics(text)
+				return err
+			},
+		},
+		{
+			tname: "human-readable statistics",
+			parse: func(text string) error {
+				_, err := ParseHumanReadableStatistics(text)
+				return err
+			},
+		},
+		{
+			tname: "lenient tsv statistics",
+			parse: func(text string) error {
+				_, _, err := ParseStatisticsWithMode(StatisticsFormatTSV, ParseModeLenient, text)
+				return err
+			},
+		},
+		{
+			tname: "version information",
+			parse: func(text string) error {
+				_, err := ParseVersionInfo("ccache version 4.10.2\n" + text)
+				return err
+			},
+		},
+		{
+			tname: "recompress result",
+			parse: func(text string) error {
+				_, err := ParseRecompressResult(text)
+				return err
+			},
+		},
+	}
+
+	cases := []struct {
+		tname   string
+		input   string
+		wantErr error
+	}{
+		{
+			tname:   "line too long",
+			input:   "cache_miss\t" + strings.Repeat("1", MaxOutputLineLength) + "\n",
+			wantErr: ErrOutputLineTooLong,
+		},
+		{
+			tname:   "too many rows",
+			input:   strings.Repeat("cache_miss\t1\n", MaxOutputRows+1),
+			wantErr: ErrOutputTooManyRows,
+		},
+		{
+			tname:   "too large",
+			input:   strings.Repeat(strings.Repeat("1", MaxOutputLineLength-1)+"\n", MaxOutputSize/MaxOutputLineLength+1),
+			wantErr: ErrOutputTooLarge,
+		},
+	}
+
+	for _, parser := range parsers {
+		t.Run(parser.tname, func(t *testing.T) {
+			for _, tc := range cases {
+				t.Run(tc.tname, func(t *testing.T) {
+					err := parser.parse(tc.input)
+					if !errors.Is(err, tc.wantErr) {
+						t.Errorf("want error %q, got %q", tc.wantErr, err)
+					}
+				})
+			}
+
+			t.Run("within limits", func(t *testing.T) {
+				// the version information parser reads an additional line
+				input := strings.Repeat("cache_miss\t1\n", MaxOutputRows-2) + strings.Repeat("1", MaxOutputLineLength)
+
+				if err := parser.parse(input); errors.Is(err, ErrOutputLineTooLong) || errors.Is(err, ErrOutputTooManyRows) {
+					t.Errorf("want no output limit error, got %q", err)
+				}
+			})
+		})
+	}
+}
+
+func TestParseJSONOutputLimits(t *testing.T) {
+	cases := []struct {
+		tname   string
+		format  StatisticsFormat
+		input   string
+		wantErr error
+	}{
+		{
+			tname:   "ccache, too many rows",
+			format:  StatisticsFormatJSON,
+			input:   jsonObjectWithKeys(MaxOutputRows + 1),
+			wantErr: ErrOutputTooManyRows,
+		},
+		{
+			tname:   "ccache, too large",
+			format:  StatisticsFormatJSON,
+			input:   `{"cache_miss": 1, "padding": "` + strings.Repeat("x", MaxOutputSize) + `"}`,
+			wantErr: ErrOutputTooLarge,
+		},
+		{
+			tname:   "statistics, too many rows",
+			format:  StatisticsFormatStatistics,
+			input:   `{"counters": ` + jsonObjectWithKeys(MaxOutputRows+1) + `}`,
+			wantErr: ErrOutputTooManyRows,
+		},
+		{
+			tname:   "statistics, too large",
+			format:  StatisticsFormatStatistics,
+			input:   `{"cache_directory": "` + strings.Repeat("x", MaxOutputSize) + `"}`,
+			wantErr: ErrOutputTooLarge,
+		},
+		{
+			tname:   "detection, too large",
+			input:   `{"cache_miss": 1, "padding": "` + strings.Repeat("x", MaxOutputSize) + `"}`,
+			wantErr: ErrOutputTooLarge,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			_, _, err := ParseStatisticsWithMode(tc.format, ParseModeLenient, tc.input)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("want error %q, got %q", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// jsonObjectWithKeys returns a JSON object with the given number of keys.
+func jsonObjectWithKeys(count int) string {
+	keys := make([]string, 0, count)
+
+	for i := range count {
+		keys = append(keys, fmt.Sprintf(`"counter_%d": 1`, i))
+	}
+
+	return "{" + strings.Join(keys, ", ") + "}"
+}
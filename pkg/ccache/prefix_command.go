@@ -0,0 +1,68 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+var (
+	ErrCommandPrefixEmpty error = errors.New("command: empty prefix")
+)
+
+var _ Command = &PrefixCommand{}
+
+// PrefixCommand runs ccache commands through a prefix command line, e.g. to
+// run ccache as another user with `sudo -u builder` or `runuser -u builder --`,
+// or in another mount namespace or root directory with `nsenter -t <PID> -m`
+// or `chroot <DIR>`.
+//
+// The cache directory and configuration file are passed as options with
+// ccache >= 4.4, and as environment variables otherwise; note that sudo resets
+// the environment unless told to preserve these variables, e.g. with
+// `sudo --preserve-env=CCACHE_DIR,CCACHE_CONFIGPATH`.
+type PrefixCommand struct {
+	*LocalCommand
+}
+
+// NewPrefixCommand ensures the ccache executable can be invoked through the
+// prefix command line, and returns an initialized PrefixCommand.
+//
+// The path of the ccache executable is resolved by the prefix command, e.g.
+// inside the root directory for chroot.
+func NewPrefixCommand(ctx context.Context, prefix []string, path string, options ...LocalCommandOption) (*PrefixCommand, error) {
+	if len(prefix) == 0 {
+		return &PrefixCommand{}, ErrCommandPrefixEmpty
+	}
+
+	c := &LocalCommand{
+		path:        path,
+		prefix:      slices.Clone(prefix),
+		environment: DefaultEnvironment,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	if err := c.init(ctx); err != nil {
+		return &PrefixCommand{}, err
+	}
+
+	return &PrefixCommand{LocalCommand: c}, nil
+}
+
+// BinaryIdentity returns ErrBinaryIdentityUnavailable, as the ccache
+// executable is resolved by the prefix command, e.g. in another root
+// directory or mount namespace.
+func (c *PrefixCommand) BinaryIdentity() (BinaryIdentity, error) {
+	return BinaryIdentity{}, ErrBinaryIdentityUnavailable
+}
+
+// Prefix returns the prefix command line.
+func (c *PrefixCommand) Prefix() []string {
+	return slices.Clone(c.prefix)
+}
@@ -0,0 +1,178 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// redactedValue replaces secrets, as done by url.URL.Redacted
+	redactedValue = "xxxxx"
+)
+
+var (
+	ErrRemoteStorageInvalid          error = errors.New("remote storage: invalid backend")
+	ErrRemoteStorageAttributeInvalid error = errors.New("remote storage: invalid attribute")
+)
+
+// sensitiveRemoteStorageAttributes lists the attributes whose value must not
+// be disclosed.
+var sensitiveRemoteStorageAttributes = map[string]bool{
+	"bearer-token": true,
+	"header":       true,
+}
+
+// RemoteStorageAttribute represents an attribute of a remote storage backend,
+// e.g. "read-only=true".
+type RemoteStorageAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// RemoteStorageBackend represents a remote storage backend, as configured with
+// the `remote_storage` setting (ccache >= 4.8), or the `secondary_storage`
+// setting (ccache 4.4 to 4.7).
+//
+// Credentials and tokens are redacted.
+//
+// See https://ccache.dev/manual/latest.html#_remote_storage_backends
+type RemoteStorageBackend struct {
+	URL        string                   `json:"url"`
+	Scheme     string                   `json:"scheme"`
+	Host       string                   `json:"host"`
+	ReadOnly   bool                     `json:"read_only"`
+	Shards     string                   `json:"shards,omitempty"`
+	Attributes []RemoteStorageAttribute `json:"attributes,omitempty"`
+}
+
+// ParseRemoteStorage parses a space-separated list of remote storage backends.
+//
+// If attributes have invalid values, all backends are returned along with an
+// error wrapping ErrRemoteStorageAttributeInvalid.
+//
+// Error messages do not contain the backend specification, as it may contain
+// credentials.
+func ParseRemoteStorage(text string) ([]RemoteStorageBackend, error) {
+	backends := []RemoteStorageBackend{}
+
+	var attributeErrs []error
+
+	for index, spec := range strings.Fields(text) {
+		backend, err := ParseRemoteStorageBackend(spec)
+		if errors.Is(err, ErrRemoteStorageAttributeInvalid) {
+			attributeErrs = append(attributeErrs, fmt.Errorf("backend %d: %w", index, err))
+		} else if err != nil {
+			return []RemoteStorageBackend{}, fmt.Errorf("backend %d: %w", index, err)
+		}
+
+		backends = append(backends, backend)
+	}
+
+	return backends, errors.Join(attributeErrs...)
+}
+
+// ParseRemoteStorageBackend parses a remote storage backend specification,
+// formatted as a URL optionally followed by "|attribute=value" pairs.
+//
+// A "read-only" attribute with no value enables the read-only mode. If it has
+// a value that is not a boolean, the backend is returned along with an error
+// wrapping ErrRemoteStorageAttributeInvalid.
+func ParseRemoteStorageBackend(spec string) (RemoteStorageBackend, error) {
+	fields := strings.Split(spec, "|")
+
+	// opaque URLs are rejected, as ccache expects absolute paths for local
+	// resources, e.g. "file:/mnt/cache", and it is most likely a host with no
+	// scheme, e.g. "redis.example.com:6379"
+	u, err := url.Parse(fields[0])
+	if err != nil || u.Scheme == "" || u.Opaque != "" {
+		return RemoteStorageBackend{}, ErrRemoteStorageInvalid
+	}
+
+	backend := RemoteStorageBackend{
+		URL:    fields[0],
+		Scheme: u.Scheme,
+		Host:   u.Host,
+	}
+
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), redactedValue)
+		} else if strings.HasPrefix(u.Scheme, "redis") {
+			// redis://PASSWORD@HOST
+			u.User = url.User(redactedValue)
+		}
+
+		backend.URL = u.String()
+	}
+
+	var attributeErr error
+
+	for _, field := range fields[1:] {
+		key, value, hasValue := strings.Cut(field, "=")
+
+		switch key {
+		case "read-only":
+			if !hasValue {
+				backend.ReadOnly = true
+				break
+			}
+
+			readOnly, err := strconv.ParseBool(value)
+			if err != nil {
+				attributeErr = fmt.Errorf("%w: read-only: %q", ErrRemoteStorageAttributeInvalid, value)
+				break
+			}
+			backend.ReadOnly = readOnly
+
+		case "shards":
+			backend.Shards = value
+		}
+
+		if sensitiveRemoteStorageAttributes[key] {
+			value = redactedValue
+		}
+
+		backend.Attributes = append(backend.Attributes, RemoteStorageAttribute{
+			Key:   key,
+			Value: value,
+		})
+	}
+
+	return backend, attributeErr
+}
+
+// String returns the redacted specification of the backend.
+func (b RemoteStorageBackend) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(b.URL)
+
+	for _, attribute := range b.Attributes {
+		sb.WriteString("|" + attribute.Key)
+
+		// attributes with no value, e.g. "read-only"
+		if attribute.Value != "" {
+			sb.WriteString("=" + attribute.Value)
+		}
+	}
+
+	return sb.String()
+}
+
+// formatRemoteStorage returns the redacted, space-separated list of remote
+// storage backends.
+func formatRemoteStorage(backends []RemoteStorageBackend) string {
+	specs := make([]string, len(backends))
+
+	for index, backend := range backends {
+		specs[index] = backend.String()
+	}
+
+	return strings.Join(specs, " ")
+}
@@ -0,0 +1,340 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	replayConfigFileName  = "config"
+	replayVersionFileName = "version"
+)
+
+var (
+	ErrReplayDirectoryInvalid error = errors.New("replay: not a directory")
+	ErrReplayOutputMissing    error = errors.New("replay: missing output")
+	ErrReplayReadOnly         error = errors.New("replay: read-only command")
+	ErrReplaySnapshotsMissing error = errors.New("replay: no snapshot found")
+)
+
+var (
+	// version of ccache in the name of a fixture directory, e.g.
+	// "debian-12-ccache-4.7.5"
+	replayDirectoryVersionRegex = regexp.MustCompile(`ccache-(\d+(?:\.\d+)*)`)
+
+	// names of the snapshots of a fixture directory, in the order in which they
+	// are replayed
+	replaySnapshotNames = []string{"empty", "firstbuild", "secondbuild"}
+)
+
+var _ Command = &ReplayCommand{}
+
+// replaySnapshot holds the statistics printed by ccache at a given time; empty
+// outputs were not captured.
+type replaySnapshot struct {
+	name string
+
+	// `ccache --show-stats`
+	showStats string
+
+	// `ccache --print-stats`
+	printStats string
+
+	// `ccache --print-stats --format=json`
+	printStatsJSON string
+}
+
+// ReplayCommand replays ccache outputs captured in a fixture directory, e.g.
+// to develop dashboards and alerting rules without a real cache.
+//
+// A fixture directory holds snapshots of the statistics, replayed in order:
+//
+//   - empty, firstbuild, secondbuild: output of `ccache --show-stats`
+//   - empty.tsv, firstbuild.tsv, secondbuild.tsv: output of `ccache --print-stats`
+//   - empty.json, firstbuild.json, secondbuild.json: output of
+//     `ccache --print-stats --format=json`
+//
+// and optionally:
+//
+//   - config: output of `ccache --show-config`
+//   - version: output of `ccache --version`; if missing, the version is read
+//     from the name of the directory, e.g. "debian-12-ccache-4.7.5"
+//
+// Snapshots are replayed in a loop, so that counters are reset after the last
+// snapshot, as if statistics were zeroed. Management commands are not
+// supported.
+//
+// A ReplayCommand is safe for concurrent use.
+type ReplayCommand struct {
+	version   string
+	config    string
+	snapshots []replaySnapshot
+
+	// clock-based replay
+	interval time.Duration
+	now      func() time.Time
+	start    time.Time
+
+	mu sync.Mutex
+
+	// snapshot replayed by the next call, for call-based replay
+	next int
+}
+
+// ReplayOption configures a ReplayCommand.
+type ReplayOption func(*ReplayCommand)
+
+// WithReplayInterval advances to the next snapshot every interval, rather than
+// on every statistics command.
+func WithReplayInterval(interval time.Duration) ReplayOption {
+	return func(c *ReplayCommand) {
+		c.interval = interval
+	}
+}
+
+// WithReplayClock sets the clock used to advance through snapshots with
+// WithReplayInterval.
+func WithReplayClock(now func() time.Time) ReplayOption {
+	return func(c *ReplayCommand) {
+		c.now = now
+	}
+}
+
+// WithReplayVersion sets the version of ccache, e.g. "4.9.1", overriding the
+// version found in the fixture directory.
+func WithReplayVersion(version string) ReplayOption {
+	return func(c *ReplayCommand) {
+		c.version = "ccache version " + version + "\n"
+	}
+}
+
+// NewReplayCommand loads the snapshots stored in a fixture directory, and
+// returns a ReplayCommand.
+func NewReplayCommand(dir string, options ...ReplayOption) (*ReplayCommand, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return &ReplayCommand{}, err
+	}
+
+	if !info.IsDir() {
+		return &ReplayCommand{}, fmt.Errorf("%w: %s", ErrReplayDirectoryInvalid, dir)
+	}
+
+	c := &ReplayCommand{
+		now: time.Now,
+	}
+
+	for _, name := range replaySnapshotNames {
+		snapshot := replaySnapshot{name: name}
+
+		outputs := []struct {
+			fileName string
+			output   *string
+		}{
+			{fileName: name, output: &snapshot.showStats},
+			{fileName: name + ".tsv", output: &snapshot.printStats},
+			{fileName: name + ".json", output: &snapshot.printStatsJSON},
+		}
+
+		found := false
+
+		for _, o := range outputs {
+			content, err := readReplayFile(dir, o.fileName)
+			if err != nil {
+				return &ReplayCommand{}, err
+			}
+
+			if content != "" {
+				*o.output = content
+				found = true
+			}
+		}
+
+		if found {
+			c.snapshots = append(c.snapshots, snapshot)
+		}
+	}
+
+	if len(c.snapshots) == 0 {
+		return &ReplayCommand{}, fmt.Errorf("%w: %s", ErrReplaySnapshotsMissing, dir)
+	}
+
+	if c.config, err = readReplayFile(dir, replayConfigFileName); err != nil {
+		return &ReplayCommand{}, err
+	}
+
+	if c.version, err = readReplayFile(dir, replayVersionFileName); err != nil {
+		return &ReplayCommand{}, err
+	}
+
+	if c.version == "" {
+		if matches := replayDirectoryVersionRegex.FindStringSubmatch(filepath.Base(dir)); len(matches) == 2 {
+			c.version = "ccache version " + matches[1] + "\n"
+		}
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	if c.version == "" {
+		return &ReplayCommand{}, fmt.Errorf("%w: %s", ErrVersionMissing, dir)
+	}
+
+	c.start = c.now()
+
+	return c, nil
+}
+
+// readReplayFile returns the content of a file of a fixture directory, or an
+// empty string if it does not exist.
+func readReplayFile(dir string, name string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// Snapshots returns the names of the replayed snapshots, in order.
+func (c *ReplayCommand) Snapshots() []string {
+	names := make([]string, 0, len(c.snapshots))
+
+	for _, snapshot := range c.snapshots {
+		names = append(names, snapshot.name)
+	}
+
+	return names
+}
+
+// statistics returns an output of the current snapshot, and advances to the
+// next snapshot for call-based replay.
+//
+// Missing outputs are reported as errors, as if ccache did not support the
+// command, and do not advance the replay.
+func (c *ReplayCommand) statistics(ctx context.Context, command string, output func(replaySnapshot) string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index := c.next
+
+	if c.interval > 0 {
+		elapsed := max(c.now().Sub(c.start), 0)
+		index = int(elapsed/c.interval) % len(c.snapshots)
+	}
+
+	snapshot := c.snapshots[index]
+
+	out := output(snapshot)
+	if out == "" {
+		return "", fmt.Errorf("%w: %s: %s", ErrReplayOutputMissing, snapshot.name, command)
+	}
+
+	if c.interval <= 0 {
+		c.next = (c.next + 1) % len(c.snapshots)
+	}
+
+	return out, nil
+}
+
+// configuration returns the content of the config file, if any.
+func (c *ReplayCommand) configuration(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return c.config, nil
+}
+
+// PrintConfig returns the replayed configuration.
+func (c *ReplayCommand) PrintConfig(ctx context.Context) (string, error) {
+	return c.configuration(ctx)
+}
+
+// ShowConfig returns the replayed configuration.
+func (c *ReplayCommand) ShowConfig(ctx context.Context) (string, error) {
+	return c.configuration(ctx)
+}
+
+// PrintStats returns the replayed output of `ccache --print-stats`.
+func (c *ReplayCommand) PrintStats(ctx context.Context) (string, error) {
+	return c.statistics(ctx, CommandPrintStats, func(s replaySnapshot) string { return s.printStats })
+}
+
+// PrintStatsJSON returns the replayed output of
+// `ccache --print-stats --format=json`.
+func (c *ReplayCommand) PrintStatsJSON(ctx context.Context) (string, error) {
+	return c.statistics(ctx, CommandPrintStatsJSON, func(s replaySnapshot) string { return s.printStatsJSON })
+}
+
+// ShowStats returns the replayed output of `ccache --show-stats`.
+func (c *ReplayCommand) ShowStats(ctx context.Context) (string, error) {
+	return c.statistics(ctx, CommandShowStats, func(s replaySnapshot) string { return s.showStats })
+}
+
+// Version returns the replayed output of `ccache --version`.
+func (c *ReplayCommand) Version(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return c.version, nil
+}
+
+// readOnly reports a management command, which cannot be replayed.
+func (c *ReplayCommand) readOnly(args ...string) (string, error) {
+	return "", fmt.Errorf("%w: %s", ErrReplayReadOnly, strings.Join(args, " "))
+}
+
+// ZeroStats returns ErrReplayReadOnly.
+func (c *ReplayCommand) ZeroStats(_ context.Context) (string, error) {
+	return c.readOnly(CommandZeroStats)
+}
+
+// Cleanup returns ErrReplayReadOnly.
+func (c *ReplayCommand) Cleanup(_ context.Context) (string, error) {
+	return c.readOnly(CommandCleanup)
+}
+
+// Clear returns ErrReplayReadOnly.
+func (c *ReplayCommand) Clear(_ context.Context) (string, error) {
+	return c.readOnly(CommandClear)
+}
+
+// EvictOlderThan returns ErrReplayReadOnly.
+func (c *ReplayCommand) EvictOlderThan(_ context.Context, age string) (string, error) {
+	return c.readOnly(CommandEvictOlderThan, age)
+}
+
+// Recompress returns ErrReplayReadOnly.
+func (c *ReplayCommand) Recompress(_ context.Context, level string) (string, error) {
+	return c.readOnly(CommandRecompress, level)
+}
+
+// SetConfig returns ErrReplayReadOnly.
+func (c *ReplayCommand) SetConfig(_ context.Context, key string, value string) (string, error) {
+	return c.readOnly(CommandSetConfig + "=" + key + "=" + value)
+}
+
+// SetMaxSize returns ErrReplayReadOnly.
+func (c *ReplayCommand) SetMaxSize(_ context.Context, size string) (string, error) {
+	return c.readOnly(CommandMaxSize, size)
+}
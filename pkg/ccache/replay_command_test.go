@@ -0,0 +1,206 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayCommandTestdata(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "*-ccache-*"))
+	if err != nil {
+		t.Fatalf("failed to list fixture directories: %q", err)
+	}
+
+	for _, dir := range dirs {
+		if strings.Contains(dir, "cache-directory") {
+			continue
+		}
+
+		t.Run(dir, func(t *testing.T) {
+			cmd, err := NewReplayCommand(dir)
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			wantSnapshots := []string{"empty", "firstbuild", "secondbuild"}
+			if got := cmd.Snapshots(); !slices.Equal(got, wantSnapshots) {
+				t.Fatalf("want snapshots %q, got %q", wantSnapshots, got)
+			}
+
+			wrapper := newTestWrapper(t, cmd)
+
+			if _, err := wrapper.Configuration(context.Background()); err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			var calls []int64
+
+			for range len(wantSnapshots) + 1 {
+				stats, err := wrapper.Statistics(context.Background())
+				if err != nil {
+					t.Fatalf("want no error, got %q", err)
+				}
+
+				calls = append(calls, stats.CacheableCalls())
+			}
+
+			if calls[0] != 0 || calls[1] == 0 || calls[2] <= calls[1] {
+				t.Errorf("want cacheable calls to increase through snapshots, got %v", calls)
+			}
+
+			if calls[3] != calls[0] {
+				t.Errorf("want the replay to loop, got %v", calls)
+			}
+		})
+	}
+}
+
+func TestReplayCommandInterval(t *testing.T) {
+	now := time.Date(2025, 3, 25, 12, 0, 0, 0, time.UTC)
+
+	cmd, err := NewReplayCommand(
+		filepath.Join("testdata", "ubuntu-24.04-ccache-4.9.1"),
+		WithReplayInterval(time.Minute),
+		WithReplayClock(func() time.Time { return now }),
+	)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	cases := []struct {
+		elapsed time.Duration
+		want    string
+	}{
+		{elapsed: 0, want: "empty"},
+		{elapsed: 30 * time.Second, want: "empty"},
+		{elapsed: time.Minute, want: "firstbuild"},
+		{elapsed: 2*time.Minute + 59*time.Second, want: "secondbuild"},
+		{elapsed: 3 * time.Minute, want: "empty"},
+	}
+
+	start := now
+
+	for _, tc := range cases {
+		now = start.Add(tc.elapsed)
+
+		// the snapshot does not change between calls
+		for range 2 {
+			got, err := cmd.PrintStats(context.Background())
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			want, err := os.ReadFile(filepath.Join("testdata", "ubuntu-24.04-ccache-4.9.1", tc.want+".tsv"))
+			if err != nil {
+				t.Fatalf("failed to open fixture: %q", err)
+			}
+
+			if got != string(want) {
+				t.Errorf("after %s: want snapshot %q", tc.elapsed, tc.want)
+			}
+		}
+	}
+}
+
+func TestReplayCommandFallsBackToTSV(t *testing.T) {
+	// ccache 4.10 prints statistics as JSON, which was not captured
+	cmd, err := NewReplayCommand(
+		filepath.Join("testdata", "ubuntu-20.04-ccache-3.7.7"),
+		WithReplayVersion("4.10"),
+	)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if _, err := cmd.PrintStatsJSON(context.Background()); !errors.Is(err, ErrReplayOutputMissing) {
+		t.Fatalf("want error %q, got %q", ErrReplayOutputMissing, err)
+	}
+
+	wrapper := newTestWrapper(t, cmd)
+
+	if got := wrapper.Version(); got != "4.10" {
+		t.Errorf("want version %q, got %q", "4.10", got)
+	}
+
+	// missing outputs do not advance the replay
+	stats, err := wrapper.Statistics(context.Background())
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if stats.CacheableCalls() != 0 {
+		t.Errorf("want the empty snapshot, got %d cacheable calls", stats.CacheableCalls())
+	}
+}
+
+func TestReplayCommandErrors(t *testing.T) {
+	emptyDir := t.TempDir()
+
+	unversionedDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(unversionedDir, "empty.tsv"), []byte("cache_miss\t0\n"), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %q", err)
+	}
+
+	cases := []struct {
+		tname   string
+		dir     string
+		wantErr error
+	}{
+		{
+			tname:   "missing directory",
+			dir:     filepath.Join(emptyDir, "missing"),
+			wantErr: os.ErrNotExist,
+		},
+		{
+			tname:   "not a directory",
+			dir:     filepath.Join("testdata", "sizes", "sizes.tsv"),
+			wantErr: ErrReplayDirectoryInvalid,
+		},
+		{
+			tname:   "no snapshot",
+			dir:     emptyDir,
+			wantErr: ErrReplaySnapshotsMissing,
+		},
+		{
+			tname:   "no version",
+			dir:     unversionedDir,
+			wantErr: ErrVersionMissing,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			_, err := NewReplayCommand(tc.dir)
+
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("want error %q, got %q", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReplayCommandReadOnly(t *testing.T) {
+	cmd, err := NewReplayCommand(filepath.Join("testdata", "debian-12-ccache-4.7.5"))
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	wrapper := newTestWrapper(t, cmd)
+
+	if err := wrapper.ZeroStatistics(context.Background()); !errors.Is(err, ErrReplayReadOnly) {
+		t.Errorf("want error %q, got %q", ErrReplayReadOnly, err)
+	}
+
+	if _, err := wrapper.Cleanup(context.Background()); !errors.Is(err, ErrReplayReadOnly) {
+		t.Errorf("want error %q, got %q", ErrReplayReadOnly, err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/units"
+)
+
+const (
+	// maximum length of a size; the largest size held by an int64 is printed
+	// by ccache as "9223372036854775807 bytes"
+	maxSizeLength = 64
+)
+
+var (
+	ErrSizeInvalid error = errors.New("size: invalid value")
+)
+
+var (
+	sizeRegex = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*(?:([kmgt])(i?))?(b|bytes)?$`)
+)
+
+// sizeMultipliers maps size prefixes to their decimal (SI) and binary (IEC)
+// multipliers.
+var sizeMultipliers = map[string][2]int64{
+	"":  {1, 1},
+	"K": {1000, 1 << 10},
+	"M": {1000 * 1000, 1 << 20},
+	"G": {1000 * 1000 * 1000, 1 << 30},
+	"T": {1000 * 1000 * 1000 * 1000, 1 << 40},
+}
+
+// ParseSize parses a size as formatted by ccache, and returns the
+// corresponding number of bytes.
+//
+// Sizes may use decimal (k, M, G, T) or binary (Ki, Mi, Gi, Ti) prefixes,
+// followed by an optional "B" or "bytes" unit, with or without a space between
+// the value and the unit, e.g. "5.0G", "17.0 GB", "0.1 GiB" or "12.1 MB".
+// A size without a unit is a number of bytes.
+//
+// The result is truncated to a whole number of bytes. Sizes longer than 64
+// characters are rejected, as parsing arbitrarily long numbers is costly.
+func ParseSize(text string) (units.MetricBytes, error) {
+	trimmed := strings.TrimSpace(text)
+	if len(trimmed) > maxSizeLength {
+		return 0, fmt.Errorf("%w: more than %d characters", ErrSizeInvalid, maxSizeLength)
+	}
+
+	matches := sizeRegex.FindStringSubmatch(trimmed)
+	if matches == nil {
+		return 0, fmt.Errorf("%w: %q", ErrSizeInvalid, text)
+	}
+
+	value, ok := new(big.Rat).SetString(matches[1])
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrSizeInvalid, text)
+	}
+
+	multipliers := sizeMultipliers[strings.ToUpper(matches[2])]
+	multiplier := multipliers[0]
+	if matches[3] != "" {
+		multiplier = multipliers[1]
+	}
+
+	value.Mul(value, new(big.Rat).SetInt64(multiplier))
+
+	bytes := new(big.Int).Quo(value.Num(), value.Denom())
+	if !bytes.IsInt64() {
+		return 0, fmt.Errorf("%w: %q", ErrSizeInvalid, text)
+	}
+
+	return units.MetricBytes(bytes.Int64()), nil
+}
+
+// normalizeSize returns a size without spaces, with an upper-case prefix and
+// the "B" unit, e.g. "5.0 GiB" becomes "5.0GiB" and "17.0g" becomes "17.0GB".
+//
+// The size must be valid.
+func normalizeSize(text string) string {
+	matches := sizeRegex.FindStringSubmatch(strings.TrimSpace(text))
+	if matches == nil {
+		return text
+	}
+
+	prefix := strings.ToUpper(matches[2])
+	if matches[3] != "" {
+		prefix += "i"
+	}
+
+	return matches[1] + prefix + "B"
+}
+
+// kibibytes returns the number of bytes for a size expressed in kibibytes, as
+// reported by `ccache --print-stats`.
+func kibibytes(value int64) units.MetricBytes {
+	return units.MetricBytes(value) * units.MetricBytes(units.KiB)
+}
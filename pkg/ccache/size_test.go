@@ -0,0 +1,85 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/units"
+)
+
+func TestParseSize(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "sizes", "sizes.tsv"))
+	if err != nil {
+		t.Fatalf("failed to open test input: %q", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// <size> <bytes> <normalized size>
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			t.Fatalf("invalid test input: %q", line)
+		}
+
+		wantBytes, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			t.Fatalf("invalid test input: %q", line)
+		}
+
+		t.Run(fields[0], func(t *testing.T) {
+			got, err := ParseSize(fields[0])
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			assertMetricByteFieldEquals(t, "bytes", got, units.MetricBytes(wantBytes))
+			assertStringFieldEquals(t, "normalized size", normalizeSize(fields[0]), fields[2])
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to read test input: %q", err)
+	}
+}
+
+func TestParseSizeErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"GB",
+		"5.0 ZB",
+		"5.0 iB",
+		"-5 GB",
+		"5,0 GB",
+		"10000000 TB",
+		"0." + strings.Repeat("0", 100000) + "1 GB",
+	}
+
+	for _, input := range cases {
+		tname := input
+		if len(tname) > 32 {
+			tname = tname[:32] + "..."
+		}
+
+		t.Run(tname, func(t *testing.T) {
+			_, err := ParseSize(input)
+			if !errors.Is(err, ErrSizeInvalid) {
+				t.Errorf("want error %q, got %q", ErrSizeInvalid, err)
+			}
+		})
+	}
+}
@@ -4,46 +4,298 @@
 package ccache
 
 import (
+	"regexp"
 	"time"
 
 	"github.com/alecthomas/units"
 )
 
+var (
+	// counter keys printed by ccache, e.g. "local_storage_read_hit"
+	statisticsKeyRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
 // Statistics represents information about ccache usage.
 type Statistics struct {
+	// Cache location
+	CacheDirectory  string `json:"cache_directory,omitempty"`
+	PrimaryConfig   string `json:"primary_config,omitempty"`
+	SecondaryConfig string `json:"secondary_config,omitempty"`
+
 	// Cache status
-	CleanupsPerformed int               `json:"cleanups_performed"`
-	FilesInCache      int               `json:"files_in_cache"`
+	CleanupsPerformed int64             `json:"cleanups_performed"`
+	FilesInCache      int64             `json:"files_in_cache"`
+	MaxFilesInCache   int64             `json:"max_files_in_cache"`
 	CacheSize         string            `json:"cache_size"`
 	CacheSizeBytes    units.MetricBytes `json:"cache_size_bytes"`
+	MaxCacheSize      string            `json:"max_cache_size"`
+	MaxCacheSizeBytes units.MetricBytes `json:"max_cache_size_bytes"`
 
 	// Timestamps
 	StatsTime     time.Time `json:"stats_time"`
 	StatsZeroTime time.Time `json:"stats_zero_time"`
 
 	// Cache usage
-	CacheHitDirect         int     `json:"cache_hit_direct"`
-	CacheHitPreprocessed   int     `json:"cache_hit_preprocessed"`
-	CacheMiss              int     `json:"cache_miss"`
-	CacheMissDirect        int     `json:"cache_miss_direct"`
-	CacheMissPreprocessed  int     `json:"cache_miss_preprocessed"`
+	CacheHitDirect         int64   `json:"cache_hit_direct"`
+	CacheHitPreprocessed   int64   `json:"cache_hit_preprocessed"`
+	CacheMiss              int64   `json:"cache_miss"`
+	CacheMissDirect        int64   `json:"cache_miss_direct"`
+	CacheMissPreprocessed  int64   `json:"cache_miss_preprocessed"`
 	CacheHitRate           float64 `json:"cache_hit_rate"`
 	CacheHitRatio          float64 `json:"cache_hit_ratio"`
-	CalledForLink          int     `json:"called_for_link"`
-	CalledForPreprocessing int     `json:"called_for_preprocessing"`
+	CalledForLink          int64   `json:"called_for_link"`
+	CalledForPreprocessing int64   `json:"called_for_preprocessing"`
 
 	// Uncacheable
-	CompilationFailed        int `json:"compilation_failed"`
-	PreprocessingFailed      int `json:"preprocessing_failed"`
-	UnsupportedCodeDirective int `json:"unsupported_code_directive"`
-	NoInputFile              int `json:"no_input_file"`
+	AutoconfTest                   int64 `json:"autoconf_test"`
+	BadCompilerArguments           int64 `json:"bad_compiler_arguments"`
+	CompilationFailed              int64 `json:"compilation_failed"`
+	CompilerProducedEmptyOutput    int64 `json:"compiler_produced_empty_output"`
+	CompilerProducedNoOutput       int64 `json:"compiler_produced_no_output"`
+	CompilerProducedStdout         int64 `json:"compiler_produced_stdout"`
+	CouldNotUseModules             int64 `json:"could_not_use_modules"`
+	CouldNotUsePrecompiledHeader   int64 `json:"could_not_use_precompiled_header"`
+	Disabled                       int64 `json:"disabled"`
+	MultipleSourceFiles            int64 `json:"multiple_source_files"`
+	NoInputFile                    int64 `json:"no_input_file"`
+	OutputToStdout                 int64 `json:"output_to_stdout"`
+	PreprocessingFailed            int64 `json:"preprocessing_failed"`
+	Recache                        int64 `json:"recache"`
+	UnsupportedCodeDirective       int64 `json:"unsupported_code_directive"`
+	UnsupportedCompilerOption      int64 `json:"unsupported_compiler_option"`
+	UnsupportedEnvironmentVariable int64 `json:"unsupported_environment_variable"`
+	UnsupportedSourceLanguage      int64 `json:"unsupported_source_language"`
+
+	// Errors
+	BadInputFile          int64 `json:"bad_input_file"`
+	BadOutputFile         int64 `json:"bad_output_file"`
+	CompilerCheckFailed   int64 `json:"compiler_check_failed"`
+	CouldNotFindCompiler  int64 `json:"could_not_find_compiler"`
+	ErrorHashingExtraFile int64 `json:"error_hashing_extra_file"`
+	InternalError         int64 `json:"internal_error"`
+	MissingCacheFile      int64 `json:"missing_cache_file"`
+	ModifiedInputFile     int64 `json:"modified_input_file"`
+
+	// Local storage
+	LocalStorageHit      int64 `json:"local_storage_hit"`
+	LocalStorageMiss     int64 `json:"local_storage_miss"`
+	LocalStorageReadHit  int64 `json:"local_storage_read_hit"`
+	LocalStorageReadMiss int64 `json:"local_storage_read_miss"`
+	LocalStorageWrite    int64 `json:"local_storage_write"`
 
 	// Remote storage
-	RemoteStorageError    int `json:"remote_storage_error"`
-	RemoteStorageHit      int `json:"remote_storage_hit"`
-	RemoteStorageMiss     int `json:"remote_storage_miss"`
-	RemoteStorageReadHit  int `json:"remote_storage_read_hit"`
-	RemoteStorageReadMiss int `json:"remote_storage_read_miss"`
-	RemoteStorageTimeout  int `json:"remote_storage_timeout"`
-	RemoteStorageWrite    int `json:"remote_storage_write"`
+	RemoteStorageError    int64 `json:"remote_storage_error"`
+	RemoteStorageHit      int64 `json:"remote_storage_hit"`
+	RemoteStorageMiss     int64 `json:"remote_storage_miss"`
+	RemoteStorageReadHit  int64 `json:"remote_storage_read_hit"`
+	RemoteStorageReadMiss int64 `json:"remote_storage_read_miss"`
+	RemoteStorageTimeout  int64 `json:"remote_storage_timeout"`
+	RemoteStorageWrite    int64 `json:"remote_storage_write"`
+
+	// Counters holds every key/value pair reported by ccache, including those
+	// that are not (yet) modelled by a dedicated field.
+	Counters map[string]int64 `json:"counters,omitempty"`
+}
+
+// statisticsCounters maps the counter keys printed by `ccache --print-stats`
+// to the corresponding Statistics fields.
+var statisticsCounters = map[string]func(*Statistics) *int64{
+	// Cache status
+	"cleanups_performed": func(s *Statistics) *int64 { return &s.CleanupsPerformed },
+	"files_in_cache":     func(s *Statistics) *int64 { return &s.FilesInCache },
+	"max_files_in_cache": func(s *Statistics) *int64 { return &s.MaxFilesInCache },
+
+	// Cache usage
+	"cache_miss":               func(s *Statistics) *int64 { return &s.CacheMiss },
+	"called_for_link":          func(s *Statistics) *int64 { return &s.CalledForLink },
+	"called_for_preprocessing": func(s *Statistics) *int64 { return &s.CalledForPreprocessing },
+	"direct_cache_hit":         func(s *Statistics) *int64 { return &s.CacheHitDirect },
+	"direct_cache_miss":        func(s *Statistics) *int64 { return &s.CacheMissDirect },
+	"preprocessed_cache_hit":   func(s *Statistics) *int64 { return &s.CacheHitPreprocessed },
+	"preprocessed_cache_miss":  func(s *Statistics) *int64 { return &s.CacheMissPreprocessed },
+
+	// Uncacheable
+	"autoconf_test":                    func(s *Statistics) *int64 { return &s.AutoconfTest },
+	"bad_compiler_arguments":           func(s *Statistics) *int64 { return &s.BadCompilerArguments },
+	"compile_failed":                   func(s *Statistics) *int64 { return &s.CompilationFailed },
+	"compiler_produced_empty_output":   func(s *Statistics) *int64 { return &s.CompilerProducedEmptyOutput },
+	"compiler_produced_no_output":      func(s *Statistics) *int64 { return &s.CompilerProducedNoOutput },
+	"compiler_produced_stdout":         func(s *Statistics) *int64 { return &s.CompilerProducedStdout },
+	"could_not_use_modules":            func(s *Statistics) *int64 { return &s.CouldNotUseModules },
+	"could_not_use_precompiled_header": func(s *Statistics) *int64 { return &s.CouldNotUsePrecompiledHeader },
+	"disabled":                         func(s *Statistics) *int64 { return &s.Disabled },
+	"multiple_source_files":            func(s *Statistics) *int64 { return &s.MultipleSourceFiles },
+	"no_input_file":                    func(s *Statistics) *int64 { return &s.NoInputFile },
+	"output_to_stdout":                 func(s *Statistics) *int64 { return &s.OutputToStdout },
+	"preprocessor_error":               func(s *Statistics) *int64 { return &s.PreprocessingFailed },
+	"recache":                          func(s *Statistics) *int64 { return &s.Recache },
+	"unsupported_code_directive":       func(s *Statistics) *int64 { return &s.UnsupportedCodeDirective },
+	"unsupported_compiler_option":      func(s *Statistics) *int64 { return &s.UnsupportedCompilerOption },
+	"unsupported_environment_variable": func(s *Statistics) *int64 { return &s.UnsupportedEnvironmentVariable },
+	"unsupported_source_language":      func(s *Statistics) *int64 { return &s.UnsupportedSourceLanguage },
+
+	// Errors
+	"bad_input_file":           func(s *Statistics) *int64 { return &s.BadInputFile },
+	"bad_output_file":          func(s *Statistics) *int64 { return &s.BadOutputFile },
+	"compiler_check_failed":    func(s *Statistics) *int64 { return &s.CompilerCheckFailed },
+	"could_not_find_compiler":  func(s *Statistics) *int64 { return &s.CouldNotFindCompiler },
+	"error_hashing_extra_file": func(s *Statistics) *int64 { return &s.ErrorHashingExtraFile },
+	"internal_error":           func(s *Statistics) *int64 { return &s.InternalError },
+	"missing_cache_file":       func(s *Statistics) *int64 { return &s.MissingCacheFile },
+	"modified_input_file":      func(s *Statistics) *int64 { return &s.ModifiedInputFile },
+
+	// Local storage
+	"local_storage_hit":       func(s *Statistics) *int64 { return &s.LocalStorageHit },
+	"local_storage_miss":      func(s *Statistics) *int64 { return &s.LocalStorageMiss },
+	"local_storage_read_hit":  func(s *Statistics) *int64 { return &s.LocalStorageReadHit },
+	"local_storage_read_miss": func(s *Statistics) *int64 { return &s.LocalStorageReadMiss },
+	"local_storage_write":     func(s *Statistics) *int64 { return &s.LocalStorageWrite },
+
+	// Remote storage
+	"remote_storage_error":     func(s *Statistics) *int64 { return &s.RemoteStorageError },
+	"remote_storage_hit":       func(s *Statistics) *int64 { return &s.RemoteStorageHit },
+	"remote_storage_miss":      func(s *Statistics) *int64 { return &s.RemoteStorageMiss },
+	"remote_storage_read_hit":  func(s *Statistics) *int64 { return &s.RemoteStorageReadHit },
+	"remote_storage_read_miss": func(s *Statistics) *int64 { return &s.RemoteStorageReadMiss },
+	"remote_storage_timeout":   func(s *Statistics) *int64 { return &s.RemoteStorageTimeout },
+	"remote_storage_write":     func(s *Statistics) *int64 { return &s.RemoteStorageWrite },
+}
+
+// statisticsKeyAliases maps historical counter keys to their current name.
+//
+// ccache 4.4 to 4.6 report local and remote storage counters as primary and
+// secondary storage counters.
+var statisticsKeyAliases = map[string]string{
+	"primary_storage_hit":       "local_storage_hit",
+	"primary_storage_miss":      "local_storage_miss",
+	"secondary_storage_error":   "remote_storage_error",
+	"secondary_storage_hit":     "remote_storage_hit",
+	"secondary_storage_miss":    "remote_storage_miss",
+	"secondary_storage_timeout": "remote_storage_timeout",
+}
+
+// canonicalStatisticsKey returns the current name of a counter key, which may
+// have been renamed since the version of ccache that reported it.
+func canonicalStatisticsKey(key string) string {
+	if alias, ok := statisticsKeyAliases[key]; ok {
+		return alias
+	}
+
+	return key
+}
+
+// counter returns a pointer to the Statistics field holding the value of the
+// given counter key, or nil if the key is not modelled.
+func (s *Statistics) counter(key string) *int64 {
+	field, ok := statisticsCounters[key]
+	if !ok {
+		return nil
+	}
+
+	return field(s)
+}
+
+// isValidStatisticsKey returns whether a key is formatted as the counter keys
+// printed by ccache, with lower-case letters, digits and underscores.
+//
+// Other keys are ignored, as they cannot be exported as metric labels.
+func isValidStatisticsKey(key string) bool {
+	return statisticsKeyRegex.MatchString(key)
+}
+
+// isStatisticsKey returns whether a key printed by `ccache --print-stats` is
+// modelled by Statistics.
+func isStatisticsKey(key string) bool {
+	key = canonicalStatisticsKey(key)
+
+	switch key {
+	case "cache_size_kibibyte", "max_cache_size_kibibyte", "stats_updated_timestamp", "stats_zeroed_timestamp":
+		return true
+	}
+
+	_, ok := statisticsCounters[key]
+
+	return ok
+}
+
+// setValue records a key/value pair, as printed by `ccache --print-stats`, and
+// sets the corresponding Statistics field if the key is modelled.
+//
+// Historical keys are recorded under their current name.
+func (s *Statistics) setValue(key string, value int64) {
+	key = canonicalStatisticsKey(key)
+
+	switch key {
+	case "cache_size_kibibyte":
+		s.CacheSizeBytes = kibibytes(value)
+
+	case "max_cache_size_kibibyte":
+		s.MaxCacheSizeBytes = kibibytes(value)
+		s.MaxCacheSize = s.MaxCacheSizeBytes.Floor().String()
+
+	case "stats_updated_timestamp":
+		s.StatsTime = time.Unix(value, 0).UTC()
+
+	case "stats_zeroed_timestamp":
+		s.StatsZeroTime = time.Unix(value, 0).UTC()
+	}
+
+	s.setCounter(key, value)
+}
+
+// updateDerivedFields computes fields that are not reported by ccache
+// machine-readable outputs.
+func (s *Statistics) updateDerivedFields() {
+	s.updateRatios()
+	s.CacheSize = s.CacheSizeBytes.Floor().String()
+}
+
+// updateRatios computes the cache hit ratio and rate from counters.
+func (s *Statistics) updateRatios() {
+	s.CacheHitRatio = s.HitRatio()
+	s.CacheHitRate = 100 * s.CacheHitRatio
+}
+
+// setCounter records the value of a counter, and sets the corresponding
+// Statistics field if the counter is modelled.
+func (s *Statistics) setCounter(key string, value int64) {
+	if s.Counters == nil {
+		s.Counters = map[string]int64{}
+	}
+
+	s.Counters[key] = value
+
+	if counter := s.counter(key); counter != nil {
+		*counter = value
+	}
+}
+
+// reportsCounter returns whether a counter would be reported by ccache.
+//
+// If statistics were parsed, only the counters found in the input are
+// reported; otherwise, only non-zero counters are reported.
+func (s *Statistics) reportsCounter(key string) bool {
+	if s.Counters != nil {
+		_, ok := s.Counters[key]
+		return ok
+	}
+
+	return s.counterValue(key) != 0
+}
+
+// counterValue returns the value of a counter, preferring the corresponding
+// Statistics field if the counter is modelled.
+func (s *Statistics) counterValue(key string) int64 {
+	switch key {
+	case "cache_size_kibibyte":
+		return int64(s.CacheSizeBytes) / 1024
+	case "max_cache_size_kibibyte":
+		return int64(s.MaxCacheSizeBytes) / 1024
+	}
+
+	if counter := s.counter(key); counter != nil {
+		return *counter
+	}
+
+	return s.Counters[key]
 }
@@ -0,0 +1,226 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+// statisticsLimits lists the keys holding cache limits, rather than counters.
+var statisticsLimits = map[string]bool{
+	"max_cache_size_kibibyte": true,
+	"max_files_in_cache":      true,
+}
+
+// statisticsGauges lists the keys holding the current state of the cache,
+// that are not affected when statistics are zeroed.
+var statisticsGauges = map[string]bool{
+	"cache_size_kibibyte": true,
+	"files_in_cache":      true,
+}
+
+// ResetSince returns whether statistics have been zeroed since a previous
+// snapshot was taken.
+func (s *Statistics) ResetSince(previous *Statistics) bool {
+	return s.StatsZeroTime.After(previous.StatsZeroTime)
+}
+
+// Sub returns the difference between these statistics and a previous
+// snapshot, e.g. to determine the effect of a build on the cache.
+//
+// If statistics have been zeroed since the previous snapshot, or if a counter
+// has decreased, counters are considered to have been reset and their current
+// value is returned. The difference in cache size and files is returned as is,
+// and may be negative if the cache has been cleaned up. Cache limits are those
+// of the current statistics.
+//
+// The statistics zero time of the result is the time of the previous snapshot,
+// or the time statistics have been zeroed if they have been since.
+func (s *Statistics) Sub(previous *Statistics) *Statistics {
+	reset := s.ResetSince(previous)
+
+	diff := combineStatistics(s, previous, func(key string, current, previous int64) int64 {
+		switch {
+		case statisticsLimits[key]:
+			return current
+		case statisticsGauges[key]:
+			return current - previous
+		case reset || current < previous:
+			return current
+		default:
+			return current - previous
+		}
+	})
+
+	diff.setLocation(s.location())
+	diff.StatsTime = s.StatsTime
+	diff.StatsZeroTime = previous.StatsTime
+
+	if reset {
+		diff.StatsZeroTime = s.StatsZeroTime
+	}
+
+	diff.updateTimestampCounters()
+	diff.updateDerivedFields()
+
+	return diff
+}
+
+// Add returns the sum of these statistics and other statistics, e.g. gathered
+// from another host or cache directory.
+//
+// See MergeStatistics.
+func (s *Statistics) Add(other *Statistics) *Statistics {
+	return MergeStatistics(s, other)
+}
+
+// MergeStatistics returns the sum of several statistics, e.g. gathered from
+// different hosts or cache directories.
+//
+// The statistics time of the result is the most recent of all, and the
+// statistics zero time is the most recent reset, as done by ccache when
+// summing the statistics of cache subdirectories. Cache locations are kept
+// only if they are the same for all statistics.
+func MergeStatistics(stats ...*Statistics) *Statistics {
+	merged := &Statistics{}
+
+	for index, s := range stats {
+		location := merged.location()
+		if index == 0 {
+			location = s.location()
+		} else if location != s.location() {
+			location = statisticsLocation{}
+		}
+
+		statsTime := latestTime(merged.StatsTime, s.StatsTime)
+		statsZeroTime := latestTime(merged.StatsZeroTime, s.StatsZeroTime)
+
+		merged = combineStatistics(merged, s, func(_ string, a, b int64) int64 {
+			return a + b
+		})
+
+		merged.setLocation(location)
+		merged.StatsTime = statsTime
+		merged.StatsZeroTime = statsZeroTime
+	}
+
+	merged.updateTimestampCounters()
+	merged.updateDerivedFields()
+
+	return merged
+}
+
+// statisticsLocation holds the fields describing where statistics are stored.
+type statisticsLocation struct {
+	cacheDirectory  string
+	primaryConfig   string
+	secondaryConfig string
+}
+
+func (s *Statistics) location() statisticsLocation {
+	return statisticsLocation{
+		cacheDirectory:  s.CacheDirectory,
+		primaryConfig:   s.PrimaryConfig,
+		secondaryConfig: s.SecondaryConfig,
+	}
+}
+
+func (s *Statistics) setLocation(location statisticsLocation) {
+	s.CacheDirectory = location.cacheDirectory
+	s.PrimaryConfig = location.primaryConfig
+	s.SecondaryConfig = location.secondaryConfig
+}
+
+// updateTimestampCounters sets the timestamp counters, if any, to the
+// statistics times.
+func (s *Statistics) updateTimestampCounters() {
+	if _, ok := s.Counters["stats_updated_timestamp"]; ok {
+		s.Counters["stats_updated_timestamp"] = s.StatsTime.Unix()
+	}
+
+	if _, ok := s.Counters["stats_zeroed_timestamp"]; ok {
+		s.Counters["stats_zeroed_timestamp"] = s.StatsZeroTime.Unix()
+	}
+}
+
+// combineStatistics returns new Statistics whose counters, sizes and limits
+// are computed from the values of a and b for each key.
+//
+// Derived fields are not computed.
+func combineStatistics(a, b *Statistics, op func(key string, a, b int64) int64) *Statistics {
+	result := &Statistics{}
+
+	for key, field := range statisticsCounters {
+		*field(result) = op(key, *field(a), *field(b))
+	}
+
+	result.CacheSizeBytes = units.MetricBytes(op("cache_size_kibibyte", int64(a.CacheSizeBytes), int64(b.CacheSizeBytes)))
+	result.MaxCacheSizeBytes = units.MetricBytes(op("max_cache_size_kibibyte", int64(a.MaxCacheSizeBytes), int64(b.MaxCacheSizeBytes)))
+
+	if result.MaxCacheSizeBytes > 0 {
+		result.MaxCacheSize = result.MaxCacheSizeBytes.Floor().String()
+	}
+
+	if a.Counters == nil && b.Counters == nil {
+		return result
+	}
+
+	// values are read from the Statistics fields, so that both views match
+	// when an operand has no Counters, e.g. statistics built by hand
+	result.Counters = map[string]int64{}
+
+	for _, s := range []*Statistics{a, b} {
+		for _, key := range s.reportedCounters() {
+			result.Counters[key] = op(key, a.counterValue(key), b.counterValue(key))
+		}
+	}
+
+	// sizes are computed in bytes
+	for key, value := range map[string]units.MetricBytes{
+		"cache_size_kibibyte":     result.CacheSizeBytes,
+		"max_cache_size_kibibyte": result.MaxCacheSizeBytes,
+	} {
+		if _, ok := result.Counters[key]; ok {
+			result.Counters[key] = int64(value) / 1024
+		}
+	}
+
+	return result
+}
+
+// reportedCounters returns the keys of the counters that would be reported
+// by ccache, see reportsCounter.
+func (s *Statistics) reportedCounters() []string {
+	if s.Counters != nil {
+		return slices.Collect(maps.Keys(s.Counters))
+	}
+
+	var keys []string
+
+	for key := range statisticsCounters {
+		if s.reportsCounter(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range []string{"cache_size_kibibyte", "max_cache_size_kibibyte"} {
+		if s.reportsCounter(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func latestTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,343 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readTSVStatistics(t *testing.T, inputFilepath string) *Statistics {
+	t.Helper()
+
+	input, err := os.ReadFile(inputFilepath)
+	if err != nil {
+		t.Fatalf("failed to open test input: %q", err)
+	}
+
+	stats, err := ParseTSVStatistics(string(input))
+	if err != nil {
+		t.Fatalf("failed to parse test input: %q", err)
+	}
+
+	return stats
+}
+
+func TestStatisticsSub(t *testing.T) {
+	testDir := filepath.Join("testdata", "ubuntu-24.04-ccache-4.9.1")
+	firstBuild := readTSVStatistics(t, filepath.Join(testDir, "firstbuild.tsv"))
+	secondBuild := readTSVStatistics(t, filepath.Join(testDir, "secondbuild.tsv"))
+
+	want := &Statistics{
+		FilesInCache:          58,
+		CacheSizeBytes:        421888,
+		MaxCacheSize:          "5GB",
+		MaxCacheSizeBytes:     5368709120,
+		CacheHitDirect:        116,
+		CacheHitPreprocessed:  2,
+		CacheMiss:             29,
+		CacheMissDirect:       41,
+		CacheMissPreprocessed: 36,
+		CalledForLink:         35,
+		CompilationFailed:     7,
+		NoInputFile:           15,
+		PreprocessingFailed:   3,
+		LocalStorageHit:       118,
+		LocalStorageMiss:      29,
+		LocalStorageReadHit:   234,
+		LocalStorageReadMiss:  75,
+		LocalStorageWrite:     58,
+	}
+	want.updateDerivedFields()
+
+	got := secondBuild.Sub(firstBuild)
+
+	if secondBuild.ResetSince(firstBuild) {
+		t.Error("want no reset, got one")
+	}
+
+	assertStatisticsEqual(t, got, want)
+	assertTimeFieldEquals(t, "StatsTime", got.StatsTime, secondBuild.StatsTime)
+	assertTimeFieldEquals(t, "StatsZeroTime", got.StatsZeroTime, firstBuild.StatsTime)
+
+	assertIntFieldEquals(t, "Counters[cache_miss]", got.Counters["cache_miss"], 29)
+	assertIntFieldEquals(t, "Counters[cache_size_kibibyte]", got.Counters["cache_size_kibibyte"], 412)
+	assertIntFieldEquals(t, "Counters[max_cache_size_kibibyte]", got.Counters["max_cache_size_kibibyte"], 5242880)
+	assertIntFieldEquals(t, "Counters[stats_updated_timestamp]", got.Counters["stats_updated_timestamp"], 1708109988)
+	assertIntFieldEquals(t, "Counters[stats_zeroed_timestamp]", got.Counters["stats_zeroed_timestamp"], 1708109648)
+
+	if got.CacheHitRatio == secondBuild.CacheHitRatio {
+		t.Errorf("CacheHitRatio: want a recomputed ratio, got %f", got.CacheHitRatio)
+	}
+}
+
+func TestStatisticsSubWithoutCounters(t *testing.T) {
+	testDir := filepath.Join("testdata", "ubuntu-24.04-ccache-4.9.1")
+	secondBuild := readTSVStatistics(t, filepath.Join(testDir, "secondbuild.tsv"))
+
+	// built by hand, e.g. read from a cache directory
+	previous := &Statistics{
+		StatsTime:      secondBuild.StatsZeroTime,
+		StatsZeroTime:  secondBuild.StatsZeroTime,
+		FilesInCache:   10,
+		CacheSizeBytes: 102400,
+		CacheHitDirect: 16,
+		CacheMiss:      9,
+	}
+
+	for _, got := range []*Statistics{secondBuild.Sub(previous), previous.Sub(secondBuild)} {
+		for key, field := range statisticsCounters {
+			if value, ok := got.Counters[key]; ok && value != *field(got) {
+				t.Errorf("Counters[%s]: want %d as the Statistics field, got %d", key, *field(got), value)
+			}
+		}
+
+		if got.Counters["cache_size_kibibyte"] != int64(got.CacheSizeBytes)/1024 {
+			t.Errorf("Counters[cache_size_kibibyte]: want %d, got %d", int64(got.CacheSizeBytes)/1024, got.Counters["cache_size_kibibyte"])
+		}
+	}
+
+	got := secondBuild.Sub(previous)
+
+	assertIntFieldEquals(t, "CacheHitDirect", got.CacheHitDirect, secondBuild.CacheHitDirect-16)
+	assertIntFieldEquals(t, "Counters[direct_cache_hit]", got.Counters["direct_cache_hit"], secondBuild.CacheHitDirect-16)
+	assertIntFieldEquals(t, "Counters[cache_miss]", got.Counters["cache_miss"], secondBuild.CacheMiss-9)
+}
+
+func TestStatisticsSubAfterReset(t *testing.T) {
+	previous := &Statistics{
+		StatsTime:      time.Date(2024, time.February, 16, 18, 0, 0, 0, time.UTC),
+		StatsZeroTime:  time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC),
+		FilesInCache:   300,
+		CacheSizeBytes: 80000000,
+		CacheHitDirect: 100,
+		CacheMiss:      50,
+		CalledForLink:  10,
+	}
+
+	cases := []struct {
+		tname     string
+		current   *Statistics
+		wantReset bool
+		want      Statistics
+	}{
+		{
+			tname: "statistics zeroed",
+			current: &Statistics{
+				StatsTime:      time.Date(2024, time.February, 16, 19, 0, 0, 0, time.UTC),
+				StatsZeroTime:  time.Date(2024, time.February, 16, 18, 30, 0, 0, time.UTC),
+				FilesInCache:   310,
+				CacheSizeBytes: 81000000,
+				CacheHitDirect: 120,
+				CacheMiss:      5,
+				CalledForLink:  20,
+			},
+			wantReset: true,
+			want: Statistics{
+				FilesInCache:   10,
+				CacheSizeBytes: 1000000,
+				CacheHitDirect: 120,
+				CacheMiss:      5,
+				CalledForLink:  20,
+			},
+		},
+		{
+			tname: "counter decreased",
+			current: &Statistics{
+				StatsTime:      time.Date(2024, time.February, 16, 19, 0, 0, 0, time.UTC),
+				StatsZeroTime:  time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC),
+				FilesInCache:   250,
+				CacheSizeBytes: 70000000,
+				CacheHitDirect: 110,
+				CacheMiss:      7,
+				CalledForLink:  12,
+			},
+			wantReset: false,
+			want: Statistics{
+				FilesInCache:   -50,
+				CacheSizeBytes: -10000000,
+				CacheHitDirect: 10,
+				CacheMiss:      7,
+				CalledForLink:  2,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			if got := tc.current.ResetSince(previous); got != tc.wantReset {
+				t.Errorf("want reset %t, got %t", tc.wantReset, got)
+			}
+
+			tc.want.updateDerivedFields()
+
+			got := tc.current.Sub(previous)
+
+			assertStatisticsEqual(t, got, &tc.want)
+			// counters have been accumulated since the last reset
+			wantStatsZeroTime := previous.StatsTime
+			if tc.wantReset {
+				wantStatsZeroTime = tc.current.StatsZeroTime
+			}
+
+			assertTimeFieldEquals(t, "StatsTime", got.StatsTime, tc.current.StatsTime)
+			assertTimeFieldEquals(t, "StatsZeroTime", got.StatsZeroTime, wantStatsZeroTime)
+		})
+	}
+}
+
+func TestStatisticsSubAddRoundTrip(t *testing.T) {
+	secondBuildFilepaths, err := filepath.Glob(filepath.Join("testdata", "*", "secondbuild.tsv"))
+	if err != nil {
+		t.Fatalf("failed to list test inputs: %q", err)
+	}
+
+	for _, secondBuildFilepath := range secondBuildFilepaths {
+		t.Run(filepath.Base(filepath.Dir(secondBuildFilepath)), func(t *testing.T) {
+			firstBuild := readTSVStatistics(t, filepath.Join(filepath.Dir(secondBuildFilepath), "firstbuild.tsv"))
+			secondBuild := readTSVStatistics(t, secondBuildFilepath)
+
+			got := firstBuild.Add(secondBuild.Sub(firstBuild))
+
+			for key, field := range statisticsCounters {
+				if statisticsLimits[key] {
+					continue
+				}
+
+				assertIntFieldEquals(t, key, *field(got), *field(secondBuild))
+			}
+
+			assertMetricByteFieldEquals(t, "CacheSizeBytes", got.CacheSizeBytes, secondBuild.CacheSizeBytes)
+			assertTimeFieldEquals(t, "StatsTime", got.StatsTime, secondBuild.StatsTime)
+			assertFloatFieldAlmostEquals(t, "CacheHitRatio", got.CacheHitRatio, secondBuild.CacheHitRatio)
+		})
+	}
+}
+
+func TestMergeStatistics(t *testing.T) {
+	hostA := &Statistics{
+		CacheDirectory:    "/var/cache/ccache",
+		StatsTime:         time.Date(2024, time.February, 16, 18, 0, 0, 0, time.UTC),
+		StatsZeroTime:     time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC),
+		FilesInCache:      300,
+		CacheSizeBytes:    80000000,
+		MaxCacheSizeBytes: 5000000000,
+		CacheHitDirect:    100,
+		CacheMiss:         50,
+		Counters: map[string]int64{
+			"direct_cache_hit":        100,
+			"cache_miss":              50,
+			"stats_updated_timestamp": 1708106400,
+		},
+	}
+	hostB := &Statistics{
+		CacheDirectory:       "/var/cache/ccache",
+		StatsTime:            time.Date(2024, time.February, 16, 19, 0, 0, 0, time.UTC),
+		StatsZeroTime:        time.Date(2024, time.February, 3, 9, 0, 0, 0, time.UTC),
+		FilesInCache:         200,
+		CacheSizeBytes:       20000000,
+		MaxCacheSizeBytes:    5000000000,
+		CacheHitPreprocessed: 30,
+		CacheMiss:            20,
+		Counters: map[string]int64{
+			"preprocessed_cache_hit":  30,
+			"cache_miss":              20,
+			"stats_updated_timestamp": 1708110000,
+		},
+	}
+	hostC := &Statistics{
+		CacheDirectory: "/home/ci/.ccache",
+		StatsTime:      time.Date(2024, time.February, 16, 17, 0, 0, 0, time.UTC),
+		StatsZeroTime:  time.Date(2024, time.February, 2, 9, 0, 0, 0, time.UTC),
+		CacheHitDirect: 20,
+		CacheMiss:      30,
+	}
+
+	cases := []struct {
+		tname             string
+		input             []*Statistics
+		want              Statistics
+		wantStatsTime     time.Time
+		wantStatsZeroTime time.Time
+		wantCounters      map[string]int64
+	}{
+		{
+			tname: "no statistics",
+		},
+		{
+			tname: "single host",
+			input: []*Statistics{hostA},
+			want: Statistics{
+				CacheDirectory:    "/var/cache/ccache",
+				FilesInCache:      300,
+				CacheSizeBytes:    80000000,
+				MaxCacheSize:      "5GB",
+				MaxCacheSizeBytes: 5000000000,
+				CacheHitDirect:    100,
+				CacheMiss:         50,
+			},
+			wantStatsTime:     hostA.StatsTime,
+			wantStatsZeroTime: hostA.StatsZeroTime,
+			wantCounters:      hostA.Counters,
+		},
+		{
+			tname: "same cache directory",
+			input: []*Statistics{hostA, hostB},
+			want: Statistics{
+				CacheDirectory:       "/var/cache/ccache",
+				FilesInCache:         500,
+				CacheSizeBytes:       100000000,
+				MaxCacheSize:         "10GB",
+				MaxCacheSizeBytes:    10000000000,
+				CacheHitDirect:       100,
+				CacheHitPreprocessed: 30,
+				CacheMiss:            70,
+			},
+			wantStatsTime:     hostB.StatsTime,
+			wantStatsZeroTime: hostB.StatsZeroTime,
+			wantCounters: map[string]int64{
+				"direct_cache_hit":        100,
+				"preprocessed_cache_hit":  30,
+				"cache_miss":              70,
+				"stats_updated_timestamp": 1708110000,
+			},
+		},
+		{
+			tname: "different cache directories",
+			input: []*Statistics{hostA, hostB, hostC},
+			want: Statistics{
+				FilesInCache:         500,
+				CacheSizeBytes:       100000000,
+				MaxCacheSize:         "10GB",
+				MaxCacheSizeBytes:    10000000000,
+				CacheHitDirect:       120,
+				CacheHitPreprocessed: 30,
+				CacheMiss:            100,
+			},
+			wantStatsTime:     hostB.StatsTime,
+			wantStatsZeroTime: hostB.StatsZeroTime,
+			wantCounters: map[string]int64{
+				"direct_cache_hit":        120,
+				"preprocessed_cache_hit":  30,
+				"cache_miss":              100,
+				"stats_updated_timestamp": 1708110000,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			tc.want.updateDerivedFields()
+
+			got := MergeStatistics(tc.input...)
+
+			assertStatisticsEqual(t, got, &tc.want)
+			assertTimeFieldEquals(t, "StatsTime", got.StatsTime, tc.wantStatsTime)
+			assertTimeFieldEquals(t, "StatsZeroTime", got.StatsZeroTime, tc.wantStatsZeroTime)
+			assertCountersEqual(t, got.Counters, tc.wantCounters)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+// uncacheableCounters lists the counters of calls that cannot be cached, as
+// flagged by ccache.
+//
+// See https://github.com/ccache/ccache/blob/master/src/ccache/core/statistics.cpp
+var uncacheableCounters = []string{
+	"autoconf_test",
+	"bad_compiler_arguments",
+	"called_for_link",
+	"called_for_preprocessing",
+	"compile_failed",
+	"compiler_produced_empty_output",
+	"compiler_produced_no_output",
+	"compiler_produced_stdout",
+	"could_not_use_modules",
+	"could_not_use_precompiled_header",
+	"disabled",
+	"multiple_source_files",
+	"no_input_file",
+	"output_to_stdout",
+	"preprocessor_error",
+	"recache",
+	"unsupported_code_directive",
+	"unsupported_compiler_option",
+	"unsupported_environment_variable",
+	"unsupported_source_language",
+}
+
+// errorCounters lists the counters of calls that failed because of an error,
+// as flagged by ccache.
+var errorCounters = []string{
+	"bad_input_file",
+	"bad_output_file",
+	"compiler_check_failed",
+	"could_not_find_compiler",
+	"error_hashing_extra_file",
+	"internal_error",
+	"missing_cache_file",
+	"modified_input_file",
+}
+
+// Calls returns the total number of ccache calls, i.e. the sum of cacheable
+// calls, uncacheable calls and errors.
+//
+// Calls, hits and misses are computed in the same way for ccache 3.x and 4.x:
+// the hit and miss counters have kept their meaning, and the counters that a
+// version does not report are zero, so that they do not add to the sums.
+func (s *Statistics) Calls() int64 {
+	return s.CacheableCalls() + s.UncacheableCalls() + s.Errors()
+}
+
+// CacheableCalls returns the number of calls that resulted in a cache hit or
+// miss.
+func (s *Statistics) CacheableCalls() int64 {
+	return s.Hits() + s.Misses()
+}
+
+// UncacheableCalls returns the number of calls that could not be cached, e.g.
+// calls for linking or calls with unsupported compiler options.
+func (s *Statistics) UncacheableCalls() int64 {
+	return s.sumCounters(uncacheableCounters)
+}
+
+// Errors returns the number of calls that failed because of an error.
+func (s *Statistics) Errors() int64 {
+	return s.sumCounters(errorCounters)
+}
+
+// Hits returns the number of cache hits, in direct or preprocessor mode.
+func (s *Statistics) Hits() int64 {
+	return s.CacheHitDirect + s.CacheHitPreprocessed
+}
+
+// Misses returns the number of cache misses.
+//
+// Since ccache 4.0, direct and preprocessed misses are also counted, but are
+// not additional misses: a call missing in direct mode may then hit or miss in
+// preprocessor mode.
+func (s *Statistics) Misses() int64 {
+	return s.CacheMiss
+}
+
+// CacheableCallsRatio returns the ratio of cacheable calls to all calls.
+func (s *Statistics) CacheableCallsRatio() float64 {
+	return ratio(s.CacheableCalls(), s.Calls())
+}
+
+// UncacheableCallsRatio returns the ratio of uncacheable calls to all calls.
+func (s *Statistics) UncacheableCallsRatio() float64 {
+	return ratio(s.UncacheableCalls(), s.Calls())
+}
+
+// ErrorsRatio returns the ratio of errors to all calls.
+func (s *Statistics) ErrorsRatio() float64 {
+	return ratio(s.Errors(), s.Calls())
+}
+
+// HitRatio returns the ratio of cache hits to cacheable calls.
+//
+// This is the "cache hit rate" printed by ccache < 4.0, and the ratio of
+// "Hits" printed by ccache >= 4.0.
+func (s *Statistics) HitRatio() float64 {
+	return ratio(s.Hits(), s.CacheableCalls())
+}
+
+// MissRatio returns the ratio of cache misses to cacheable calls.
+func (s *Statistics) MissRatio() float64 {
+	return ratio(s.Misses(), s.CacheableCalls())
+}
+
+// DirectHitRatio returns the ratio of direct mode hits to cache hits.
+func (s *Statistics) DirectHitRatio() float64 {
+	return ratio(s.CacheHitDirect, s.Hits())
+}
+
+// PreprocessedHitRatio returns the ratio of preprocessor mode hits to cache
+// hits.
+func (s *Statistics) PreprocessedHitRatio() float64 {
+	return ratio(s.CacheHitPreprocessed, s.Hits())
+}
+
+// LocalStorageHitRatio returns the ratio of local storage hits to local storage
+// lookups (ccache >= 4.4).
+func (s *Statistics) LocalStorageHitRatio() float64 {
+	return ratio(s.LocalStorageHit, s.LocalStorageHit+s.LocalStorageMiss)
+}
+
+// RemoteStorageHitRatio returns the ratio of remote storage hits to remote
+// storage lookups (ccache >= 4.4).
+func (s *Statistics) RemoteStorageHitRatio() float64 {
+	return ratio(s.RemoteStorageHit, s.RemoteStorageHit+s.RemoteStorageMiss)
+}
+
+func (s *Statistics) sumCounters(keys []string) int64 {
+	var sum int64
+
+	for _, key := range keys {
+		sum += *s.counter(key)
+	}
+
+	return sum
+}
+
+func ratio(count, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(count) / float64(total)
+}
@@ -0,0 +1,210 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// humanReadableFractionRegex matches a line of `ccache --show-stats` output
+// (ccache >= 4.0) with an optional total and percentage, e.g.
+// "  Hits:             118 / 294 (40.14%)".
+var humanReadableFractionRegex = regexp.MustCompile(`^\s*([A-Za-z ]+):\s+(\d+)(?:\s*/\s*(\d+)\s*\(\s*(\d+(?:\.\d+)?)%\))?$`)
+
+// pre37HitRateRegex matches the cache hit rate printed by ccache < 3.7.
+var pre37HitRateRegex = regexp.MustCompile(`cache hit rate\s+(\d+(?:\.\d+)?) %`)
+
+// derivedValue returns a count, a total and the corresponding ratio computed by
+// Statistics methods.
+type derivedValue func(s *Statistics) (int64, int64, float64)
+
+// humanReadableDerivedValues maps human-readable sections and labels to the
+// corresponding Statistics methods.
+var humanReadableDerivedValues = map[string]map[string]derivedValue{
+	"": {
+		"Cacheable calls": func(s *Statistics) (int64, int64, float64) {
+			return s.CacheableCalls(), s.Calls(), s.CacheableCallsRatio()
+		},
+		"Hits": func(s *Statistics) (int64, int64, float64) {
+			return s.Hits(), s.CacheableCalls(), s.HitRatio()
+		},
+		"Direct": func(s *Statistics) (int64, int64, float64) {
+			return s.CacheHitDirect, s.Hits(), s.DirectHitRatio()
+		},
+		"Preprocessed": func(s *Statistics) (int64, int64, float64) {
+			return s.CacheHitPreprocessed, s.Hits(), s.PreprocessedHitRatio()
+		},
+		"Misses": func(s *Statistics) (int64, int64, float64) {
+			return s.Misses(), s.CacheableCalls(), s.MissRatio()
+		},
+		"Uncacheable calls": func(s *Statistics) (int64, int64, float64) {
+			return s.UncacheableCalls(), s.Calls(), s.UncacheableCallsRatio()
+		},
+		"Errors": func(s *Statistics) (int64, int64, float64) {
+			return s.Errors(), s.Calls(), s.ErrorsRatio()
+		},
+	},
+	"Local storage": {
+		"Hits": func(s *Statistics) (int64, int64, float64) {
+			return s.LocalStorageHit, s.LocalStorageHit + s.LocalStorageMiss, s.LocalStorageHitRatio()
+		},
+		"Misses": func(s *Statistics) (int64, int64, float64) {
+			total := s.LocalStorageHit + s.LocalStorageMiss
+			return s.LocalStorageMiss, total, ratio(s.LocalStorageMiss, total)
+		},
+	},
+	"Remote storage": {
+		"Hits": func(s *Statistics) (int64, int64, float64) {
+			return s.RemoteStorageHit, s.RemoteStorageHit + s.RemoteStorageMiss, s.RemoteStorageHitRatio()
+		},
+		"Misses": func(s *Statistics) (int64, int64, float64) {
+			total := s.RemoteStorageHit + s.RemoteStorageMiss
+			return s.RemoteStorageMiss, total, ratio(s.RemoteStorageMiss, total)
+		},
+	},
+}
+
+func TestStatisticsDerivedValuesMatchHumanReadable(t *testing.T) {
+	tsvFilepaths, err := filepath.Glob(filepath.Join("testdata", "*", "*.tsv"))
+	if err != nil {
+		t.Fatalf("failed to list test inputs: %q", err)
+	}
+
+	checked := 0
+
+	for _, tsvFilepath := range tsvFilepaths {
+		humanFilepath := strings.TrimSuffix(tsvFilepath, ".tsv")
+
+		if _, err := os.Stat(humanFilepath); err != nil {
+			continue
+		}
+
+		checked++
+
+		t.Run(humanFilepath, func(t *testing.T) {
+			tsvInput, err := os.ReadFile(tsvFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			stats, err := ParseTSVStatistics(string(tsvInput))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			humanInput, err := os.ReadFile(humanFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			section := ""
+			scanner := bufio.NewScanner(strings.NewReader(string(humanInput)))
+
+			for scanner.Scan() {
+				line := scanner.Text()
+
+				if !strings.HasPrefix(line, " ") && strings.HasSuffix(line, ":") {
+					section = strings.TrimSuffix(line, ":")
+					continue
+				}
+
+				if !strings.HasPrefix(line, " ") {
+					section = ""
+				}
+
+				matches := humanReadableFractionRegex.FindStringSubmatch(line)
+				if matches == nil {
+					continue
+				}
+
+				derive, ok := humanReadableDerivedValues[section][matches[1]]
+				if !ok {
+					continue
+				}
+
+				count, total, gotRatio := derive(stats)
+
+				wantCount, _ := strconv.ParseInt(matches[2], 10, 64)
+				assertIntFieldEquals(t, section+" "+matches[1], count, wantCount)
+
+				if matches[3] == "" {
+					continue
+				}
+
+				wantTotal, _ := strconv.ParseInt(matches[3], 10, 64)
+				assertIntFieldEquals(t, section+" "+matches[1]+" (total)", total, wantTotal)
+
+				wantPercentage, _ := strconv.ParseFloat(matches[4], 64)
+				assertFloatFieldAlmostEquals(t, section+" "+matches[1]+" (%)", 100*gotRatio, wantPercentage)
+			}
+		})
+	}
+
+	if checked == 0 {
+		t.Fatal("no human-readable test input found")
+	}
+}
+
+func TestStatisticsHitRatioMatchesPre37HitRate(t *testing.T) {
+	inputFilepaths, err := filepath.Glob(filepath.Join("testdata", "*-ccache-3.[3-6]*", "*build"))
+	if err != nil {
+		t.Fatalf("failed to list test inputs: %q", err)
+	}
+
+	if len(inputFilepaths) == 0 {
+		t.Fatal("no pre-3.7 test input found")
+	}
+
+	for _, inputFilepath := range inputFilepaths {
+		t.Run(inputFilepath, func(t *testing.T) {
+			input, err := os.ReadFile(inputFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			matches := pre37HitRateRegex.FindStringSubmatch(string(input))
+			if matches == nil {
+				t.Fatal("no cache hit rate found")
+			}
+
+			wantRate, _ := strconv.ParseFloat(matches[1], 64)
+
+			stats, err := ParsePre37Statistics(string(input))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertFloatFieldAlmostEquals(t, "HitRatio (%)", 100*stats.HitRatio(), wantRate)
+			assertFloatFieldAlmostEquals(t, "CacheHitRate", stats.CacheHitRate, wantRate)
+		})
+	}
+}
+
+func TestStatisticsDerivedValuesWithNoCalls(t *testing.T) {
+	stats := &Statistics{}
+
+	ratios := map[string]float64{
+		"CacheableCallsRatio":   stats.CacheableCallsRatio(),
+		"UncacheableCallsRatio": stats.UncacheableCallsRatio(),
+		"ErrorsRatio":           stats.ErrorsRatio(),
+		"HitRatio":              stats.HitRatio(),
+		"MissRatio":             stats.MissRatio(),
+		"DirectHitRatio":        stats.DirectHitRatio(),
+		"PreprocessedHitRatio":  stats.PreprocessedHitRatio(),
+		"LocalStorageHitRatio":  stats.LocalStorageHitRatio(),
+		"RemoteStorageHitRatio": stats.RemoteStorageHitRatio(),
+	}
+
+	for name, got := range ratios {
+		if got != 0 {
+			t.Errorf("%s: want 0, got %f", name, got)
+		}
+	}
+}
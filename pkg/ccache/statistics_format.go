@@ -0,0 +1,257 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StatisticsFormat represents a format in which statistics can be decoded.
+type StatisticsFormat string
+
+const (
+	// StatisticsFormatTSV is the tab-separated output of `ccache --print-stats`
+	// (ccache >= 3.7).
+	StatisticsFormatTSV StatisticsFormat = "tsv"
+
+	// StatisticsFormatPre37 is the output of `ccache --show-stats`
+	// (ccache < 3.7).
+	StatisticsFormatPre37 StatisticsFormat = "pre-3.7"
+
+	// StatisticsFormatHumanReadable is the human-readable output of
+	// `ccache --show-stats` (ccache >= 4.0).
+	StatisticsFormatHumanReadable StatisticsFormat = "human"
+
+	// StatisticsFormatJSON is the output of `ccache --print-stats --format=json`
+	// (ccache >= 4.10).
+	StatisticsFormatJSON StatisticsFormat = "json"
+
+	// StatisticsFormatStatistics is the JSON encoding of Statistics, as
+	// printed by the `ccacheparser` command.
+	StatisticsFormatStatistics StatisticsFormat = "statistics"
+)
+
+var (
+	ErrStatisticsFormatUnknown error = errors.New("statistics: unknown format")
+)
+
+var (
+	tsvLineRegex            = regexp.MustCompile(`^\w+\t`)
+	pre37LabelRegex         = regexp.MustCompile(`(?m)^(cache directory|cache hit \(direct\)|cache miss|cache size|files in cache|stats zero(ed| time))\s{2,}`)
+	humanReadableLabelRegex = regexp.MustCompile(`(?m)^[A-Z][A-Za-z ]+:(\s|$)`)
+)
+
+// StatisticsDecoder decodes statistics from text.
+type StatisticsDecoder func(text string) (*Statistics, error)
+
+// statisticsParsers maps each supported format to its parser.
+var statisticsParsers = map[StatisticsFormat]func(p *parseState, text string) (*Statistics, error){
+	StatisticsFormatTSV:           parseTSVStatistics,
+	StatisticsFormatPre37:         parsePre37Statistics,
+	StatisticsFormatHumanReadable: parseHumanReadableStatistics,
+	StatisticsFormatJSON:          parseJSONStatistics,
+	StatisticsFormatStatistics:    parseStatisticsJSON,
+}
+
+// StatisticsEncoder encodes statistics as text.
+type StatisticsEncoder func(stats *Statistics) string
+
+// statisticsEncoders maps the formats printed by ccache to their encoder.
+var statisticsEncoders = map[StatisticsFormat]StatisticsEncoder{
+	StatisticsFormatTSV:           FormatTSVStatistics,
+	StatisticsFormatPre37:         FormatPre37Statistics,
+	StatisticsFormatHumanReadable: FormatHumanReadableStatistics,
+	StatisticsFormatJSON:          FormatJSONStatistics,
+}
+
+// StatisticsFormats returns the names of the supported statistics formats.
+func StatisticsFormats() []StatisticsFormat {
+	formats := make([]StatisticsFormat, 0, len(statisticsParsers))
+
+	for format := range statisticsParsers {
+		formats = append(formats, format)
+	}
+
+	sort.Slice(formats, func(i, j int) bool {
+		return formats[i] < formats[j]
+	})
+
+	return formats
+}
+
+// StatisticsDecoderFor returns the decoder for the given statistics format.
+func StatisticsDecoderFor(format StatisticsFormat) (StatisticsDecoder, error) {
+	if _, ok := statisticsParsers[format]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrStatisticsFormatUnknown, format)
+	}
+
+	decoder := func(text string) (*Statistics, error) {
+		stats, _, err := ParseStatisticsWithMode(format, ParseModeDefault, text)
+		return stats, err
+	}
+
+	return decoder, nil
+}
+
+// StatisticsEncoderFor returns the encoder for the given statistics format.
+//
+// Statistics can be encoded in the formats printed by ccache; use
+// encoding/json to encode them in the StatisticsFormatStatistics format.
+func StatisticsEncoderFor(format StatisticsFormat) (StatisticsEncoder, error) {
+	encoder, ok := statisticsEncoders[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrStatisticsFormatUnknown, format)
+	}
+
+	return encoder, nil
+}
+
+// DetectStatisticsFormat determines the format of statistics from the text
+// alone.
+func DetectStatisticsFormat(text string) (StatisticsFormat, error) {
+	if err := checkOutputSize(text); err != nil {
+		return "", err
+	}
+
+	trimmed := strings.TrimSpace(text)
+
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		var jsonData map[string]json.RawMessage
+
+		if err := json.Unmarshal([]byte(trimmed), &jsonData); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrStatisticsFormatUnknown, err)
+		}
+
+		// ccache reports stats_updated_timestamp, never stats_time
+		if _, ok := jsonData["stats_time"]; ok {
+			return StatisticsFormatStatistics, nil
+		}
+
+		return StatisticsFormatJSON, nil
+
+	case tsvLineRegex.MatchString(trimmed):
+		return StatisticsFormatTSV, nil
+
+	case pre37LabelRegex.MatchString(trimmed):
+		return StatisticsFormatPre37, nil
+
+	case humanReadableLabelRegex.MatchString(trimmed):
+		return StatisticsFormatHumanReadable, nil
+	}
+
+	return "", ErrStatisticsFormatUnknown
+}
+
+// ParseStatistics reads ccache statistics in any supported format, detected
+// from the text.
+//
+// See DetectStatisticsFormat.
+func ParseStatistics(text string) (*Statistics, error) {
+	format, err := DetectStatisticsFormat(text)
+	if err != nil {
+		return &Statistics{}, err
+	}
+
+	return ParseStatisticsFormat(format, text)
+}
+
+// ParseStatisticsFormat reads ccache statistics in the given format.
+func ParseStatisticsFormat(format StatisticsFormat, text string) (*Statistics, error) {
+	if format == "" {
+		return &Statistics{}, fmt.Errorf("%w: %q", ErrStatisticsFormatUnknown, format)
+	}
+
+	stats, _, err := ParseStatisticsWithMode(format, ParseModeDefault, text)
+
+	return stats, err
+}
+
+// parseStatisticsJSON reads Statistics encoded as JSON.
+//
+// In lenient mode, fields holding a value of the wrong type are skipped; as
+// encoding/json stops reporting errors after the first one, only this one is
+// recorded as a warning.
+func parseStatisticsJSON(p *parseState, text string) (*Statistics, error) {
+	if err := checkOutputSize(text); err != nil {
+		return &Statistics{}, err
+	}
+
+	stats := &Statistics{}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	if p.mode == ParseModeStrict {
+		decoder.DisallowUnknownFields()
+	}
+
+	err := decoder.Decode(stats)
+
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case err == nil:
+
+	case errors.As(err, &typeErr):
+		if err := p.malformed(0, typeErr.Field, typeErr.Value, err); err != nil {
+			return &Statistics{}, err
+		}
+
+	case p.mode == ParseModeStrict && strings.HasPrefix(err.Error(), "json: unknown field "):
+		key := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &Statistics{}, p.unknown(0, key, "")
+
+	default:
+		return &Statistics{}, err
+	}
+
+	if err := checkOutputRows(len(stats.Counters)); err != nil {
+		return &Statistics{}, err
+	}
+
+	if err := removeInvalidCounterKeys(p, stats); err != nil {
+		return &Statistics{}, err
+	}
+
+	return stats, nil
+}
+
+// removeInvalidCounterKeys removes the counters whose key is not formatted as
+// those printed by ccache, which is an error in strict mode.
+func removeInvalidCounterKeys(p *parseState, stats *Statistics) error {
+	keys := make([]string, 0, len(stats.Counters))
+	for key := range stats.Counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if isValidStatisticsKey(key) {
+			continue
+		}
+
+		if err := p.unknown(0, key, strconv.FormatInt(stats.Counters[key], 10)); err != nil {
+			return err
+		}
+
+		delete(stats.Counters, key)
+	}
+
+	return nil
+}
+
+// FormatStatistics writes statistics in the given format.
+func FormatStatistics(format StatisticsFormat, stats *Statistics) (string, error) {
+	encoder, err := StatisticsEncoderFor(format)
+	if err != nil {
+		return "", err
+	}
+
+	return encoder(stats), nil
+}
@@ -0,0 +1,368 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/units"
+)
+
+// testdataStatisticsFormat returns the expected format of a statistics test
+// input, or an empty format if the file does not hold statistics.
+func testdataStatisticsFormat(inputFilepath string) StatisticsFormat {
+	pre37DirRegex := regexp.MustCompile(`-ccache-3\.[0-6]`)
+
+	switch {
+	case strings.HasSuffix(inputFilepath, ".tsv"):
+		return StatisticsFormatTSV
+	case strings.HasSuffix(inputFilepath, ".json"):
+		return StatisticsFormatJSON
+	case filepath.Base(inputFilepath) == "config":
+		return ""
+	case pre37DirRegex.MatchString(inputFilepath):
+		return StatisticsFormatPre37
+	default:
+		return StatisticsFormatHumanReadable
+	}
+}
+
+func TestDetectStatisticsFormat(t *testing.T) {
+	inputFilepaths, err := filepath.Glob(filepath.Join("testdata", "*-ccache-*", "*"))
+	if err != nil {
+		t.Fatalf("failed to list test inputs: %q", err)
+	}
+
+	checked := 0
+
+	for _, inputFilepath := range inputFilepaths {
+		if strings.Contains(inputFilepath, "cache-directory") {
+			continue
+		}
+
+		wantFormat := testdataStatisticsFormat(inputFilepath)
+		if wantFormat == "" {
+			continue
+		}
+
+		checked++
+
+		t.Run(inputFilepath, func(t *testing.T) {
+			input, err := os.ReadFile(inputFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			gotFormat, err := DetectStatisticsFormat(string(input))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			if gotFormat != wantFormat {
+				t.Errorf("want format %q, got %q", wantFormat, gotFormat)
+			}
+
+			decoder, err := StatisticsDecoderFor(wantFormat)
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			want, err := decoder(string(input))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			got, err := ParseStatistics(string(input))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertStatisticsEqual(t, got, want)
+			assertCountersEqual(t, got.Counters, want.Counters)
+		})
+	}
+
+	for _, format := range StatisticsFormats() {
+		// JSON is only captured for ccache >= 4.10, JSON detection is also
+		// covered by TestDetectStatisticsFormatEdgeCases
+		if format == StatisticsFormatStatistics || format == StatisticsFormatJSON {
+			continue
+		}
+
+		found := false
+
+		for _, inputFilepath := range inputFilepaths {
+			if testdataStatisticsFormat(inputFilepath) == format {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Errorf("no test input for format %q", format)
+		}
+	}
+
+	if checked == 0 {
+		t.Fatal("no test input found")
+	}
+}
+
+func TestParseStatisticsEncodedAsJSON(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "ubuntu-24.04-ccache-4.9.1", "secondbuild.tsv"))
+	if err != nil {
+		t.Fatalf("failed to open test input: %q", err)
+	}
+
+	want, err := ParseTSVStatistics(string(input))
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+
+	statsJSON, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("failed to encode statistics: %q", err)
+	}
+
+	gotFormat, err := DetectStatisticsFormat(string(statsJSON))
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+
+	if gotFormat != StatisticsFormatStatistics {
+		t.Errorf("want format %q, got %q", StatisticsFormatStatistics, gotFormat)
+	}
+
+	got, err := ParseStatistics(string(statsJSON))
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+
+	assertStatisticsEqual(t, got, want)
+	assertCountersEqual(t, got.Counters, want.Counters)
+	assertTimeFieldEquals(t, "StatsTime", got.StatsTime, want.StatsTime)
+	assertTimeFieldEquals(t, "StatsZeroTime", got.StatsZeroTime, want.StatsZeroTime)
+}
+
+func TestDetectStatisticsFormatEdgeCases(t *testing.T) {
+	cases := []struct {
+		tname      string
+		input      string
+		wantFormat StatisticsFormat
+		wantErr    error
+	}{
+		{
+			tname:      "TSV with a single counter",
+			input:      "cache_miss\t12\n",
+			wantFormat: StatisticsFormatTSV,
+		},
+		{
+			tname:      "pre-3.7 with leading blank lines",
+			input:      "\n\ncache hit (direct)                     0\n",
+			wantFormat: StatisticsFormatPre37,
+		},
+		{
+			tname:      "human-readable section heading",
+			input:      "Local storage:\n  Cache size (GB): 0.00 / 5.00 ( 0.00%)\n",
+			wantFormat: StatisticsFormatHumanReadable,
+		},
+		{
+			tname:      "ccache JSON",
+			input:      `{"cache_miss": 12}`,
+			wantFormat: StatisticsFormatJSON,
+		},
+
+		// error cases
+		{
+			tname:   "empty input",
+			input:   "",
+			wantErr: ErrStatisticsFormatUnknown,
+		},
+		{
+			tname:   "garbage",
+			input:   "lorem ipsum dolor sit amet\n",
+			wantErr: ErrStatisticsFormatUnknown,
+		},
+		{
+			tname:   "truncated JSON",
+			input:   `{"cache_miss": `,
+			wantErr: ErrStatisticsFormatUnknown,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			gotFormat, err := DetectStatisticsFormat(tc.input)
+
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("want error %q, got %q", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			if gotFormat != tc.wantFormat {
+				t.Errorf("want format %q, got %q", tc.wantFormat, gotFormat)
+			}
+		})
+	}
+}
+
+func TestParseStatisticsFormatUnknown(t *testing.T) {
+	_, err := ParseStatisticsFormat("xml", "<stats/>")
+
+	if !errors.Is(err, ErrStatisticsFormatUnknown) {
+		t.Fatalf("want error %q, got %q", ErrStatisticsFormatUnknown, err)
+	}
+}
+
+func TestFormatStatisticsRoundTrip(t *testing.T) {
+	inputFilepaths, err := filepath.Glob(filepath.Join("testdata", "*-ccache-*", "*"))
+	if err != nil {
+		t.Fatalf("failed to list test inputs: %q", err)
+	}
+
+	for _, inputFilepath := range inputFilepaths {
+		if strings.Contains(inputFilepath, "cache-directory") {
+			continue
+		}
+
+		format := testdataStatisticsFormat(inputFilepath)
+		if format == "" {
+			continue
+		}
+
+		t.Run(inputFilepath, func(t *testing.T) {
+			input, err := os.ReadFile(inputFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			want, err := ParseStatisticsFormat(format, string(input))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			output, err := FormatStatistics(format, want)
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			got, err := ParseStatisticsFormat(format, output)
+			if err != nil {
+				t.Fatalf("expected no error, got %q\n%s", err, output)
+			}
+
+			assertStatisticsEqual(t, got, want)
+			assertCountersEqual(t, got.Counters, want.Counters)
+			assertTimeFieldEquals(t, "StatsTime", got.StatsTime, want.StatsTime)
+			assertTimeFieldEquals(t, "StatsZeroTime", got.StatsZeroTime, want.StatsZeroTime)
+		})
+	}
+}
+
+func TestFormatStatisticsMachineReadableKeepsCounters(t *testing.T) {
+	inputFilepaths, err := filepath.Glob(filepath.Join("testdata", "*-ccache-*", "*"))
+	if err != nil {
+		t.Fatalf("failed to list test inputs: %q", err)
+	}
+
+	for _, inputFilepath := range inputFilepaths {
+		if strings.Contains(inputFilepath, "cache-directory") || testdataStatisticsFormat(inputFilepath) == "" {
+			continue
+		}
+
+		for _, format := range []StatisticsFormat{StatisticsFormatTSV, StatisticsFormatJSON} {
+			t.Run(fmt.Sprintf("%s as %s", inputFilepath, format), func(t *testing.T) {
+				input, err := os.ReadFile(inputFilepath)
+				if err != nil {
+					t.Fatalf("failed to open test input: %q", err)
+				}
+
+				want, err := ParseStatistics(string(input))
+				if err != nil {
+					t.Fatalf("expected no error, got %q", err)
+				}
+
+				output, err := FormatStatistics(format, want)
+				if err != nil {
+					t.Fatalf("expected no error, got %q", err)
+				}
+
+				got, err := ParseStatisticsFormat(format, output)
+				if err != nil {
+					t.Fatalf("expected no error, got %q", err)
+				}
+
+				for key := range statisticsCounters {
+					assertIntFieldEquals(t, key, got.counterValue(key), want.counterValue(key))
+				}
+
+				assertFloatFieldAlmostEquals(t, "CacheHitRatio", got.CacheHitRatio, want.CacheHitRatio)
+				assertMetricByteFieldEquals(t, "CacheSizeBytes", got.CacheSizeBytes, want.CacheSizeBytes/1024*1024)
+				assertMetricByteFieldEquals(t, "MaxCacheSizeBytes", got.MaxCacheSizeBytes, want.MaxCacheSizeBytes/1024*1024)
+			})
+		}
+	}
+}
+
+func TestFormatStatisticsWithoutCounters(t *testing.T) {
+	want := &Statistics{
+		CacheHitDirect:       116,
+		CacheHitPreprocessed: 2,
+		CacheMiss:            176,
+		CalledForLink:        70,
+		CouldNotFindCompiler: 1,
+		FilesInCache:         350,
+		CacheSizeBytes:       units.MetricBytes(2 * units.GiB),
+		MaxCacheSizeBytes:    units.MetricBytes(5 * units.GiB),
+		LocalStorageHit:      118,
+		LocalStorageMiss:     176,
+		RemoteStorageHit:     5,
+		RemoteStorageMiss:    5,
+		RemoteStorageTimeout: 1,
+	}
+
+	for _, format := range []StatisticsFormat{StatisticsFormatTSV, StatisticsFormatJSON, StatisticsFormatHumanReadable} {
+		t.Run(string(format), func(t *testing.T) {
+			output, err := FormatStatistics(format, want)
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			got, err := ParseStatisticsFormat(format, output)
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			for key := range statisticsCounters {
+				assertIntFieldEquals(t, key, got.counterValue(key), want.counterValue(key))
+			}
+
+			assertFloatFieldAlmostEquals(t, "CacheHitRatio", got.CacheHitRatio, want.HitRatio())
+			assertMetricByteFieldEquals(t, "CacheSizeBytes", got.CacheSizeBytes, want.CacheSizeBytes)
+			assertMetricByteFieldEquals(t, "MaxCacheSizeBytes", got.MaxCacheSizeBytes, want.MaxCacheSizeBytes)
+		})
+	}
+}
+
+func TestFormatStatisticsFormatUnknown(t *testing.T) {
+	_, err := FormatStatistics(StatisticsFormatStatistics, &Statistics{})
+
+	if !errors.Is(err, ErrStatisticsFormatUnknown) {
+		t.Fatalf("want error %q, got %q", ErrStatisticsFormatUnknown, err)
+	}
+}
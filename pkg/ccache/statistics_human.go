@@ -0,0 +1,595 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+const (
+	humanReadableTimeLayout = "Mon Jan _2 15:04:05 2006"
+)
+
+var (
+	ErrStatisticsValueInvalid error = errors.New("statistics: invalid value")
+)
+
+var (
+	humanReadableLineRegex     = regexp.MustCompile(`^( *)([^:]+):\s*(.*)$`)
+	humanReadableCountRegex    = regexp.MustCompile(`^(\d+)(?:\s*/\s*(\d+))?`)
+	humanReadableSizeRegex     = regexp.MustCompile(`^(\d+(?:\.\d+)?)(?:\s*/\s*(\d+(?:\.\d+)?))?`)
+	humanReadableSizeUnitRegex = regexp.MustCompile(`^Cache size \((\w+)\)$`)
+)
+
+// humanReadableCounters maps the descriptions of uncacheable calls and errors,
+// as printed by `ccache --show-stats` (ccache >= 4.0), to counter keys.
+var humanReadableCounters = map[string]string{
+	"Autoconf compile/link":                  "autoconf_test",
+	"Bad compiler arguments":                 "bad_compiler_arguments",
+	"Called for linking":                     "called_for_link",
+	"Called for preprocessing":               "called_for_preprocessing",
+	"Ccache disabled":                        "disabled",
+	"Compilation failed":                     "compile_failed",
+	"Compiler check failed":                  "compiler_check_failed",
+	"Compiler output file missing":           "compiler_produced_no_output",
+	"Compiler produced empty output":         "compiler_produced_empty_output",
+	"Compiler produced stdout":               "compiler_produced_stdout",
+	"Could not find compiler":                "could_not_find_compiler",
+	"Could not read or parse input file":     "bad_input_file",
+	"Could not use modules":                  "could_not_use_modules",
+	"Could not use precompiled header":       "could_not_use_precompiled_header",
+	"Could not write to output file":         "bad_output_file",
+	"Error hashing extra file":               "error_hashing_extra_file",
+	"Forced recache":                         "recache",
+	"Input file modified during compilation": "modified_input_file",
+	"Internal error":                         "internal_error",
+	"Missing cache file":                     "missing_cache_file",
+	"Multiple source files":                  "multiple_source_files",
+	"No input file":                          "no_input_file",
+	"Output to stdout":                       "output_to_stdout",
+	"Preprocessing failed":                   "preprocessor_error",
+	"Unsupported code directive":             "unsupported_code_directive",
+	"Unsupported compiler option":            "unsupported_compiler_option",
+	"Unsupported environment variable":       "unsupported_environment_variable",
+	"Unsupported source language":            "unsupported_source_language",
+}
+
+// humanReadableSections lists the section headings printed by
+// `ccache --show-stats` (ccache >= 4.0).
+var humanReadableSections = []string{
+	"Cacheable calls",
+	"Errors",
+	"Local storage",
+	"Remote storage",
+	"Successful lookups",
+	"Uncacheable calls",
+}
+
+// humanReadableStorageCounters maps the local and remote storage entries, as
+// printed by `ccache --show-stats` (ccache >= 4.0), to counter key suffixes.
+//
+// The "Reads" entry is the sum of read hits and misses, and cannot be mapped
+// to a single counter.
+var humanReadableStorageCounters = map[string]string{
+	"Errors":   "error",
+	"Hits":     "hit",
+	"Misses":   "miss",
+	"Timeouts": "timeout",
+	"Writes":   "write",
+}
+
+// ParseHumanReadableStatistics reads ccache statistics as formatted by the
+// `ccache --show-stats` command, for ccache 4.0 and above.
+//
+// The verbose outputs of `ccache --show-stats -v` and `ccache --show-stats -vv`
+// are supported, and provide more details than the default output.
+//
+// Timestamps are assumed to be expressed in the local time zone.
+func ParseHumanReadableStatistics(text string) (*Statistics, error) {
+	return parseHumanReadableStatistics(newParseState(StatisticsFormatHumanReadable, ParseModeDefault), text)
+}
+
+func parseHumanReadableStatistics(p *parseState, text string) (*Statistics, error) {
+	stats := &Statistics{}
+
+	var section string
+
+	scanner := newOutputScanner(text)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		matches := humanReadableLineRegex.FindStringSubmatch(line)
+		if len(matches) != 4 {
+			if err := p.invalidLine(lineNumber, line); err != nil {
+				return &Statistics{}, err
+			}
+			continue
+		}
+
+		p.entries++
+
+		indent := len(matches[1])
+		label := matches[2]
+		value := strings.TrimSpace(matches[3])
+
+		if indent == 0 {
+			section = label
+		}
+
+		// key is the counter key of the entry, or its label if it has none
+		key := label
+		known := true
+
+		var err error
+
+		switch {
+		case indent == 0 && label == "Cache directory":
+			stats.CacheDirectory = value
+
+		case indent == 0 && label == "Config file":
+			stats.PrimaryConfig = value
+
+		case indent == 0 && label == "System config file":
+			stats.SecondaryConfig = value
+
+		case indent == 0 && label == "Stats updated":
+			key = "stats_updated_timestamp"
+
+			var statsTime time.Time
+			if statsTime, err = parseHumanReadableTime(value, p.location); err == nil {
+				stats.StatsTime = statsTime
+			}
+
+		case indent == 0 && label == "Stats zeroed":
+			key = "stats_zeroed_timestamp"
+
+			var statsZeroTime time.Time
+			if statsZeroTime, err = parseHumanReadableTime(value, p.location); err == nil {
+				stats.StatsZeroTime = statsZeroTime
+			}
+
+		case indent == 0:
+			// section heading
+			known = slices.Contains(humanReadableSections, label)
+
+		case section == "Cacheable calls":
+			switch {
+			case indent == 2 && label == "Hits":
+				// derived from direct and preprocessed hits
+				_, _, err = parseHumanReadableCount(value)
+			case indent == 4 && label == "Direct":
+				key = "direct_cache_hit"
+			case indent == 4 && label == "Preprocessed":
+				key = "preprocessed_cache_hit"
+			case indent == 2 && label == "Misses":
+				key = "cache_miss"
+			default:
+				known = false
+			}
+
+			if known && key != label {
+				var count int64
+				if count, _, err = parseHumanReadableCount(value); err == nil {
+					stats.setCounter(key, count)
+				}
+			}
+
+		case section == "Uncacheable calls", section == "Errors":
+			counterKey, ok := humanReadableCounters[label]
+			if !ok {
+				known = false
+				break
+			}
+			key = counterKey
+
+			var count int64
+			if count, _, err = parseHumanReadableCount(value); err == nil {
+				stats.setCounter(key, count)
+			}
+
+		case section == "Successful lookups":
+			switch label {
+			case "Direct":
+				key = "direct_cache_miss"
+			case "Preprocessed":
+				key = "preprocessed_cache_miss"
+			default:
+				known = false
+			}
+
+			if known {
+				var hits, lookups int64
+				if hits, lookups, err = parseHumanReadableCount(value); err == nil {
+					stats.setCounter(key, lookups-hits)
+				}
+			}
+
+		case section == "Local storage" && strings.HasPrefix(label, "Cache size"):
+			key = "cache_size_kibibyte"
+			err = parseHumanReadableCacheSize(stats, label, value)
+
+		case section == "Local storage" && label == "Files":
+			key = "files_in_cache"
+
+			var files, maxFiles int64
+			if files, maxFiles, err = parseHumanReadableCount(value); err == nil {
+				stats.setCounter("files_in_cache", files)
+				stats.setCounter("max_files_in_cache", maxFiles)
+			}
+
+		case section == "Local storage" && label == "Cleanups":
+			key = "cleanups_performed"
+
+			var count int64
+			if count, _, err = parseHumanReadableCount(value); err == nil {
+				stats.setCounter(key, count)
+			}
+
+		case (section == "Local storage" || section == "Remote storage") && label == "Reads":
+			// sum of read hits and misses
+			_, _, err = parseHumanReadableCount(value)
+
+		case section == "Local storage", section == "Remote storage":
+			suffix, ok := humanReadableStorageCounters[label]
+			if !ok {
+				known = false
+				break
+			}
+
+			key = "local_storage_" + suffix
+			if section == "Remote storage" {
+				key = "remote_storage_" + suffix
+			}
+
+			var count int64
+			if count, _, err = parseHumanReadableCount(value); err == nil {
+				stats.setCounter(key, count)
+			}
+
+		default:
+			known = false
+		}
+
+		if !known {
+			if err := p.unknown(lineNumber, label, value); err != nil {
+				return &Statistics{}, err
+			}
+			continue
+		}
+
+		if err != nil {
+			if err := p.malformed(lineNumber, key, value, err); err != nil {
+				return &Statistics{}, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return &Statistics{}, err
+	}
+
+	if err := p.noEntry(); err != nil {
+		return &Statistics{}, err
+	}
+
+	stats.updateRatios()
+
+	return stats, nil
+}
+
+// parseHumanReadableCount parses a count, optionally followed by a total and a
+// percentage, e.g. "118 / 294 (40.14%)".
+//
+// If the total is missing, it is returned as 0.
+func parseHumanReadableCount(value string) (int64, int64, error) {
+	matches := humanReadableCountRegex.FindStringSubmatch(value)
+	if len(matches) != 3 {
+		return 0, 0, fmt.Errorf("%w: %q", ErrStatisticsValueInvalid, value)
+	}
+
+	count, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if matches[2] == "" {
+		return count, 0, nil
+	}
+
+	total, err := strconv.ParseInt(matches[2], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return count, total, nil
+}
+
+// parseHumanReadableCacheSize parses the local cache size and maximum size,
+// e.g. "Cache size (GiB): 0.1 / 5.0 ( 1.48%)".
+func parseHumanReadableCacheSize(stats *Statistics, label string, value string) error {
+	unitMatches := humanReadableSizeUnitRegex.FindStringSubmatch(label)
+	if len(unitMatches) != 2 {
+		return fmt.Errorf("%w: %q", ErrStatisticsValueInvalid, label)
+	}
+	unit := unitMatches[1]
+
+	matches := humanReadableSizeRegex.FindStringSubmatch(value)
+	if len(matches) != 3 {
+		return fmt.Errorf("%w: %q", ErrStatisticsValueInvalid, value)
+	}
+
+	cacheSize := matches[1] + " " + unit
+
+	cacheSizeBytes, err := ParseSize(cacheSize)
+	if err != nil {
+		return err
+	}
+
+	if matches[2] != "" {
+		maxCacheSize := matches[2] + " " + unit
+
+		maxCacheSizeBytes, err := ParseSize(maxCacheSize)
+		if err != nil {
+			return err
+		}
+
+		stats.MaxCacheSize = maxCacheSize
+		stats.MaxCacheSizeBytes = maxCacheSizeBytes
+	}
+
+	stats.CacheSize = cacheSize
+	stats.CacheSizeBytes = cacheSizeBytes
+
+	return nil
+}
+
+func parseHumanReadableTime(value string, loc *time.Location) (time.Time, error) {
+	if value == "never" {
+		return time.Time{}, nil
+	}
+
+	return time.ParseInLocation(humanReadableTimeLayout, value, loc)
+}
+
+// FormatHumanReadableStatistics writes statistics as formatted by the
+// `ccache --show-stats -vv` command, for ccache 4.0 and above.
+//
+// Zero counters are omitted; for parsed statistics, the counters found in the
+// input are printed. The cache size is printed in the unit of the parsed cache
+// size if any, in gibibytes otherwise. Timestamps are printed in the local time
+// zone.
+func FormatHumanReadableStatistics(stats *Statistics) string {
+	var sb strings.Builder
+
+	writeSection := func(label string) {
+		sb.WriteString(label + ":\n")
+	}
+
+	writeLine := func(indent int, label string, value string) {
+		fmt.Fprintf(&sb, "%s%-*s %s\n", strings.Repeat(" ", indent), 19-indent, label+":", value)
+	}
+
+	writeString := func(label string, value string) {
+		if value != "" {
+			writeLine(0, label, value)
+		}
+	}
+
+	writeTime := func(label string, value time.Time) {
+		if !value.IsZero() {
+			writeLine(0, label, value.Local().Format(humanReadableTimeLayout))
+		}
+	}
+
+	writeString("Cache directory", stats.CacheDirectory)
+	writeString("Config file", stats.PrimaryConfig)
+	writeString("System config file", stats.SecondaryConfig)
+	writeTime("Stats updated", stats.StatsTime)
+	writeTime("Stats zeroed", stats.StatsZeroTime)
+
+	if stats.reportsAnyCounter("direct_cache_hit", "preprocessed_cache_hit", "cache_miss") {
+		writeLine(0, "Cacheable calls", formatHumanReadableCount(stats.CacheableCalls(), stats.Calls()))
+		writeLine(2, "Hits", formatHumanReadableCount(stats.Hits(), stats.CacheableCalls()))
+		writeLine(4, "Direct", formatHumanReadableCount(stats.CacheHitDirect, stats.Hits()))
+		writeLine(4, "Preprocessed", formatHumanReadableCount(stats.CacheHitPreprocessed, stats.Hits()))
+		writeLine(2, "Misses", formatHumanReadableCount(stats.Misses(), stats.CacheableCalls()))
+	}
+
+	for _, section := range []struct {
+		label string
+		keys  []string
+		total int64
+	}{
+		{"Uncacheable calls", uncacheableCounters, stats.UncacheableCalls()},
+		{"Errors", errorCounters, stats.Errors()},
+	} {
+		if !stats.reportsAnyCounter(section.keys...) {
+			continue
+		}
+
+		writeLine(0, section.label, formatHumanReadableCount(section.total, stats.Calls()))
+
+		for _, label := range humanReadableCounterLabels(section.keys) {
+			key := humanReadableCounters[label]
+
+			if stats.reportsCounter(key) {
+				writeLine(2, label, formatHumanReadableCount(stats.counterValue(key), section.total))
+			}
+		}
+	}
+
+	if stats.reportsAnyCounter("direct_cache_miss", "preprocessed_cache_miss") {
+		writeSection("Successful lookups")
+
+		if stats.reportsCounter("direct_cache_miss") {
+			writeLine(2, "Direct", formatHumanReadableCount(stats.CacheHitDirect, stats.CacheHitDirect+stats.CacheMissDirect))
+		}
+
+		if stats.reportsCounter("preprocessed_cache_miss") {
+			writeLine(2, "Preprocessed", formatHumanReadableCount(stats.CacheHitPreprocessed, stats.CacheHitPreprocessed+stats.CacheMissPreprocessed))
+		}
+	}
+
+	hasCacheSize := stats.CacheSize != "" || stats.CacheSizeBytes != 0 || stats.MaxCacheSizeBytes != 0
+
+	if hasCacheSize || stats.reportsAnyCounter("files_in_cache", "cleanups_performed") || stats.reportsStorageCounters("local_storage_") {
+		writeSection("Local storage")
+
+		if hasCacheSize {
+			unit, size, maxSize := humanReadableCacheSize(stats)
+
+			value := size
+			if maxSize != "" {
+				value = size + " / " + maxSize + " (" + formatHumanReadablePercentage(int64(stats.CacheSizeBytes), int64(stats.MaxCacheSizeBytes)) + ")"
+			}
+
+			writeLine(2, "Cache size ("+unit+")", value)
+		}
+
+		if stats.reportsCounter("files_in_cache") {
+			writeLine(2, "Files", formatHumanReadableCount(stats.FilesInCache, stats.MaxFilesInCache))
+		}
+
+		if stats.reportsCounter("cleanups_performed") {
+			writeLine(2, "Cleanups", strconv.FormatInt(stats.CleanupsPerformed, 10))
+		}
+
+		writeHumanReadableStorageCounters(stats, "local_storage_", writeLine)
+	}
+
+	if stats.reportsStorageCounters("remote_storage_") {
+		writeSection("Remote storage")
+		writeHumanReadableStorageCounters(stats, "remote_storage_", writeLine)
+	}
+
+	return sb.String()
+}
+
+// writeHumanReadableStorageCounters writes the counters of a local or remote
+// storage section.
+func writeHumanReadableStorageCounters(stats *Statistics, prefix string, writeLine func(int, string, string)) {
+	hits := stats.counterValue(prefix + "hit")
+	misses := stats.counterValue(prefix + "miss")
+
+	if stats.reportsCounter(prefix + "hit") {
+		writeLine(2, "Hits", formatHumanReadableCount(hits, hits+misses))
+	}
+
+	if stats.reportsCounter(prefix + "miss") {
+		writeLine(2, "Misses", formatHumanReadableCount(misses, hits+misses))
+	}
+
+	if stats.reportsAnyCounter(prefix+"read_hit", prefix+"read_miss") {
+		reads := stats.counterValue(prefix+"read_hit") + stats.counterValue(prefix+"read_miss")
+		writeLine(2, "Reads", strconv.FormatInt(reads, 10))
+	}
+
+	for _, label := range []string{"Writes", "Errors", "Timeouts"} {
+		key := prefix + humanReadableStorageCounters[label]
+
+		if stats.reportsCounter(key) {
+			writeLine(2, label, strconv.FormatInt(stats.counterValue(key), 10))
+		}
+	}
+}
+
+// reportsStorageCounters returns whether any local or remote storage counter
+// would be reported by ccache.
+func (s *Statistics) reportsStorageCounters(prefix string) bool {
+	return s.reportsAnyCounter(
+		prefix+"error",
+		prefix+"hit",
+		prefix+"miss",
+		prefix+"read_hit",
+		prefix+"read_miss",
+		prefix+"timeout",
+		prefix+"write",
+	)
+}
+
+// reportsAnyCounter returns whether any of the given counters would be
+// reported by ccache.
+func (s *Statistics) reportsAnyCounter(keys ...string) bool {
+	for _, key := range keys {
+		if s.reportsCounter(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// humanReadableCounterLabels returns the sorted descriptions of the given
+// counters.
+func humanReadableCounterLabels(keys []string) []string {
+	labels := []string{}
+
+	for label, key := range humanReadableCounters {
+		if slices.Contains(keys, key) {
+			labels = append(labels, label)
+		}
+	}
+
+	sort.Strings(labels)
+
+	return labels
+}
+
+// humanReadableCacheSize returns the unit, cache size and maximum cache size to
+// print.
+//
+// Parsed sizes are printed as is if they share the same unit, to preserve
+// their precision.
+func humanReadableCacheSize(stats *Statistics) (string, string, string) {
+	size, unit, sizeFound := strings.Cut(stats.CacheSize, " ")
+	maxSize, maxUnit, maxSizeFound := strings.Cut(stats.MaxCacheSize, " ")
+
+	if sizeFound && humanReadableSizeRegex.MatchString(size) && (stats.MaxCacheSize == "" || maxSizeFound && maxUnit == unit) {
+		return unit, size, maxSize
+	}
+
+	size = fmt.Sprintf("%.1f", float64(stats.CacheSizeBytes)/float64(units.GiB))
+
+	if stats.MaxCacheSizeBytes == 0 {
+		return "GiB", size, ""
+	}
+
+	return "GiB", size, fmt.Sprintf("%.1f", float64(stats.MaxCacheSizeBytes)/float64(units.GiB))
+}
+
+// formatHumanReadableCount formats a count, followed by a total and a
+// percentage if the total is not zero, e.g. "118 / 294 (40.14%)".
+func formatHumanReadableCount(count, total int64) string {
+	if total == 0 {
+		return strconv.FormatInt(count, 10)
+	}
+
+	return fmt.Sprintf("%d / %d (%s)", count, total, formatHumanReadablePercentage(count, total))
+}
+
+// formatHumanReadablePercentage formats a percentage as done by ccache, e.g.
+// " 1.69%" or "100.0%".
+func formatHumanReadablePercentage(count, total int64) string {
+	if count == total {
+		return "100.0%"
+	}
+
+	return fmt.Sprintf("%5.2f%%", 100*ratio(count, total))
+}
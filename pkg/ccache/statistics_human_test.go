@@ -0,0 +1,417 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+type humanReadableTestCase struct {
+	tname         string
+	inputFilename string
+	wantStats     Statistics
+	wantErr       error
+}
+
+type humanReadableTestSession struct {
+	osAndVersion     string
+	osAndVersionCode string
+	ccacheVersion    string
+	redisVersion     string
+	testCases        []humanReadableTestCase
+}
+
+func TestParseHumanReadableStatistics(t *testing.T) {
+	sessions := []humanReadableTestSession{
+		{
+			osAndVersion:     "Debian 12",
+			osAndVersionCode: "debian-12",
+			ccacheVersion:    "4.7.5",
+
+			testCases: []humanReadableTestCase{
+				{
+					tname:         "empty cache",
+					inputFilename: "empty",
+					wantStats: Statistics{
+						CacheSize:         "0.00 GB",
+						MaxCacheSize:      "5.00 GB",
+						MaxCacheSizeBytes: units.MetricBytes(5000000000),
+					},
+				},
+				{
+					tname:         "first build",
+					inputFilename: "firstbuild",
+					wantStats: Statistics{
+						CacheMiss:         146,
+						CacheSize:         "0.02 GB",
+						CacheSizeBytes:    units.MetricBytes(20000000),
+						MaxCacheSize:      "5.00 GB",
+						MaxCacheSizeBytes: units.MetricBytes(5000000000),
+					},
+				},
+				{
+					tname:         "second build",
+					inputFilename: "secondbuild",
+					wantStats: Statistics{
+						CacheHitDirect:       109,
+						CacheHitPreprocessed: 2,
+						CacheMiss:            181,
+						CacheHitRate:         38.01,
+						CacheHitRatio:        0.3801,
+						CacheSize:            "0.03 GB",
+						CacheSizeBytes:       units.MetricBytes(30000000),
+						MaxCacheSize:         "5.00 GB",
+						MaxCacheSizeBytes:    units.MetricBytes(5000000000),
+					},
+				},
+			},
+		},
+		{
+			osAndVersion:     "Ubuntu 24.04",
+			osAndVersionCode: "ubuntu-24.04",
+			ccacheVersion:    "4.9.1",
+
+			testCases: []humanReadableTestCase{
+				{
+					tname:         "empty cache",
+					inputFilename: "empty",
+					wantStats: Statistics{
+						CacheSize:         "0.0 GiB",
+						MaxCacheSize:      "5.0 GiB",
+						MaxCacheSizeBytes: units.MetricBytes(5368709120),
+					},
+				},
+				{
+					tname:         "first build",
+					inputFilename: "firstbuild",
+					wantStats: Statistics{
+						CacheMiss:         147,
+						CacheSize:         "0.1 GiB",
+						CacheSizeBytes:    units.MetricBytes(107374182),
+						MaxCacheSize:      "5.0 GiB",
+						MaxCacheSizeBytes: units.MetricBytes(5368709120),
+						LocalStorageMiss:  147,
+					},
+				},
+				{
+					tname:         "second build",
+					inputFilename: "secondbuild",
+					wantStats: Statistics{
+						CacheHitDirect:       116,
+						CacheHitPreprocessed: 2,
+						CacheMiss:            176,
+						CacheHitRate:         40.14,
+						CacheHitRatio:        0.4014,
+						CacheSize:            "0.1 GiB",
+						CacheSizeBytes:       units.MetricBytes(107374182),
+						MaxCacheSize:         "5.0 GiB",
+						MaxCacheSizeBytes:    units.MetricBytes(5368709120),
+						LocalStorageHit:      118,
+						LocalStorageMiss:     176,
+					},
+				},
+			},
+		},
+		{
+			osAndVersion:     "Ubuntu 24.04",
+			osAndVersionCode: "ubuntu-24.04",
+			ccacheVersion:    "4.9.1",
+			redisVersion:     "7",
+
+			testCases: []humanReadableTestCase{
+				{
+					tname:         "empty cache",
+					inputFilename: "empty",
+					wantStats: Statistics{
+						CacheSize:         "0.0 GiB",
+						MaxCacheSize:      "5.0 GiB",
+						MaxCacheSizeBytes: units.MetricBytes(5368709120),
+					},
+				},
+				{
+					tname:         "first build",
+					inputFilename: "firstbuild",
+					wantStats: Statistics{
+						CacheMiss:         147,
+						CacheSize:         "0.0 GiB",
+						MaxCacheSize:      "5.0 GiB",
+						MaxCacheSizeBytes: units.MetricBytes(5368709120),
+						RemoteStorageMiss: 147,
+					},
+				},
+				{
+					tname:         "second build",
+					inputFilename: "secondbuild",
+					wantStats: Statistics{
+						CacheHitDirect:       116,
+						CacheHitPreprocessed: 2,
+						CacheMiss:            176,
+						CacheHitRate:         40.14,
+						CacheHitRatio:        0.4014,
+						CacheSize:            "0.0 GiB",
+						MaxCacheSize:         "5.0 GiB",
+						MaxCacheSizeBytes:    units.MetricBytes(5368709120),
+						RemoteStorageHit:     118,
+						RemoteStorageMiss:    176,
+					},
+				},
+			},
+		},
+	}
+
+	for _, ts := range sessions {
+		for _, tc := range ts.testCases {
+			testDir := fmt.Sprintf("%s-ccache-%s", ts.osAndVersionCode, ts.ccacheVersion)
+			tname := fmt.Sprintf("ccache %s on %s (%s)", ts.ccacheVersion, ts.osAndVersion, tc.tname)
+
+			if ts.redisVersion != "" {
+				testDir = fmt.Sprintf("%s-redis-%s", testDir, ts.redisVersion)
+				tname = fmt.Sprintf("ccache %s on %s using Redis %s (%s)", ts.ccacheVersion, ts.osAndVersion, ts.redisVersion, tc.tname)
+			}
+
+			t.Run(tname, func(t *testing.T) {
+				inputFilepath := filepath.Join("testdata", testDir, tc.inputFilename)
+				input, err := os.ReadFile(inputFilepath)
+				if err != nil {
+					t.Fatalf("failed to open test input: %q", err)
+				}
+
+				s, err := ParseHumanReadableStatistics(string(input))
+
+				if tc.wantErr != nil {
+					if err == nil {
+						t.Fatal("expected an error, got none")
+					} else if err.Error() != tc.wantErr.Error() {
+						t.Fatalf("want error %q, got %q", tc.wantErr, err)
+					}
+
+					return
+				}
+
+				if err != nil {
+					t.Fatalf("expected no error, got %q", err)
+				}
+
+				assertStatisticsEqual(t, s, &tc.wantStats)
+			})
+		}
+	}
+}
+
+func TestParseHumanReadableStatisticsVerbose(t *testing.T) {
+	cases := []struct {
+		tname             string
+		input             string
+		wantStats         Statistics
+		wantStatsTime     time.Time
+		wantStatsZeroTime time.Time
+	}{
+		{
+			tname: "verbose (-v)",
+			input: `Cache directory:    /home/cached/.ccache
+Config file:        /home/cached/.ccache/ccache.conf
+System config file: /etc/ccache.conf
+Stats updated:      Fri Feb 16 19:59:48 2024
+Cacheable calls:    294 / 414 (71.01%)
+  Hits:             118 / 294 (40.14%)
+    Direct:         116 / 118 (98.31%)
+    Preprocessed:     2 / 118 ( 1.69%)
+  Misses:           176 / 294 (59.86%)
+Uncacheable calls:  120 / 414 (28.99%)
+  Called for linking:  70 / 120 (58.33%)
+  Compilation failed:  14 / 120 (11.67%)
+  No input file:       30 / 120 (25.00%)
+  Preprocessing failed: 6 / 120 ( 5.00%)
+Local storage:
+  Cache size (GiB): 0.1 / 5.0 ( 1.49%)
+  Files:            350
+  Hits:             118 / 294 (40.14%)
+  Misses:           176 / 294 (59.86%)
+  Reads:            618
+  Writes:           350
+`,
+			wantStats: Statistics{
+				CacheDirectory:       "/home/cached/.ccache",
+				PrimaryConfig:        "/home/cached/.ccache/ccache.conf",
+				SecondaryConfig:      "/etc/ccache.conf",
+				CacheHitDirect:       116,
+				CacheHitPreprocessed: 2,
+				CacheMiss:            176,
+				CacheHitRate:         40.14,
+				CacheHitRatio:        0.4014,
+				CalledForLink:        70,
+				CompilationFailed:    14,
+				NoInputFile:          30,
+				PreprocessingFailed:  6,
+				FilesInCache:         350,
+				CacheSize:            "0.1 GiB",
+				CacheSizeBytes:       units.MetricBytes(107374182),
+				MaxCacheSize:         "5.0 GiB",
+				MaxCacheSizeBytes:    units.MetricBytes(5368709120),
+				LocalStorageHit:      118,
+				LocalStorageMiss:     176,
+				LocalStorageWrite:    350,
+			},
+			wantStatsTime: time.Date(2024, time.February, 16, 19, 59, 48, 0, time.Local),
+		},
+		{
+			tname: "very verbose (-vv)",
+			input: `Cache directory:    /home/cached/.ccache
+Config file:        /home/cached/.ccache/ccache.conf
+System config file: /etc/ccache.conf
+Stats updated:      Fri Feb 16 19:59:48 2024
+Stats zeroed:       Fri Feb  2 19:50:40 2024
+Cacheable calls:    294 / 414 (71.01%)
+  Hits:             118 / 294 (40.14%)
+    Direct:         116 / 118 (98.31%)
+    Preprocessed:     2 / 118 ( 1.69%)
+  Misses:           176 / 294 (59.86%)
+Uncacheable calls:  120 / 414 (28.99%)
+  Autoconf compile/link:                  0 / 120 ( 0.00%)
+  Bad compiler arguments:                 0 / 120 ( 0.00%)
+  Called for linking:                    70 / 120 (58.33%)
+  Called for preprocessing:               0 / 120 ( 0.00%)
+  Compilation failed:                    14 / 120 (11.67%)
+  No input file:                         30 / 120 (25.00%)
+  Preprocessing failed:                   6 / 120 ( 5.00%)
+  Unsupported code directive:             0 / 120 ( 0.00%)
+Errors:                                   1 / 414 ( 0.24%)
+  Could not find compiler:                1 /   1 (100.0%)
+  Internal error:                         0 /   1 ( 0.00%)
+Successful lookups:
+  Direct:           116 / 314 (36.94%)
+  Preprocessed:       2 / 192 ( 1.04%)
+Local storage:
+  Cache size (GiB): 0.1 / 5.0 ( 1.49%)
+  Files:            350 / 1000 (35.00%)
+  Cleanups:           3
+  Hits:             118 / 294 (40.14%)
+  Misses:           176 / 294 (59.86%)
+  Reads:            618
+  Writes:           350
+Remote storage:
+  Hits:               5 /  10 (50.00%)
+  Misses:             5 /  10 (50.00%)
+  Reads:             20
+  Writes:             7
+  Errors:             2
+  Timeouts:           1
+`,
+			wantStats: Statistics{
+				CacheDirectory:        "/home/cached/.ccache",
+				PrimaryConfig:         "/home/cached/.ccache/ccache.conf",
+				SecondaryConfig:       "/etc/ccache.conf",
+				CacheHitDirect:        116,
+				CacheHitPreprocessed:  2,
+				CacheMiss:             176,
+				CacheMissDirect:       198,
+				CacheMissPreprocessed: 190,
+				CacheHitRate:          40.14,
+				CacheHitRatio:         0.4014,
+				CalledForLink:         70,
+				CompilationFailed:     14,
+				NoInputFile:           30,
+				PreprocessingFailed:   6,
+				CouldNotFindCompiler:  1,
+				CleanupsPerformed:     3,
+				FilesInCache:          350,
+				MaxFilesInCache:       1000,
+				CacheSize:             "0.1 GiB",
+				CacheSizeBytes:        units.MetricBytes(107374182),
+				MaxCacheSize:          "5.0 GiB",
+				MaxCacheSizeBytes:     units.MetricBytes(5368709120),
+				LocalStorageHit:       118,
+				LocalStorageMiss:      176,
+				LocalStorageWrite:     350,
+				RemoteStorageHit:      5,
+				RemoteStorageMiss:     5,
+				RemoteStorageWrite:    7,
+				RemoteStorageError:    2,
+				RemoteStorageTimeout:  1,
+			},
+			wantStatsTime:     time.Date(2024, time.February, 16, 19, 59, 48, 0, time.Local),
+			wantStatsZeroTime: time.Date(2024, time.February, 2, 19, 50, 40, 0, time.Local),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			s, err := ParseHumanReadableStatistics(tc.input)
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertStatisticsEqual(t, s, &tc.wantStats)
+			assertTimeFieldEquals(t, "StatsTime", s.StatsTime, tc.wantStatsTime)
+			assertTimeFieldEquals(t, "StatsZeroTime", s.StatsZeroTime, tc.wantStatsZeroTime)
+		})
+	}
+}
+
+func TestParseHumanReadableStatisticsEdgeCases(t *testing.T) {
+	cases := []struct {
+		tname     string
+		input     string
+		wantStats Statistics
+		wantErr   error
+	}{
+		{
+			tname: "stats never updated",
+			input: `Stats updated:      never
+`,
+			wantStats: Statistics{},
+		},
+
+		// error cases
+		{
+			tname: "unexpected date format",
+			input: `Stats updated:      not a date
+`,
+			wantErr: errors.New("human: line 1: stats_updated_timestamp: parsing time \"not a date\" as \"Mon Jan _2 15:04:05 2006\": cannot parse \"not a date\" as \"Mon\""),
+		},
+		{
+			tname: "unexpected count",
+			input: `Cacheable calls:    294 / 414 (71.01%)
+  Misses:           many
+`,
+			wantErr: errors.New("human: line 2: cache_miss: statistics: invalid value: \"many\""),
+		},
+		{
+			tname: "unexpected cache size unit",
+			input: `Local storage:
+  Cache size (ZiB): 0.1 / 5.0 ( 1.49%)
+`,
+			wantErr: errors.New(`human: line 2: cache_size_kibibyte: size: invalid value: "0.1 ZiB"`),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			s, err := ParseHumanReadableStatistics(tc.input)
+
+			if tc.wantErr != nil {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				} else if err.Error() != tc.wantErr.Error() {
+					t.Fatalf("want error %q, got %q", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertStatisticsEqual(t, s, &tc.wantStats)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseJSONStatistics reads ccache statistics as formatted by the
+// `ccache --print-stats --format=json` command.
+//
+// JSON output is available since ccache 4.10, and reports the same keys as the
+// tab-separated output of `ccache --print-stats`.
+func ParseJSONStatistics(text string) (*Statistics, error) {
+	return parseJSONStatistics(newParseState(StatisticsFormatJSON, ParseModeDefault), text)
+}
+
+func parseJSONStatistics(p *parseState, text string) (*Statistics, error) {
+	if err := checkOutputSize(text); err != nil {
+		return &Statistics{}, err
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+
+	var jsonData map[string]any
+
+	if err := decoder.Decode(&jsonData); err != nil {
+		return &Statistics{}, err
+	}
+
+	if err := checkOutputRows(len(jsonData)); err != nil {
+		return &Statistics{}, err
+	}
+
+	// sort keys, so that warnings are reported in a stable order
+	keys := make([]string, 0, len(jsonData))
+	for key := range jsonData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	stats := &Statistics{}
+
+	for _, key := range keys {
+		rawValue := jsonData[key]
+
+		if !isValidStatisticsKey(key) {
+			if err := p.unknown(0, key, fmt.Sprint(rawValue)); err != nil {
+				return &Statistics{}, err
+			}
+			continue
+		}
+
+		if !isStatisticsKey(key) {
+			// unknown key, possibly introduced by a newer version of ccache
+			if err := p.unknown(0, key, fmt.Sprint(rawValue)); err != nil {
+				return &Statistics{}, err
+			}
+		}
+
+		number, ok := rawValue.(json.Number)
+		if !ok {
+			if !isStatisticsKey(key) {
+				continue
+			}
+
+			err := fmt.Errorf("%w: %v", ErrStatisticsValueInvalid, rawValue)
+			if err := p.malformed(0, key, fmt.Sprint(rawValue), err); err != nil {
+				return &Statistics{}, err
+			}
+			continue
+		}
+
+		value, err := number.Int64()
+		if err != nil {
+			if !isStatisticsKey(key) {
+				continue
+			}
+
+			if err := p.malformed(0, key, number.String(), err); err != nil {
+				return &Statistics{}, err
+			}
+			continue
+		}
+
+		stats.setValue(key, value)
+	}
+
+	stats.updateDerivedFields()
+
+	return stats, nil
+}
+
+// FormatJSONStatistics writes statistics as formatted by the
+// `ccache --print-stats --format=json` command.
+//
+// The cache sizes are rounded down to the kibibyte.
+func FormatJSONStatistics(stats *Statistics) string {
+	// encoding a map of integers cannot fail
+	statsJSON, _ := json.MarshalIndent(stats.machineReadableValues(), "", "  ")
+
+	return string(statsJSON) + "\n"
+}
@@ -0,0 +1,127 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONStatisticsMatchesTSV(t *testing.T) {
+	jsonFilepaths, err := filepath.Glob(filepath.Join("testdata", "*-ccache-*", "*.json"))
+	if err != nil {
+		t.Fatalf("failed to list test inputs: %q", err)
+	}
+
+	if len(jsonFilepaths) == 0 {
+		t.Skip("no JSON statistics captured, see internal/generate-testdata")
+	}
+
+	for _, jsonFilepath := range jsonFilepaths {
+		tsvFilepath := strings.TrimSuffix(jsonFilepath, ".json") + ".tsv"
+
+		t.Run(jsonFilepath, func(t *testing.T) {
+			jsonInput, err := os.ReadFile(jsonFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			tsvInput, err := os.ReadFile(tsvFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			got, err := ParseJSONStatistics(string(jsonInput))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			want, err := ParseTSVStatistics(string(tsvInput))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertStatisticsEqual(t, got, want)
+			assertTimeFieldEquals(t, "StatsTime", got.StatsTime, want.StatsTime)
+			assertTimeFieldEquals(t, "StatsZeroTime", got.StatsZeroTime, want.StatsZeroTime)
+			assertCountersEqual(t, got.Counters, want.Counters)
+		})
+	}
+}
+
+func TestParseJSONStatisticsEdgeCases(t *testing.T) {
+	cases := []struct {
+		tname     string
+		input     string
+		wantStats Statistics
+		wantErr   error
+	}{
+		{
+			tname: "unknown keys are kept if they hold an integer value",
+			input: `{"cache_miss": 3, "some_future_counter": 12, "some_future_setting": "enabled"}`,
+			wantStats: Statistics{
+				CacheMiss: 3,
+				CacheSize: "0B",
+				Counters: map[string]int64{
+					"cache_miss":          3,
+					"some_future_counter": 12,
+				},
+			},
+		},
+		{
+			tname: "keys with invalid characters are ignored",
+			input: `{"cache_miss": 3, "new_\udcffkey": 3, "New-Counter": 4}`,
+			wantStats: Statistics{
+				CacheMiss: 3,
+				CacheSize: "0B",
+				Counters: map[string]int64{
+					"cache_miss": 3,
+				},
+			},
+		},
+
+		// error cases
+		{
+			tname:   "invalid JSON document",
+			input:   `cache_miss	3`,
+			wantErr: errors.New("invalid character 'c' looking for beginning of value"),
+		},
+		{
+			tname:   "invalid counter value",
+			input:   `{"cache_miss": "many"}`,
+			wantErr: errors.New("json: cache_miss: statistics: invalid value: many"),
+		},
+		{
+			tname:   "non-integer counter value",
+			input:   `{"cache_miss": 3.5}`,
+			wantErr: errors.New("json: cache_miss: strconv.ParseInt: parsing \"3.5\": invalid syntax"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			s, err := ParseJSONStatistics(tc.input)
+
+			if tc.wantErr != nil {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				} else if err.Error() != tc.wantErr.Error() {
+					t.Fatalf("want error %q, got %q", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertStatisticsEqual(t, s, &tc.wantStats)
+			assertCountersEqual(t, s.Counters, tc.wantStats.Counters)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStatisticsKeyUnknown  error = errors.New("statistics: unknown key")
+	ErrStatisticsLineInvalid error = errors.New("statistics: invalid line")
+	ErrStatisticsNoEntry     error = errors.New("statistics: no valid entry")
+)
+
+// ParseMode controls how statistics and configuration parsers handle unknown
+// and malformed input.
+type ParseMode int
+
+const (
+	// ParseModeDefault ignores unknown keys and lines, and fails on malformed
+	// values for known keys.
+	ParseModeDefault ParseMode = iota
+
+	// ParseModeLenient ignores unknown keys and lines, and skips malformed
+	// values, which are reported as warnings.
+	ParseModeLenient
+
+	// ParseModeStrict fails on unknown keys and lines, and on malformed values.
+	ParseModeStrict
+)
+
+// String returns the name of the parsing mode.
+func (m ParseMode) String() string {
+	switch m {
+	case ParseModeDefault:
+		return "default"
+	case ParseModeLenient:
+		return "lenient"
+	case ParseModeStrict:
+		return "strict"
+	default:
+		return fmt.Sprintf("ParseMode(%d)", int(m))
+	}
+}
+
+// ParseError describes an entry of the statistics or configuration that could
+// not be parsed.
+type ParseError struct {
+	// Format of the statistics, or "config" for configuration settings.
+	Format StatisticsFormat
+
+	// Line number, starting at 1; 0 for JSON formats.
+	Line int
+
+	// Counter key if known, label of the entry otherwise; empty for lines that
+	// could not be split into a key and a value.
+	Key string
+
+	// Raw value of the entry, or the whole line if it could not be split.
+	Value string
+
+	Err error
+}
+
+// Error returns the location of the entry and the reason why it could not be
+// parsed.
+func (e *ParseError) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString(string(e.Format))
+
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, ": line %d", e.Line)
+	}
+
+	if e.Key != "" {
+		sb.WriteString(": " + e.Key)
+	}
+
+	sb.WriteString(": " + e.Err.Error())
+
+	return sb.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseState holds the settings and warnings of a statistics parser.
+type parseState struct {
+	format   StatisticsFormat
+	mode     ParseMode
+	location *time.Location
+	warnings []*ParseError
+
+	// entries counts the lines split into a key and a value
+	entries int
+
+	// firstInvalid is the first line that could not be split
+	firstInvalid *ParseError
+}
+
+func newParseState(format StatisticsFormat, mode ParseMode) *parseState {
+	return &parseState{
+		format:   format,
+		mode:     mode,
+		location: time.Local,
+	}
+}
+
+// malformed reports an entry whose value cannot be parsed.
+//
+// In lenient mode, the entry is recorded as a warning and nil is returned, so
+// that the parser skips it.
+func (p *parseState) malformed(line int, key string, value string, err error) error {
+	parseErr := &ParseError{
+		Format: p.format,
+		Line:   line,
+		Key:    key,
+		Value:  value,
+		Err:    err,
+	}
+
+	if p.mode == ParseModeLenient {
+		p.warnings = append(p.warnings, parseErr)
+		return nil
+	}
+
+	return parseErr
+}
+
+// unknown reports an entry whose key is not known, which is only an error in
+// strict mode.
+func (p *parseState) unknown(line int, key string, value string) error {
+	if p.mode != ParseModeStrict {
+		return nil
+	}
+
+	return &ParseError{
+		Format: p.format,
+		Line:   line,
+		Key:    key,
+		Value:  value,
+		Err:    ErrStatisticsKeyUnknown,
+	}
+}
+
+// invalidLine reports a line that cannot be split into a key and a value,
+// which is only an error in strict mode.
+func (p *parseState) invalidLine(line int, text string) error {
+	parseErr := &ParseError{
+		Format: p.format,
+		Line:   line,
+		Value:  text,
+		Err:    ErrStatisticsLineInvalid,
+	}
+
+	if p.mode == ParseModeStrict {
+		return parseErr
+	}
+
+	if p.firstInvalid == nil {
+		p.firstInvalid = parseErr
+	}
+
+	return nil
+}
+
+// noEntry reports an output made only of lines that cannot be split into a
+// key and a value, e.g. an error message or garbage, which would otherwise be
+// read as statistics where every counter is zero.
+func (p *parseState) noEntry() error {
+	if p.entries > 0 || p.firstInvalid == nil {
+		return nil
+	}
+
+	return &ParseError{
+		Format: p.format,
+		Line:   p.firstInvalid.Line,
+		Value:  p.firstInvalid.Value,
+		Err:    ErrStatisticsNoEntry,
+	}
+}
+
+// ParseStatisticsWithMode reads ccache statistics in the given format, or in
+// the format detected from the text if format is empty.
+//
+// In lenient mode, malformed entries are skipped and returned as warnings
+// along with the partial statistics.
+func ParseStatisticsWithMode(format StatisticsFormat, mode ParseMode, text string) (*Statistics, []*ParseError, error) {
+	return parseStatisticsInLocation(format, mode, time.Local, text)
+}
+
+// parseStatisticsInLocation reads ccache statistics as ParseStatisticsWithMode,
+// with timestamps printed without time zone information expressed in the
+// given time zone.
+func parseStatisticsInLocation(format StatisticsFormat, mode ParseMode, loc *time.Location, text string) (*Statistics, []*ParseError, error) {
+	if format == "" {
+		var err error
+
+		format, err = DetectStatisticsFormat(text)
+		if err != nil {
+			return &Statistics{}, nil, err
+		}
+	}
+
+	parse, ok := statisticsParsers[format]
+	if !ok {
+		return &Statistics{}, nil, fmt.Errorf("%w: %q", ErrStatisticsFormatUnknown, format)
+	}
+
+	p := newParseState(format, mode)
+	p.location = loc
+
+	stats, err := parse(p, text)
+	if err != nil {
+		return &Statistics{}, nil, err
+	}
+
+	return stats, p.warnings, nil
+}
@@ -0,0 +1,388 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseStatisticsWithModeStrictTestdata(t *testing.T) {
+	inputFilepaths, err := filepath.Glob(filepath.Join("testdata", "*-ccache-*", "*"))
+	if err != nil {
+		t.Fatalf("failed to list test inputs: %q", err)
+	}
+
+	for _, inputFilepath := range inputFilepaths {
+		if strings.Contains(inputFilepath, "cache-directory") {
+			continue
+		}
+
+		format := testdataStatisticsFormat(inputFilepath)
+		if format == "" {
+			continue
+		}
+
+		t.Run(inputFilepath, func(t *testing.T) {
+			input, err := os.ReadFile(inputFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			want, err := ParseStatisticsFormat(format, string(input))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			got, warnings, err := ParseStatisticsWithMode(format, ParseModeStrict, string(input))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			if len(warnings) != 0 {
+				t.Errorf("want no warnings, got %d", len(warnings))
+			}
+
+			assertStatisticsEqual(t, got, want)
+			assertCountersEqual(t, got.Counters, want.Counters)
+		})
+	}
+}
+
+func TestParseStatisticsWithModeLenient(t *testing.T) {
+	cases := []struct {
+		tname        string
+		format       StatisticsFormat
+		input        string
+		wantStats    Statistics
+		wantWarnings []ParseError
+	}{
+		{
+			tname:  "TSV",
+			format: StatisticsFormatTSV,
+			input: `cache_miss	176
+direct_cache_hit	many
+unknown_counter	12
+preprocessed_cache_hit	2
+local_storage_hit	3.5
+`,
+			wantStats: Statistics{
+				CacheHitPreprocessed: 2,
+				CacheMiss:            176,
+				CacheHitRate:         1.1235955,
+				CacheHitRatio:        0.011235955,
+				CacheSize:            "0B",
+			},
+			wantWarnings: []ParseError{
+				{Format: StatisticsFormatTSV, Line: 2, Key: "direct_cache_hit", Value: "many"},
+				{Format: StatisticsFormatTSV, Line: 5, Key: "local_storage_hit", Value: "3.5"},
+			},
+		},
+		{
+			tname:  "ccache JSON",
+			format: StatisticsFormatJSON,
+			input:  `{"cache_miss": 176, "direct_cache_hit": "many", "local_storage_hit": 3.5, "unknown_counter": true}`,
+			wantStats: Statistics{
+				CacheMiss: 176,
+				CacheSize: "0B",
+			},
+			wantWarnings: []ParseError{
+				{Format: StatisticsFormatJSON, Key: "direct_cache_hit", Value: "many"},
+				{Format: StatisticsFormatJSON, Key: "local_storage_hit", Value: "3.5"},
+			},
+		},
+		{
+			tname:  "human-readable",
+			format: StatisticsFormatHumanReadable,
+			input: `Stats updated:      not a date
+Cacheable calls:    294 / 414 (71.01%)
+  Hits:             118 / 294 (40.14%)
+    Direct:         116 / 118 (98.31%)
+    Preprocessed:     2 / 118 ( 1.69%)
+  Misses:           many
+Local storage:
+  Cache size (ZiB): 0.1 / 5.0 ( 1.49%)
+  Files:            350
+`,
+			wantStats: Statistics{
+				CacheHitDirect:       116,
+				CacheHitPreprocessed: 2,
+				CacheHitRate:         100,
+				CacheHitRatio:        1,
+				FilesInCache:         350,
+			},
+			wantWarnings: []ParseError{
+				{Format: StatisticsFormatHumanReadable, Line: 1, Key: "stats_updated_timestamp", Value: "not a date"},
+				{Format: StatisticsFormatHumanReadable, Line: 6, Key: "cache_miss", Value: "many"},
+				{Format: StatisticsFormatHumanReadable, Line: 8, Key: "cache_size_kibibyte", Value: "0.1 / 5.0 ( 1.49%)"},
+			},
+		},
+		{
+			tname:  "pre-3.7",
+			format: StatisticsFormatPre37,
+			input: `cache hit (direct)                    52
+cache hit (preprocessed)               5
+cache miss                          many
+cache size                         655.4 zB
+max cache size                       5.0 GB
+`,
+			wantStats: Statistics{
+				CacheHitDirect:       52,
+				CacheHitPreprocessed: 5,
+				CacheHitRate:         100,
+				CacheHitRatio:        1,
+				MaxCacheSize:         "5.0 GB",
+				MaxCacheSizeBytes:    5000000000,
+			},
+			wantWarnings: []ParseError{
+				{Format: StatisticsFormatPre37, Line: 3, Key: "cache_miss", Value: "many"},
+				{Format: StatisticsFormatPre37, Line: 4, Key: "cache_size_kibibyte", Value: "655.4 zB"},
+			},
+		},
+		{
+			tname:  "Statistics encoded as JSON",
+			format: StatisticsFormatStatistics,
+			input:  `{"cache_miss": 176, "cache_hit_direct": "many", "stats_time": "0001-01-01T00:00:00Z"}`,
+			wantStats: Statistics{
+				CacheMiss: 176,
+			},
+			wantWarnings: []ParseError{
+				{Format: StatisticsFormatStatistics, Key: "cache_hit_direct", Value: "string"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			if _, _, err := ParseStatisticsWithMode(tc.format, ParseModeDefault, tc.input); err == nil {
+				t.Fatal("expected an error in default mode, got none")
+			}
+
+			got, warnings, err := ParseStatisticsWithMode(tc.format, ParseModeLenient, tc.input)
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertStatisticsEqual(t, got, &tc.wantStats)
+
+			if len(warnings) != len(tc.wantWarnings) {
+				t.Fatalf("want %d warnings, got %d: %v", len(tc.wantWarnings), len(warnings), warnings)
+			}
+
+			for i, want := range tc.wantWarnings {
+				warning := warnings[i]
+
+				if warning.Format != want.Format {
+					t.Errorf("warning %d: want format %q, got %q", i, want.Format, warning.Format)
+				}
+				if warning.Line != want.Line {
+					t.Errorf("warning %d: want line %d, got %d", i, want.Line, warning.Line)
+				}
+				if warning.Key != want.Key {
+					t.Errorf("warning %d: want key %q, got %q", i, want.Key, warning.Key)
+				}
+				if warning.Value != want.Value {
+					t.Errorf("warning %d: want value %q, got %q", i, want.Value, warning.Value)
+				}
+				if warning.Err == nil {
+					t.Errorf("warning %d: want an underlying error, got none", i)
+				}
+			}
+		})
+	}
+}
+
+func TestParseStatisticsWithModeStrict(t *testing.T) {
+	cases := []struct {
+		tname     string
+		format    StatisticsFormat
+		input     string
+		wantErr   error
+		wantError string
+	}{
+		{
+			tname:     "TSV unknown key",
+			format:    StatisticsFormatTSV,
+			input:     "cache_miss\t3\nunknown_counter\t12\n",
+			wantErr:   ErrStatisticsKeyUnknown,
+			wantError: "tsv: line 2: unknown_counter: statistics: unknown key",
+		},
+		{
+			tname:     "TSV invalid line",
+			format:    StatisticsFormatTSV,
+			input:     "cache_miss\t3\n\ncache_hit 3\n",
+			wantErr:   ErrStatisticsLineInvalid,
+			wantError: "tsv: line 3: statistics: invalid line",
+		},
+		{
+			tname:     "TSV invalid key",
+			format:    StatisticsFormatTSV,
+			input:     "cache_miss\t3\nNew-Counter\t3\n",
+			wantErr:   ErrStatisticsLineInvalid,
+			wantError: "tsv: line 2: statistics: invalid line",
+		},
+		{
+			tname:     "TSV invalid value",
+			format:    StatisticsFormatTSV,
+			input:     "cache_miss\tmany\n",
+			wantError: "tsv: line 1: cache_miss: strconv.ParseInt: parsing \"many\": invalid syntax",
+		},
+		{
+			tname:     "ccache JSON unknown key",
+			format:    StatisticsFormatJSON,
+			input:     `{"cache_miss": 3, "unknown_counter": 12}`,
+			wantErr:   ErrStatisticsKeyUnknown,
+			wantError: "json: unknown_counter: statistics: unknown key",
+		},
+		{
+			tname:     "ccache JSON invalid key",
+			format:    StatisticsFormatJSON,
+			input:     `{"cache_miss": 3, "new counter": 12}`,
+			wantErr:   ErrStatisticsKeyUnknown,
+			wantError: "json: new counter: statistics: unknown key",
+		},
+		{
+			tname:     "human-readable unknown label",
+			format:    StatisticsFormatHumanReadable,
+			input:     "Cacheable calls:    294 / 414 (71.01%)\n  Lucky guesses:      3\n",
+			wantErr:   ErrStatisticsKeyUnknown,
+			wantError: "human: line 2: Lucky guesses: statistics: unknown key",
+		},
+		{
+			tname:     "human-readable unknown section",
+			format:    StatisticsFormatHumanReadable,
+			input:     "Cacheable calls:    294 / 414 (71.01%)\nQuantum storage:\n",
+			wantErr:   ErrStatisticsKeyUnknown,
+			wantError: "human: line 2: Quantum storage: statistics: unknown key",
+		},
+		{
+			tname:     "pre-3.7 unknown label",
+			format:    StatisticsFormatPre37,
+			input:     "cache miss                             3\nlucky guesses                          3\n",
+			wantErr:   ErrStatisticsKeyUnknown,
+			wantError: "pre-3.7: line 2: lucky guesses: statistics: unknown key",
+		},
+		{
+			tname:     "pre-3.7 invalid line",
+			format:    StatisticsFormatPre37,
+			input:     "cache miss                             3\ngarbage\n",
+			wantErr:   ErrStatisticsLineInvalid,
+			wantError: "pre-3.7: line 2: statistics: invalid line",
+		},
+		{
+			tname:     "Statistics encoded as JSON unknown field",
+			format:    StatisticsFormatStatistics,
+			input:     `{"cache_miss": 3, "lucky_guesses": 3}`,
+			wantErr:   ErrStatisticsKeyUnknown,
+			wantError: "statistics: lucky_guesses: statistics: unknown key",
+		},
+		{
+			tname:     "Statistics encoded as JSON invalid counter key",
+			format:    StatisticsFormatStatistics,
+			input:     `{"cache_miss": 3, "counters": {"cache_miss": 3, "New-Counter": 3}}`,
+			wantErr:   ErrStatisticsKeyUnknown,
+			wantError: "statistics: New-Counter: statistics: unknown key",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			_, _, err := ParseStatisticsWithMode(tc.format, ParseModeStrict, tc.input)
+			if err == nil {
+				t.Fatal("expected an error, got none")
+			}
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("want a ParseError, got %T", err)
+			}
+
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("want error %q, got %q", tc.wantErr, err)
+			}
+
+			if parseErr.Format != tc.format {
+				t.Errorf("want format %q, got %q", tc.format, parseErr.Format)
+			}
+
+			if err.Error() != tc.wantError {
+				t.Errorf("want error %q, got %q", tc.wantError, err)
+			}
+		})
+	}
+}
+
+func TestParseStatisticsWithModeNoEntry(t *testing.T) {
+	cases := []struct {
+		tname     string
+		format    StatisticsFormat
+		input     string
+		wantError string
+	}{
+		{
+			tname:     "TSV",
+			format:    StatisticsFormatTSV,
+			input:     "\nccache: error: Permission denied\nNew-Counter\t3\n",
+			wantError: "tsv: line 2: statistics: no valid entry",
+		},
+		{
+			tname:     "human-readable",
+			format:    StatisticsFormatHumanReadable,
+			input:     "\x00\xff\xfe garbage\n",
+			wantError: "human: line 1: statistics: no valid entry",
+		},
+		{
+			tname:     "pre-3.7",
+			format:    StatisticsFormatPre37,
+			input:     "garbage\n",
+			wantError: "pre-3.7: line 1: statistics: no valid entry",
+		},
+	}
+
+	for _, tc := range cases {
+		for _, mode := range []ParseMode{ParseModeDefault, ParseModeLenient} {
+			t.Run(tc.tname+"/"+mode.String(), func(t *testing.T) {
+				_, _, err := ParseStatisticsWithMode(tc.format, mode, tc.input)
+				if !errors.Is(err, ErrStatisticsNoEntry) {
+					t.Fatalf("want error %q, got %q", ErrStatisticsNoEntry, err)
+				}
+
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("want a ParseError, got %T", err)
+				}
+
+				if err.Error() != tc.wantError {
+					t.Errorf("want error %q, got %q", tc.wantError, err)
+				}
+			})
+		}
+	}
+
+	// an empty output is not garbage
+	if _, _, err := ParseStatisticsWithMode(StatisticsFormatTSV, ParseModeDefault, ""); err != nil {
+		t.Errorf("expected no error, got %q", err)
+	}
+}
+
+func TestParseStatisticsWithModeDetectsFormat(t *testing.T) {
+	stats, warnings, err := ParseStatisticsWithMode("", ParseModeLenient, "cache_miss\t3\ndirect_cache_hit\tmany\n")
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+
+	assertIntFieldEquals(t, "CacheMiss", stats.CacheMiss, 3)
+
+	if len(warnings) != 1 || warnings[0].Format != StatisticsFormatTSV {
+		t.Errorf("want 1 TSV warning, got %v", warnings)
+	}
+
+	_, _, err = ParseStatisticsWithMode("xml", ParseModeLenient, "<stats/>")
+	if !errors.Is(err, ErrStatisticsFormatUnknown) {
+		t.Errorf("want error %q, got %q", ErrStatisticsFormatUnknown, err)
+	}
+}
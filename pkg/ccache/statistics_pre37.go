@@ -4,27 +4,79 @@
 package ccache
 
 import (
+	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/alecthomas/units"
 )
 
-var pre37StatisticsRules = map[string]*regexp.Regexp{
-	"statsZeroTime":            regexp.MustCompile(`stats zero( time|ed)\s+(.*)`),
-	"cacheHitDirect":           regexp.MustCompile(`cache hit \(direct\)\s+(\d+)`),
-	"cacheHitPreprocessed":     regexp.MustCompile(`cache hit \(preprocessed\)\s+(\d+)`),
-	"cacheMiss":                regexp.MustCompile(`cache miss\s+(\d+)`),
-	"cacheHitRate":             regexp.MustCompile(`cache hit rate\s+(\d+(\.\d+)?) %`),
-	"calledForLink":            regexp.MustCompile(`called for link\s+(\d+)`),
-	"calledForPreprocessing":   regexp.MustCompile(`called for preprocessing\s+(\d+)`),
-	"unsupportedCodeDirective": regexp.MustCompile(`unsupported code directive\s+(\d+)`),
-	"noInputFile":              regexp.MustCompile(`no input file\s+(\d+)`),
-	"cleanupsPerformed":        regexp.MustCompile(`cleanups performed\s+(\d+)`),
-	"filesInCache":             regexp.MustCompile(`files in cache\s+(\d+)`),
-	"cacheSize":                regexp.MustCompile(`cache size\s+(.+)`),
+var (
+	pre37LineRegex = regexp.MustCompile(`^(\S+(?: \S+)*)\s{2,}(.*)$`)
+)
+
+// pre37Counters maps the descriptions of counters, as printed by
+// `ccache --show-stats` (ccache < 3.7), to counter keys.
+//
+// See https://github.com/ccache/ccache/blob/v3.6/src/stats.c
+var pre37Counters = map[string]string{
+	"autoconf compile/link":          "autoconf_test",
+	"bad compiler arguments":         "bad_compiler_arguments",
+	"cache file missing":             "missing_cache_file",
+	"cache hit (direct)":             "direct_cache_hit",
+	"cache hit (preprocessed)":       "preprocessed_cache_hit",
+	"cache miss":                     "cache_miss",
+	"called for link":                "called_for_link",
+	"called for preprocessing":       "called_for_preprocessing",
+	"can't use precompiled header":   "could_not_use_precompiled_header",
+	"ccache internal error":          "internal_error",
+	"cleanups performed":             "cleanups_performed",
+	"compile failed":                 "compile_failed",
+	"compiler check failed":          "compiler_check_failed",
+	"compiler produced empty output": "compiler_produced_empty_output",
+	"compiler produced no output":    "compiler_produced_no_output",
+	"compiler produced stdout":       "compiler_produced_stdout",
+	"could not write to output file": "bad_output_file",
+	"couldn't find the compiler":     "could_not_find_compiler",
+	"error hashing extra file":       "error_hashing_extra_file",
+	"files in cache":                 "files_in_cache",
+	"max files":                      "max_files_in_cache",
+	"multiple source files":          "multiple_source_files",
+	"no input file":                  "no_input_file",
+	"output to stdout":               "output_to_stdout",
+	"preprocessor error":             "preprocessor_error",
+	"unsupported code directive":     "unsupported_code_directive",
+	"unsupported compiler option":    "unsupported_compiler_option",
+	"unsupported source language":    "unsupported_source_language",
+}
+
+// pre37CounterLabels lists the descriptions of counters, in the order in which
+// they are printed by `ccache --show-stats` (ccache < 3.7), after the cache hit
+// rate.
+var pre37CounterLabels = []string{
+	"called for link",
+	"called for preprocessing",
+	"multiple source files",
+	"compiler produced stdout",
+	"compiler produced no output",
+	"compiler produced empty output",
+	"compile failed",
+	"ccache internal error",
+	"preprocessor error",
+	"can't use precompiled header",
+	"couldn't find the compiler",
+	"cache file missing",
+	"bad compiler arguments",
+	"unsupported source language",
+	"compiler check failed",
+	"autoconf compile/link",
+	"unsupported compiler option",
+	"unsupported code directive",
+	"output to stdout",
+	"could not write to output file",
+	"no input file",
+	"error hashing extra file",
 }
 
 // ParsePre37Statistics reads ccache configuration and statistics as formatted by the `ccache --show-stats` command.
@@ -32,113 +84,211 @@ var pre37StatisticsRules = map[string]*regexp.Regexp{
 // Starting with ccache 3.7, this command was overhauled to print human-readable
 // statistics, with `ccache --print-stats` being the new command to get
 // machine-readable statistics.
+//
+// Timestamps are assumed to be expressed in the local time zone.
 func ParsePre37Statistics(text string) (*Statistics, error) {
+	return ParsePre37StatisticsInLocation(text, time.Local)
+}
+
+// ParsePre37StatisticsInLocation reads ccache configuration and statistics as
+// formatted by the `ccache --show-stats` command (ccache < 3.7), with
+// timestamps expressed in the given time zone.
+//
+// The time zone is the one of the host where ccache was run, as timestamps are
+// printed without any time zone information.
+//
+// The statistics time is only set by ccache >= 3.5, which prints when
+// statistics were last updated.
+func ParsePre37StatisticsInLocation(text string, loc *time.Location) (*Statistics, error) {
+	p := newParseState(StatisticsFormatPre37, ParseModeDefault)
+	p.location = loc
+
+	return parsePre37Statistics(p, text)
+}
+
+func parsePre37Statistics(p *parseState, text string) (*Statistics, error) {
 	stats := &Statistics{}
-	var err error
 
-	// now's the time
-	stats.StatsTime = time.Now()
+	scanner := newOutputScanner(text)
+	lineNumber := 0
 
-	// assume stats originate from the local host
-	matches := pre37StatisticsRules["statsZeroTime"].FindStringSubmatch(text)
-	if len(matches) == 3 {
-		statsZeroTime := pre37StatisticsRules["statsZeroTime"].FindStringSubmatch(text)[2]
-		stats.StatsZeroTime, err = time.ParseInLocation("Mon Jan 2 15:04:05 2006", statsZeroTime, stats.StatsTime.Location())
-		if err != nil {
-			return &Statistics{}, err
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
 		}
-	}
 
-	matches = pre37StatisticsRules["cacheHitDirect"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.CacheHitDirect, err = strconv.Atoi(matches[1])
-		if err != nil {
-			return &Statistics{}, err
+		matches := pre37LineRegex.FindStringSubmatch(line)
+		if len(matches) != 3 {
+			if err := p.invalidLine(lineNumber, line); err != nil {
+				return &Statistics{}, err
+			}
+			continue
 		}
-	}
 
-	matches = pre37StatisticsRules["cacheHitPreprocessed"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.CacheHitPreprocessed, err = strconv.Atoi(matches[1])
-		if err != nil {
-			return &Statistics{}, err
+		p.entries++
+
+		label := matches[1]
+		value := matches[2]
+
+		// key is the counter key of the entry, or its label if it has none
+		key := label
+
+		var err error
+
+		switch label {
+		case "cache directory":
+			stats.CacheDirectory = value
+
+		case "primary config":
+			stats.PrimaryConfig = value
+
+		case "secondary config":
+			stats.SecondaryConfig = strings.TrimSpace(strings.TrimPrefix(value, "(readonly)"))
+
+		case "stats updated":
+			key = "stats_updated_timestamp"
+
+			var statsTime time.Time
+			if statsTime, err = time.ParseInLocation(humanReadableTimeLayout, value, p.location); err == nil {
+				stats.StatsTime = statsTime
+			}
+
+		case "stats zero time", "stats zeroed":
+			key = "stats_zeroed_timestamp"
+
+			var statsZeroTime time.Time
+			if statsZeroTime, err = time.ParseInLocation(humanReadableTimeLayout, value, p.location); err == nil {
+				stats.StatsZeroTime = statsZeroTime
+			}
+
+		case "cache hit rate":
+			// derived from counters
+
+		case "cache size":
+			key = "cache_size_kibibyte"
+
+			var cacheSizeBytes units.MetricBytes
+			if cacheSizeBytes, err = ParseSize(value); err == nil {
+				stats.CacheSize = value
+				stats.CacheSizeBytes = cacheSizeBytes
+			}
+
+		case "max cache size":
+			key = "max_cache_size_kibibyte"
+
+			var maxCacheSizeBytes units.MetricBytes
+			if maxCacheSizeBytes, err = ParseSize(value); err == nil {
+				stats.MaxCacheSize = value
+				stats.MaxCacheSizeBytes = maxCacheSizeBytes
+			}
+
+		default:
+			counterKey, ok := pre37Counters[label]
+			if !ok {
+				if err := p.unknown(lineNumber, label, value); err != nil {
+					return &Statistics{}, err
+				}
+				continue
+			}
+			key = counterKey
+
+			var count int64
+			if count, _, err = parseHumanReadableCount(value); err == nil {
+				stats.setCounter(key, count)
+			}
 		}
-	}
 
-	matches = pre37StatisticsRules["cacheMiss"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.CacheMiss, err = strconv.Atoi(matches[1])
 		if err != nil {
-			return &Statistics{}, err
+			if err := p.malformed(lineNumber, key, value, err); err != nil {
+				return &Statistics{}, err
+			}
 		}
 	}
 
-	matches = pre37StatisticsRules["cacheHitRate"].FindStringSubmatch(text)
-	if len(matches) == 3 {
-		stats.CacheHitRate, err = strconv.ParseFloat(matches[1], 64)
-		stats.CacheHitRatio = stats.CacheHitRate / 100
-		if err != nil {
-			return &Statistics{}, err
-		}
+	if err := scanner.Err(); err != nil {
+		return &Statistics{}, err
 	}
 
-	matches = pre37StatisticsRules["calledForLink"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.CalledForLink, err = strconv.Atoi(matches[1])
-		if err != nil {
-			return &Statistics{}, err
-		}
+	if err := p.noEntry(); err != nil {
+		return &Statistics{}, err
 	}
 
-	matches = pre37StatisticsRules["calledForPreprocessing"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.CalledForPreprocessing, err = strconv.Atoi(matches[1])
-		if err != nil {
-			return &Statistics{}, err
+	stats.updateRatios()
+
+	return stats, nil
+}
+
+// FormatPre37Statistics writes statistics as formatted by the
+// `ccache --show-stats` command (ccache < 3.7).
+//
+// As done by ccache, zero counters are omitted, with the exception of cache
+// hits, misses, cleanups and files; for parsed statistics, the counters found in
+// the input are printed. Timestamps are printed in the local time zone.
+func FormatPre37Statistics(stats *Statistics) string {
+	var sb strings.Builder
+
+	writeString := func(label string, value string) {
+		if value != "" {
+			fmt.Fprintf(&sb, "%-36s%s\n", label, value)
 		}
 	}
 
-	matches = pre37StatisticsRules["unsupportedCodeDirective"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.UnsupportedCodeDirective, err = strconv.Atoi(matches[1])
-		if err != nil {
-			return &Statistics{}, err
+	writeTime := func(label string, value time.Time) {
+		if !value.IsZero() {
+			writeString(label, value.Local().Format(humanReadableTimeLayout))
 		}
 	}
 
-	matches = pre37StatisticsRules["noInputFile"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.NoInputFile, err = strconv.Atoi(matches[1])
-		if err != nil {
-			return &Statistics{}, err
-		}
+	writeCount := func(label string, value int64) {
+		fmt.Fprintf(&sb, "%-31s %8d\n", label, value)
 	}
 
-	matches = pre37StatisticsRules["cleanupsPerformed"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.CleanupsPerformed, err = strconv.Atoi(matches[1])
-		if err != nil {
-			return &Statistics{}, err
+	writeString("cache directory", stats.CacheDirectory)
+	writeString("primary config", stats.PrimaryConfig)
+	writeString("secondary config      (readonly)", stats.SecondaryConfig)
+	writeTime("stats updated", stats.StatsTime)
+	writeTime("stats zeroed", stats.StatsZeroTime)
+
+	writeCount("cache hit (direct)", stats.CacheHitDirect)
+	writeCount("cache hit (preprocessed)", stats.CacheHitPreprocessed)
+	writeCount("cache miss", stats.CacheMiss)
+	fmt.Fprintf(&sb, "%-31s %8.2f %%\n", "cache hit rate", 100*stats.HitRatio())
+
+	for _, label := range pre37CounterLabels {
+		key := pre37Counters[label]
+
+		if stats.reportsCounter(key) {
+			writeCount(label, stats.counterValue(key))
 		}
 	}
 
-	matches = pre37StatisticsRules["filesInCache"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.FilesInCache, err = strconv.Atoi(matches[1])
-		if err != nil {
-			return &Statistics{}, err
-		}
+	writeCount("cleanups performed", stats.CleanupsPerformed)
+	writeCount("files in cache", stats.FilesInCache)
+	fmt.Fprintf(&sb, "%-31s %11s\n", "cache size", formatPre37Size(stats.CacheSizeBytes))
+
+	if stats.reportsCounter("max_files_in_cache") {
+		writeCount("max files", stats.MaxFilesInCache)
 	}
 
-	matches = pre37StatisticsRules["cacheSize"].FindStringSubmatch(text)
-	if len(matches) == 2 {
-		stats.CacheSize = matches[1]
-		sanitizedCacheSize := strings.Replace(strings.ToUpper(stats.CacheSize), " ", "", -1)
-		stats.CacheSizeBytes, err = units.ParseMetricBytes(sanitizedCacheSize)
-		if err != nil {
-			return &Statistics{}, err
-		}
+	if stats.MaxCacheSizeBytes != 0 {
+		fmt.Fprintf(&sb, "%-31s %11s\n", "max cache size", formatPre37Size(stats.MaxCacheSizeBytes))
 	}
 
-	return stats, nil
+	return sb.String()
+}
+
+// formatPre37Size formats a size with a decimal prefix and one decimal place,
+// as done by ccache < 3.7, e.g. "1.2 MB".
+func formatPre37Size(size units.MetricBytes) string {
+	switch {
+	case size >= units.GB:
+		return fmt.Sprintf("%.1f GB", float64(size)/float64(units.GB))
+	case size >= units.MB:
+		return fmt.Sprintf("%.1f MB", float64(size)/float64(units.MB))
+	default:
+		return fmt.Sprintf("%.1f kB", float64(size)/float64(units.KB))
+	}
 }
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/units"
 )
@@ -39,39 +40,57 @@ func TestParsePre37Statistics(t *testing.T) {
 					tname:         "empty cache",
 					inputFilename: "empty",
 					wantStats: Statistics{
-						CacheSize: "0.0 kB",
+						CacheDirectory:    "/home/virtualtam/.ccache",
+						PrimaryConfig:     "/home/virtualtam/.ccache/ccache.conf",
+						SecondaryConfig:   "/etc/ccache.conf",
+						StatsZeroTime:     time.Date(2018, time.September, 23, 1, 18, 52, 0, time.UTC),
+						CacheSize:         "0.0 kB",
+						MaxCacheSize:      "15.0 GB",
+						MaxCacheSizeBytes: units.MetricBytes(15000000000),
 					},
 				},
 				{
 					tname:         "first build",
 					inputFilename: "firstbuild",
 					wantStats: Statistics{
+						CacheDirectory:           "/home/virtualtam/.ccache",
+						PrimaryConfig:            "/home/virtualtam/.ccache/ccache.conf",
+						SecondaryConfig:          "/etc/ccache.conf",
+						StatsZeroTime:            time.Date(2018, time.September, 23, 1, 18, 52, 0, time.UTC),
 						CacheMiss:                116,
 						CalledForLink:            14,
 						CalledForPreprocessing:   85,
-						UnsupportedCodeDirective: 2,
 						NoInputFile:              29,
+						UnsupportedCodeDirective: 2,
 						FilesInCache:             361,
 						CacheSize:                "6.4 MB",
 						CacheSizeBytes:           units.MetricBytes(6400000),
+						MaxCacheSize:             "15.0 GB",
+						MaxCacheSizeBytes:        units.MetricBytes(15000000000),
 					},
 				},
 				{
 					tname:         "second build",
 					inputFilename: "secondbuild",
 					wantStats: Statistics{
+						CacheDirectory:           "/home/virtualtam/.ccache",
+						PrimaryConfig:            "/home/virtualtam/.ccache/ccache.conf",
+						SecondaryConfig:          "/etc/ccache.conf",
+						StatsZeroTime:            time.Date(2018, time.September, 23, 1, 18, 52, 0, time.UTC),
 						CacheHitDirect:           73,
 						CacheHitPreprocessed:     4,
 						CacheMiss:                207,
-						CacheHitRate:             27.11,
-						CacheHitRatio:            0.2711,
+						CacheHitRate:             27.112676,
+						CacheHitRatio:            0.271127,
 						CalledForLink:            28,
 						CalledForPreprocessing:   170,
-						UnsupportedCodeDirective: 4,
 						NoInputFile:              58,
+						UnsupportedCodeDirective: 4,
 						FilesInCache:             639,
 						CacheSize:                "12.1 MB",
 						CacheSizeBytes:           units.MetricBytes(12100000),
+						MaxCacheSize:             "15.0 GB",
+						MaxCacheSizeBytes:        units.MetricBytes(15000000000),
 					},
 				},
 			},
@@ -87,39 +106,59 @@ func TestParsePre37Statistics(t *testing.T) {
 					tname:         "empty cache",
 					inputFilename: "empty",
 					wantStats: Statistics{
-						CacheSize: "0.0 kB",
+						CacheDirectory:    "/home/virtualtam/.ccache",
+						PrimaryConfig:     "/home/virtualtam/.ccache/ccache.conf",
+						SecondaryConfig:   "/etc/ccache.conf",
+						CacheSize:         "0.0 kB",
+						MaxCacheSize:      "5.0 GB",
+						MaxCacheSizeBytes: units.MetricBytes(5000000000),
 					},
 				},
 				{
 					tname:         "first build",
 					inputFilename: "firstbuild",
 					wantStats: Statistics{
+						CacheDirectory:         "/home/virtualtam/.ccache",
+						PrimaryConfig:          "/home/virtualtam/.ccache/ccache.conf",
+						SecondaryConfig:        "/etc/ccache.conf",
+						StatsTime:              time.Date(2018, time.October, 20, 0, 49, 12, 0, time.UTC),
 						CacheHitDirect:         1,
 						CacheHitPreprocessed:   15,
 						CacheMiss:              342,
-						CacheHitRate:           4.47,
-						CacheHitRatio:          0.0447,
+						CacheHitRate:           4.469274,
+						CacheHitRatio:          0.044693,
 						CalledForLink:          14,
 						CalledForPreprocessing: 1,
+						PreprocessingFailed:    1,
 						FilesInCache:           867,
 						CacheSize:              "44.5 MB",
 						CacheSizeBytes:         units.MetricBytes(44500000),
+						MaxCacheSize:           "5.0 GB",
+						MaxCacheSizeBytes:      units.MetricBytes(5000000000),
 					},
 				},
 				{
 					tname:         "second build",
 					inputFilename: "secondbuild",
 					wantStats: Statistics{
+						CacheDirectory:         "/home/virtualtam/.ccache",
+						PrimaryConfig:          "/home/virtualtam/.ccache/ccache.conf",
+						SecondaryConfig:        "/etc/ccache.conf",
+						StatsTime:              time.Date(2018, time.October, 20, 0, 50, 26, 0, time.UTC),
+						StatsZeroTime:          time.Date(2018, time.October, 20, 0, 49, 42, 0, time.UTC),
 						CacheHitDirect:         349,
 						CacheHitPreprocessed:   10,
 						CacheMiss:              28,
-						CacheHitRate:           92.76,
-						CacheHitRatio:          0.9276000000000001,
+						CacheHitRate:           92.764858,
+						CacheHitRatio:          0.927649,
 						CalledForLink:          14,
 						CalledForPreprocessing: 1,
+						PreprocessingFailed:    1,
 						FilesInCache:           943,
 						CacheSize:              "46.7 MB",
 						CacheSizeBytes:         units.MetricBytes(46700000),
+						MaxCacheSize:           "5.0 GB",
+						MaxCacheSizeBytes:      units.MetricBytes(5000000000),
 					},
 				},
 			},
@@ -135,27 +174,44 @@ func TestParsePre37Statistics(t *testing.T) {
 					tname:         "empty cache",
 					inputFilename: "empty",
 					wantStats: Statistics{
-						CacheSize: "0.0 kB",
+						CacheDirectory:    "/home/cached/.ccache",
+						PrimaryConfig:     "/home/cached/.ccache/ccache.conf",
+						SecondaryConfig:   "/etc/ccache.conf",
+						CacheSize:         "0.0 kB",
+						MaxCacheSize:      "5.0 GB",
+						MaxCacheSizeBytes: units.MetricBytes(5000000000),
 					},
 				},
 				{
 					tname:         "first build",
 					inputFilename: "firstbuild",
 					wantStats: Statistics{
+						CacheDirectory:           "/home/cached/.ccache",
+						PrimaryConfig:            "/home/cached/.ccache/ccache.conf",
+						SecondaryConfig:          "/etc/ccache.conf",
 						CacheMiss:                52,
 						CalledForLink:            1,
 						CalledForPreprocessing:   11,
+						AutoconfTest:             24,
+						BadCompilerArguments:     1,
+						CompilationFailed:        4,
 						NoInputFile:              7,
+						PreprocessingFailed:      1,
 						UnsupportedCodeDirective: 1,
 						FilesInCache:             103,
 						CacheSize:                "1.2 MB",
 						CacheSizeBytes:           units.MetricBytes(1200000),
+						MaxCacheSize:             "5.0 GB",
+						MaxCacheSizeBytes:        units.MetricBytes(5000000000),
 					},
 				},
 				{
 					tname:         "second build",
 					inputFilename: "secondbuild",
 					wantStats: Statistics{
+						CacheDirectory:           "/home/cached/.ccache",
+						PrimaryConfig:            "/home/cached/.ccache/ccache.conf",
+						SecondaryConfig:          "/etc/ccache.conf",
 						CacheHitDirect:           50,
 						CacheHitPreprocessed:     2,
 						CacheMiss:                52,
@@ -163,11 +219,17 @@ func TestParsePre37Statistics(t *testing.T) {
 						CacheHitRatio:            0.5,
 						CalledForLink:            2,
 						CalledForPreprocessing:   22,
+						AutoconfTest:             48,
+						BadCompilerArguments:     2,
+						CompilationFailed:        8,
 						NoInputFile:              14,
+						PreprocessingFailed:      2,
 						UnsupportedCodeDirective: 2,
 						FilesInCache:             103,
 						CacheSize:                "1.2 MB",
 						CacheSizeBytes:           units.MetricBytes(1200000),
+						MaxCacheSize:             "5.0 GB",
+						MaxCacheSizeBytes:        units.MetricBytes(5000000000),
 					},
 				},
 			},
@@ -182,26 +244,49 @@ func TestParsePre37Statistics(t *testing.T) {
 					tname:         "empty cache",
 					inputFilename: "empty",
 					wantStats: Statistics{
-						CacheSize: "0.0 kB",
+						CacheDirectory:    "/home/cached/.ccache",
+						PrimaryConfig:     "/home/cached/.ccache/ccache.conf",
+						SecondaryConfig:   "/etc/ccache.conf",
+						StatsTime:         time.Date(2022, time.July, 28, 23, 5, 13, 0, time.UTC),
+						StatsZeroTime:     time.Date(2022, time.July, 28, 23, 5, 13, 0, time.UTC),
+						CacheSize:         "0.0 kB",
+						MaxCacheSize:      "5.0 GB",
+						MaxCacheSizeBytes: units.MetricBytes(5000000000),
 					},
 				},
 				{
 					tname:         "first build",
 					inputFilename: "firstbuild",
 					wantStats: Statistics{
+						CacheDirectory:         "/home/cached/.ccache",
+						PrimaryConfig:          "/home/cached/.ccache/ccache.conf",
+						SecondaryConfig:        "/etc/ccache.conf",
+						StatsTime:              time.Date(2022, time.July, 28, 23, 5, 18, 0, time.UTC),
+						StatsZeroTime:          time.Date(2022, time.July, 28, 23, 5, 13, 0, time.UTC),
 						CacheMiss:              57,
 						CalledForLink:          1,
 						CalledForPreprocessing: 11,
+						AutoconfTest:           25,
+						BadCompilerArguments:   1,
+						CompilationFailed:      5,
 						NoInputFile:            4,
+						PreprocessingFailed:    1,
 						FilesInCache:           110,
 						CacheSize:              "1.7 MB",
 						CacheSizeBytes:         units.MetricBytes(1700000),
+						MaxCacheSize:           "5.0 GB",
+						MaxCacheSizeBytes:      units.MetricBytes(5000000000),
 					},
 				},
 				{
 					tname:         "second build",
 					inputFilename: "secondbuild",
 					wantStats: Statistics{
+						CacheDirectory:         "/home/cached/.ccache",
+						PrimaryConfig:          "/home/cached/.ccache/ccache.conf",
+						SecondaryConfig:        "/etc/ccache.conf",
+						StatsTime:              time.Date(2022, time.July, 28, 23, 5, 21, 0, time.UTC),
+						StatsZeroTime:          time.Date(2022, time.July, 28, 23, 5, 13, 0, time.UTC),
 						CacheHitDirect:         52,
 						CacheHitPreprocessed:   5,
 						CacheMiss:              57,
@@ -209,10 +294,16 @@ func TestParsePre37Statistics(t *testing.T) {
 						CacheHitRatio:          0.5,
 						CalledForLink:          2,
 						CalledForPreprocessing: 22,
+						AutoconfTest:           50,
+						BadCompilerArguments:   2,
+						CompilationFailed:      10,
 						NoInputFile:            8,
+						PreprocessingFailed:    2,
 						FilesInCache:           110,
 						CacheSize:              "1.7 MB",
 						CacheSizeBytes:         units.MetricBytes(1700000),
+						MaxCacheSize:           "5.0 GB",
+						MaxCacheSizeBytes:      units.MetricBytes(5000000000),
 					},
 				},
 			},
@@ -228,26 +319,46 @@ func TestParsePre37Statistics(t *testing.T) {
 					tname:         "empty cache",
 					inputFilename: "empty",
 					wantStats: Statistics{
-						CacheSize: "0.0 kB",
+						CacheDirectory:    "/home/cached/.ccache",
+						PrimaryConfig:     "/home/cached/.ccache/ccache.conf",
+						SecondaryConfig:   "/etc/ccache.conf",
+						StatsZeroTime:     time.Date(2022, time.July, 29, 16, 28, 5, 0, time.UTC),
+						CacheSize:         "0.0 kB",
+						MaxCacheSize:      "5.0 GB",
+						MaxCacheSizeBytes: units.MetricBytes(5000000000),
 					},
 				},
 				{
 					tname:         "first build",
 					inputFilename: "firstbuild",
 					wantStats: Statistics{
+						CacheDirectory:         "/home/cached/.ccache",
+						PrimaryConfig:          "/home/cached/.ccache/ccache.conf",
+						SecondaryConfig:        "/etc/ccache.conf",
+						StatsZeroTime:          time.Date(2022, time.July, 29, 16, 28, 5, 0, time.UTC),
 						CacheMiss:              53,
 						CalledForLink:          1,
 						CalledForPreprocessing: 11,
+						AutoconfTest:           24,
+						BadCompilerArguments:   1,
+						CompilationFailed:      4,
 						NoInputFile:            4,
+						PreprocessingFailed:    1,
 						FilesInCache:           104,
 						CacheSize:              "1.6 MB",
 						CacheSizeBytes:         units.MetricBytes(1600000),
+						MaxCacheSize:           "5.0 GB",
+						MaxCacheSizeBytes:      units.MetricBytes(5000000000),
 					},
 				},
 				{
 					tname:         "second build",
 					inputFilename: "secondbuild",
 					wantStats: Statistics{
+						CacheDirectory:         "/home/cached/.ccache",
+						PrimaryConfig:          "/home/cached/.ccache/ccache.conf",
+						SecondaryConfig:        "/etc/ccache.conf",
+						StatsZeroTime:          time.Date(2022, time.July, 29, 16, 28, 5, 0, time.UTC),
 						CacheHitDirect:         50,
 						CacheHitPreprocessed:   3,
 						CacheMiss:              53,
@@ -255,10 +366,16 @@ func TestParsePre37Statistics(t *testing.T) {
 						CacheHitRatio:          0.5,
 						CalledForLink:          2,
 						CalledForPreprocessing: 22,
+						AutoconfTest:           48,
+						BadCompilerArguments:   2,
+						CompilationFailed:      8,
 						NoInputFile:            8,
+						PreprocessingFailed:    2,
 						FilesInCache:           104,
 						CacheSize:              "1.6 MB",
 						CacheSizeBytes:         units.MetricBytes(1600000),
+						MaxCacheSize:           "5.0 GB",
+						MaxCacheSizeBytes:      units.MetricBytes(5000000000),
 					},
 				},
 			},
@@ -278,7 +395,7 @@ func TestParsePre37Statistics(t *testing.T) {
 					t.Fatalf("failed to open test input: %q", err)
 				}
 
-				s, err := ParsePre37Statistics(string(input))
+				s, err := ParsePre37StatisticsInLocation(string(input), time.UTC)
 
 				if tc.wantErr != nil {
 					if err == nil {
@@ -295,6 +412,8 @@ func TestParsePre37Statistics(t *testing.T) {
 				}
 
 				assertStatisticsEqual(t, s, &tc.wantStats)
+				assertTimeFieldEquals(t, "StatsTime", s.StatsTime, tc.wantStats.StatsTime)
+				assertTimeFieldEquals(t, "StatsZeroTime", s.StatsZeroTime, tc.wantStats.StatsZeroTime)
 			})
 		}
 	}
@@ -314,8 +433,91 @@ func TestParsePre37StatisticsEdgeCases(t *testing.T) {
 max cache size                      57.0 kB
 `,
 			wantStats: Statistics{
-				CacheSize:      "16.7 kB",
-				CacheSizeBytes: units.MetricBytes(16700),
+				CacheSize:         "16.7 kB",
+				CacheSizeBytes:    units.MetricBytes(16700),
+				MaxCacheSize:      "57.0 kB",
+				MaxCacheSizeBytes: units.MetricBytes(57000),
+			},
+		},
+
+		// counters that do not appear in the test sessions
+		{
+			tname: "all counters",
+			input: `cache directory                     /home/cached/.ccache
+primary config                      /home/cached/.ccache/ccache.conf
+secondary config      (readonly)    /etc/ccache.conf
+stats updated                       Sat Oct  6 09:05:21 2018
+stats zeroed                        Mon Oct  1 08:00:00 2018
+cache hit (direct)                     1
+cache hit (preprocessed)               2
+cache miss                             3
+cache hit rate                     50.00 %
+called for link                        4
+called for preprocessing               5
+multiple source files                  6
+compiler produced stdout               7
+compiler produced no output            8
+compiler produced empty output         9
+compile failed                        10
+ccache internal error                 11
+preprocessor error                    12
+can't use precompiled header          13
+couldn't find the compiler            14
+cache file missing                    15
+bad compiler arguments                16
+unsupported source language           17
+compiler check failed                 18
+autoconf compile/link                 19
+unsupported compiler option           20
+unsupported code directive            21
+output to stdout                      22
+could not write to output file        23
+no input file                         24
+error hashing extra file              25
+cleanups performed                    26
+files in cache                        27
+cache size                           1.0 MB
+max files                             28
+max cache size                       5.0 GB
+`,
+			wantStats: Statistics{
+				CacheDirectory:               "/home/cached/.ccache",
+				PrimaryConfig:                "/home/cached/.ccache/ccache.conf",
+				SecondaryConfig:              "/etc/ccache.conf",
+				CacheHitDirect:               1,
+				CacheHitPreprocessed:         2,
+				CacheMiss:                    3,
+				CacheHitRate:                 50.0,
+				CacheHitRatio:                0.5,
+				CalledForLink:                4,
+				CalledForPreprocessing:       5,
+				MultipleSourceFiles:          6,
+				CompilerProducedStdout:       7,
+				CompilerProducedNoOutput:     8,
+				CompilerProducedEmptyOutput:  9,
+				CompilationFailed:            10,
+				InternalError:                11,
+				PreprocessingFailed:          12,
+				CouldNotUsePrecompiledHeader: 13,
+				CouldNotFindCompiler:         14,
+				MissingCacheFile:             15,
+				BadCompilerArguments:         16,
+				UnsupportedSourceLanguage:    17,
+				CompilerCheckFailed:          18,
+				AutoconfTest:                 19,
+				UnsupportedCompilerOption:    20,
+				UnsupportedCodeDirective:     21,
+				OutputToStdout:               22,
+				BadOutputFile:                23,
+				NoInputFile:                  24,
+				ErrorHashingExtraFile:        25,
+				CleanupsPerformed:            26,
+				FilesInCache:                 27,
+				MaxFilesInCache:              28,
+				CacheSize:                    "1.0 MB",
+				CacheSizeBytes:               units.MetricBytes(1000000),
+				MaxCacheSize:                 "5.0 GB",
+				MaxCacheSizeBytes:            units.MetricBytes(5000000000),
 			},
 		},
 
@@ -324,19 +526,25 @@ max cache size                      57.0 kB
 			tname: "unexpected date format",
 			input: `stats zeroed                        not a date
 `,
-			wantErr: errors.New("parsing time \"not a date\" as \"Mon Jan 2 15:04:05 2006\": cannot parse \"not a date\" as \"Mon\""),
+			wantErr: errors.New("pre-3.7: line 1: stats_zeroed_timestamp: parsing time \"not a date\" as \"Mon Jan _2 15:04:05 2006\": cannot parse \"not a date\" as \"Mon\""),
 		},
 		{
 			tname: "unexpected cache size unit",
 			input: `cache size                         655.4 zB
 `,
-			wantErr: errors.New("units: unknown unit ZB in 655.4ZB"),
+			wantErr: errors.New(`pre-3.7: line 1: cache_size_kibibyte: size: invalid value: "655.4 zB"`),
 		},
 		{
 			tname: "unexpected max cache size unit",
 			input: `max cache size                      10.7 dB
 `,
-			wantErr: errors.New("units: unknown unit DB in 10.7DB"),
+			wantErr: errors.New(`pre-3.7: line 1: max_cache_size_kibibyte: size: invalid value: "10.7 dB"`),
+		},
+		{
+			tname: "unexpected counter value",
+			input: `cache miss                          many
+`,
+			wantErr: errors.New(`pre-3.7: line 1: cache_miss: statistics: invalid value: "many"`),
 		},
 	}
 
@@ -362,3 +570,54 @@ max cache size                      57.0 kB
 		})
 	}
 }
+
+func TestParsePre37StatisticsInLocation(t *testing.T) {
+	input := `stats updated                       Sat Oct  6 09:05:21 2018
+stats zeroed                        Mon Oct  1 08:00:00 2018
+`
+	loc := time.FixedZone("UTC+2", 2*60*60)
+
+	s, err := ParsePre37StatisticsInLocation(input, loc)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+
+	assertTimeFieldEquals(t, "StatsTime", s.StatsTime, time.Date(2018, time.October, 6, 7, 5, 21, 0, time.UTC))
+	assertTimeFieldEquals(t, "StatsZeroTime", s.StatsZeroTime, time.Date(2018, time.October, 1, 6, 0, 0, 0, time.UTC))
+}
+
+func TestFormatPre37StatisticsMatchesCcacheOutput(t *testing.T) {
+	// ccache 3.5 renamed "stats zero time" to "stats zeroed"
+	inputFilepaths, err := filepath.Glob(filepath.Join("testdata", "*-ccache-3.[56]", "*"))
+	if err != nil {
+		t.Fatalf("failed to list test inputs: %q", err)
+	}
+
+	if len(inputFilepaths) == 0 {
+		t.Fatal("no test input found")
+	}
+
+	for _, inputFilepath := range inputFilepaths {
+		if filepath.Base(inputFilepath) == "config" {
+			continue
+		}
+
+		t.Run(inputFilepath, func(t *testing.T) {
+			input, err := os.ReadFile(inputFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			stats, err := ParsePre37Statistics(string(input))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			got := FormatPre37Statistics(stats)
+
+			if got != string(input) {
+				t.Errorf("want:\n%s\ngot:\n%s", input, got)
+			}
+		})
+	}
+}
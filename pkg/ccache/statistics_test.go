@@ -6,6 +6,7 @@ package ccache
 import (
 	"math"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/units"
 )
@@ -13,6 +14,10 @@ import (
 func assertStatisticsEqual(t *testing.T, got, want *Statistics) {
 	t.Helper()
 
+	assertStringFieldEquals(t, "CacheDirectory", got.CacheDirectory, want.CacheDirectory)
+	assertStringFieldEquals(t, "PrimaryConfig", got.PrimaryConfig, want.PrimaryConfig)
+	assertStringFieldEquals(t, "SecondaryConfig", got.SecondaryConfig, want.SecondaryConfig)
+
 	assertIntFieldEquals(t, "CacheHitDirect", got.CacheHitDirect, want.CacheHitDirect)
 	assertIntFieldEquals(t, "CacheHitPreprocessed", got.CacheHitPreprocessed, want.CacheHitPreprocessed)
 	assertFloatFieldAlmostEquals(t, "CacheHitRate", got.CacheHitRate, want.CacheHitRate)
@@ -25,16 +30,48 @@ func assertStatisticsEqual(t *testing.T, got, want *Statistics) {
 	assertIntFieldEquals(t, "CalledForLink", got.CalledForLink, want.CalledForLink)
 	assertIntFieldEquals(t, "CalledForPreprocessing", got.CalledForPreprocessing, want.CalledForPreprocessing)
 
+	assertIntFieldEquals(t, "AutoconfTest", got.AutoconfTest, want.AutoconfTest)
+	assertIntFieldEquals(t, "BadCompilerArguments", got.BadCompilerArguments, want.BadCompilerArguments)
+	assertIntFieldEquals(t, "BadInputFile", got.BadInputFile, want.BadInputFile)
+	assertIntFieldEquals(t, "BadOutputFile", got.BadOutputFile, want.BadOutputFile)
 	assertIntFieldEquals(t, "CompilationFailed", got.CompilationFailed, want.CompilationFailed)
+	assertIntFieldEquals(t, "CompilerProducedEmptyOutput", got.CompilerProducedEmptyOutput, want.CompilerProducedEmptyOutput)
+	assertIntFieldEquals(t, "CompilerProducedNoOutput", got.CompilerProducedNoOutput, want.CompilerProducedNoOutput)
+	assertIntFieldEquals(t, "CompilerProducedStdout", got.CompilerProducedStdout, want.CompilerProducedStdout)
+	assertIntFieldEquals(t, "CouldNotUseModules", got.CouldNotUseModules, want.CouldNotUseModules)
+	assertIntFieldEquals(t, "CouldNotUsePrecompiledHeader", got.CouldNotUsePrecompiledHeader, want.CouldNotUsePrecompiledHeader)
+	assertIntFieldEquals(t, "Disabled", got.Disabled, want.Disabled)
+	assertIntFieldEquals(t, "ModifiedInputFile", got.ModifiedInputFile, want.ModifiedInputFile)
+	assertIntFieldEquals(t, "MultipleSourceFiles", got.MultipleSourceFiles, want.MultipleSourceFiles)
+	assertIntFieldEquals(t, "NoInputFile", got.NoInputFile, want.NoInputFile)
+	assertIntFieldEquals(t, "OutputToStdout", got.OutputToStdout, want.OutputToStdout)
 	assertIntFieldEquals(t, "PreprocessingFailed", got.PreprocessingFailed, want.PreprocessingFailed)
+	assertIntFieldEquals(t, "Recache", got.Recache, want.Recache)
 	assertIntFieldEquals(t, "UnsupportedCodeDirective", got.UnsupportedCodeDirective, want.UnsupportedCodeDirective)
-	assertIntFieldEquals(t, "NoInputFile", got.NoInputFile, want.NoInputFile)
+	assertIntFieldEquals(t, "UnsupportedCompilerOption", got.UnsupportedCompilerOption, want.UnsupportedCompilerOption)
+	assertIntFieldEquals(t, "UnsupportedEnvironmentVariable", got.UnsupportedEnvironmentVariable, want.UnsupportedEnvironmentVariable)
+	assertIntFieldEquals(t, "UnsupportedSourceLanguage", got.UnsupportedSourceLanguage, want.UnsupportedSourceLanguage)
+
+	assertIntFieldEquals(t, "CompilerCheckFailed", got.CompilerCheckFailed, want.CompilerCheckFailed)
+	assertIntFieldEquals(t, "CouldNotFindCompiler", got.CouldNotFindCompiler, want.CouldNotFindCompiler)
+	assertIntFieldEquals(t, "ErrorHashingExtraFile", got.ErrorHashingExtraFile, want.ErrorHashingExtraFile)
+	assertIntFieldEquals(t, "InternalError", got.InternalError, want.InternalError)
+	assertIntFieldEquals(t, "MissingCacheFile", got.MissingCacheFile, want.MissingCacheFile)
 
 	assertIntFieldEquals(t, "CleanupsPerformed", got.CleanupsPerformed, want.CleanupsPerformed)
 	assertIntFieldEquals(t, "FilesInCache", got.FilesInCache, want.FilesInCache)
+	assertIntFieldEquals(t, "MaxFilesInCache", got.MaxFilesInCache, want.MaxFilesInCache)
 
 	assertStringFieldEquals(t, "CacheSize", got.CacheSize, want.CacheSize)
 	assertMetricByteFieldEquals(t, "CacheSizeBytes", got.CacheSizeBytes, want.CacheSizeBytes)
+	assertStringFieldEquals(t, "MaxCacheSize", got.MaxCacheSize, want.MaxCacheSize)
+	assertMetricByteFieldEquals(t, "MaxCacheSizeBytes", got.MaxCacheSizeBytes, want.MaxCacheSizeBytes)
+
+	assertIntFieldEquals(t, "LocalStorageHit", got.LocalStorageHit, want.LocalStorageHit)
+	assertIntFieldEquals(t, "LocalStorageMiss", got.LocalStorageMiss, want.LocalStorageMiss)
+	assertIntFieldEquals(t, "LocalStorageReadHit", got.LocalStorageReadHit, want.LocalStorageReadHit)
+	assertIntFieldEquals(t, "LocalStorageReadMiss", got.LocalStorageReadMiss, want.LocalStorageReadMiss)
+	assertIntFieldEquals(t, "LocalStorageWrite", got.LocalStorageWrite, want.LocalStorageWrite)
 
 	assertIntFieldEquals(t, "RemoteStorageError", got.RemoteStorageError, want.RemoteStorageError)
 	assertIntFieldEquals(t, "RemoteStorageHit", got.RemoteStorageHit, want.RemoteStorageHit)
@@ -45,6 +82,31 @@ func assertStatisticsEqual(t *testing.T, got, want *Statistics) {
 	assertIntFieldEquals(t, "RemoteStorageWrite", got.RemoteStorageWrite, want.RemoteStorageWrite)
 }
 
+func assertCountersEqual(t *testing.T, got, want map[string]int64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("Counters: want %d counters, got %d", len(want), len(got))
+	}
+
+	for key, wantValue := range want {
+		gotValue, ok := got[key]
+		if !ok {
+			t.Errorf("Counters: missing counter %q", key)
+			continue
+		}
+
+		assertIntFieldEquals(t, key, gotValue, wantValue)
+	}
+}
+
+func assertBoolFieldEquals(t *testing.T, fieldName string, got, want bool) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s: want %t, got %t", fieldName, want, got)
+	}
+}
+
 func assertFloatFieldAlmostEquals(t *testing.T, fieldName string, got, want float64) {
 	t.Helper()
 	if math.Abs(got-want) > 0.01 {
@@ -52,7 +114,7 @@ func assertFloatFieldAlmostEquals(t *testing.T, fieldName string, got, want floa
 	}
 }
 
-func assertIntFieldEquals(t *testing.T, fieldName string, got, want int) {
+func assertIntFieldEquals(t *testing.T, fieldName string, got, want int64) {
 	t.Helper()
 	if got != want {
 		t.Errorf("%s: want %d, got %d", fieldName, want, got)
@@ -66,6 +128,13 @@ func assertMetricByteFieldEquals(t *testing.T, fieldName string, got, want units
 	}
 }
 
+func assertTimeFieldEquals(t *testing.T, fieldName string, got, want time.Time) {
+	t.Helper()
+	if !got.Equal(want) {
+		t.Errorf("%s: want %q, got %q", fieldName, want, got)
+	}
+}
+
 func assertStringFieldEquals(t *testing.T, fieldName, got, want string) {
 	t.Helper()
 	if got != want {
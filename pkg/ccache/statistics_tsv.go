@@ -4,13 +4,9 @@
 package ccache
 
 import (
-	"encoding/csv"
-	"fmt"
+	"sort"
 	"strconv"
 	"strings"
-	"time"
-
-	"github.com/alecthomas/units"
 )
 
 // ParseTSVStatistics reads ccache statistics as formatted by the `ccache --print-stats` command.
@@ -18,174 +14,127 @@ import (
 // It relies upon the `ccache --print-stats` command to output machine-readable
 // statistics.
 func ParseTSVStatistics(text string) (*Statistics, error) {
-	r := strings.NewReader(text)
+	return parseTSVStatistics(newParseState(StatisticsFormatTSV, ParseModeDefault), text)
+}
 
-	tsvReader := csv.NewReader(r)
-	tsvReader.Comma = '\t'
+func parseTSVStatistics(p *parseState, text string) (*Statistics, error) {
+	stats := &Statistics{}
 
-	tsvData, err := tsvReader.ReadAll()
-	if err != nil {
-		return &Statistics{}, err
-	}
+	scanner := newOutputScanner(text)
+	lineNumber := 0
 
-	stats := &Statistics{}
+	for scanner.Scan() {
+		lineNumber++
 
-	for _, row := range tsvData {
-		if len(row) != 2 {
-			// for each row, we expect a key and a value
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
 
-		switch row[0] {
-		case "cache_miss":
-			stats.CacheMiss, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
-		case "cache_size_kibibyte":
-			cacheSizeBytes, err := units.ParseBase2Bytes(fmt.Sprintf("%sKiB", row[1]))
-			if err != nil {
+		// for each row, we expect a key and a value
+		key, rawValue, ok := strings.Cut(line, "\t")
+		if !ok || strings.Contains(rawValue, "\t") || !isValidStatisticsKey(key) {
+			if err := p.invalidLine(lineNumber, line); err != nil {
 				return &Statistics{}, err
 			}
-			stats.CacheSizeBytes = units.MetricBytes(cacheSizeBytes)
+			continue
+		}
 
-		case "called_for_link":
-			stats.CalledForLink, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+		p.entries++
 
-		case "called_for_preprocessing":
-			stats.CalledForPreprocessing, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
+		value, err := strconv.ParseInt(rawValue, 10, 64)
+		if err != nil {
+			if !isStatisticsKey(key) {
+				// unknown key, possibly introduced by a newer version of ccache
+				if err := p.unknown(lineNumber, key, rawValue); err != nil {
+					return &Statistics{}, err
+				}
+				continue
 			}
 
-		case "compile_failed":
-			stats.CompilationFailed, err = strconv.Atoi(row[1])
-			if err != nil {
+			if err := p.malformed(lineNumber, key, rawValue, err); err != nil {
 				return &Statistics{}, err
 			}
+			continue
+		}
 
-		case "direct_cache_hit":
-			stats.CacheHitDirect, err = strconv.Atoi(row[1])
-			if err != nil {
+		if !isStatisticsKey(key) {
+			if err := p.unknown(lineNumber, key, rawValue); err != nil {
 				return &Statistics{}, err
 			}
+		}
 
-		case "direct_cache_miss":
-			stats.CacheMissDirect, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+		stats.setValue(key, value)
+	}
 
-		case "files_in_cache":
-			stats.FilesInCache, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	if err := scanner.Err(); err != nil {
+		return &Statistics{}, err
+	}
 
-		case "no_input_file":
-			stats.NoInputFile, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	if err := p.noEntry(); err != nil {
+		return &Statistics{}, err
+	}
 
-		case "preprocessed_cache_hit":
-			stats.CacheHitPreprocessed, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	stats.updateDerivedFields()
 
-		case "preprocessed_cache_miss":
-			stats.CacheMissPreprocessed, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	return stats, nil
+}
 
-		case "preprocessor_error":
-			stats.PreprocessingFailed, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+// FormatTSVStatistics writes statistics as formatted by the
+// `ccache --print-stats` command.
+//
+// Keys are sorted, and the cache sizes are rounded down to the kibibyte.
+func FormatTSVStatistics(stats *Statistics) string {
+	values := stats.machineReadableValues()
 
-		case "remote_storage_error":
-			stats.RemoteStorageError, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-		case "remote_storage_hit":
-			stats.RemoteStorageHit, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	var sb strings.Builder
 
-		case "remote_storage_miss":
-			stats.RemoteStorageMiss, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	for _, key := range keys {
+		sb.WriteString(key + "\t" + strconv.FormatInt(values[key], 10) + "\n")
+	}
 
-		case "remote_storage_read_hit":
-			stats.RemoteStorageReadHit, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	return sb.String()
+}
 
-		case "remote_storage_read_miss":
-			stats.RemoteStorageReadMiss, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+// machineReadableValues returns the key/value pairs reported by
+// `ccache --print-stats` for these statistics.
+//
+// Statistics fields take precedence over the values recorded in Counters.
+func (s *Statistics) machineReadableValues() map[string]int64 {
+	values := map[string]int64{}
 
-		case "remote_storage_timeout":
-			stats.RemoteStorageTimeout, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	for key := range s.Counters {
+		values[key] = s.counterValue(key)
+	}
 
-		case "remote_storage_write":
-			stats.RemoteStorageWrite, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
+	if s.Counters == nil {
+		for key := range statisticsCounters {
+			values[key] = s.counterValue(key)
+		}
+	}
 
-		case "stats_updated_timestamp":
-			unixTime, err := strconv.ParseInt(row[1], 10, 64)
-			if err != nil {
-				return &Statistics{}, err
-			}
-			stats.StatsTime = time.Unix(unixTime, 0).UTC()
+	setValue := func(key string, value int64, reported bool) {
+		if _, ok := values[key]; ok || reported {
+			values[key] = value
+		}
+	}
 
-		case "stats_zeroed_timestamp":
-			unixTime, err := strconv.ParseInt(row[1], 10, 64)
-			if err != nil {
-				return &Statistics{}, err
-			}
-			stats.StatsZeroTime = time.Unix(unixTime, 0).UTC()
+	setValue("cache_size_kibibyte", int64(s.CacheSizeBytes)/1024, s.CacheSizeBytes != 0)
+	setValue("max_cache_size_kibibyte", int64(s.MaxCacheSizeBytes)/1024, s.MaxCacheSizeBytes != 0)
 
-		case "unsupported_code_directive":
-			stats.UnsupportedCodeDirective, err = strconv.Atoi(row[1])
-			if err != nil {
-				return &Statistics{}, err
-			}
-		}
+	if !s.StatsTime.IsZero() {
+		setValue("stats_updated_timestamp", s.StatsTime.Unix(), true)
 	}
 
-	// Compute fields for compatibility
-	//
-	// FIXME: "ccache --show-stats" returns seemingly incoherent values
-	//        regarding cache hits and misses, making it hard to tell how ratios
-	//        should be computed
-	cacheHitTotal := stats.CacheHitDirect + stats.CacheHitPreprocessed
-	cacheCallTotal := stats.CacheHitDirect + stats.CacheHitPreprocessed + stats.CacheMiss + stats.CacheMissDirect + stats.CacheMissPreprocessed
-
-	if cacheCallTotal > 0 {
-		stats.CacheHitRatio = float64(cacheHitTotal) / float64(cacheCallTotal)
-		stats.CacheHitRate = 100 * stats.CacheHitRatio
+	if !s.StatsZeroTime.IsZero() {
+		setValue("stats_zeroed_timestamp", s.StatsZeroTime.Unix(), true)
 	}
-	stats.CacheSize = stats.CacheSizeBytes.Floor().String()
 
-	return stats, nil
+	return values
 }
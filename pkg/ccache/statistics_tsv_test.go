@@ -4,9 +4,12 @@
 package ccache
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/alecthomas/units"
@@ -56,6 +59,7 @@ func TestParseTSVStatistics(t *testing.T) {
 						FilesInCache:          298,
 						CacheSize:             "4MB",
 						CacheSizeBytes:        units.MetricBytes(4263936),
+						LocalStorageMiss:      305,
 					},
 				},
 				{
@@ -67,8 +71,8 @@ func TestParseTSVStatistics(t *testing.T) {
 						CacheMiss:             150,
 						CacheMissDirect:       164,
 						CacheMissPreprocessed: 152,
-						CacheHitRate:          24.350649,
-						CacheHitRatio:         0.2435049,
+						CacheHitRate:          50,
+						CacheHitRatio:         0.5,
 						CalledForLink:         88,
 						CompilationFailed:     2,
 						NoInputFile:           9,
@@ -76,6 +80,8 @@ func TestParseTSVStatistics(t *testing.T) {
 						FilesInCache:          298,
 						CacheSize:             "4MB",
 						CacheSizeBytes:        units.MetricBytes(4263936),
+						LocalStorageHit:       298,
+						LocalStorageMiss:      312,
 					},
 				},
 			},
@@ -157,6 +163,9 @@ func TestParseTSVStatistics(t *testing.T) {
 						FilesInCache:           290,
 						CacheSize:              "24MB",
 						CacheSizeBytes:         units.MetricBytes(24883200),
+						LocalStorageMiss:       150,
+						LocalStorageReadMiss:   302,
+						LocalStorageWrite:      290,
 					},
 				},
 				{
@@ -168,8 +177,8 @@ func TestParseTSVStatistics(t *testing.T) {
 						CacheMiss:              181,
 						CacheMissDirect:        199,
 						CacheMissPreprocessed:  189,
-						CacheHitRate:           16.323529,
-						CacheHitRatio:          0.163235,
+						CacheHitRate:           38.013699,
+						CacheHitRatio:          0.380137,
 						CalledForLink:          82,
 						CalledForPreprocessing: 0,
 						CompilationFailed:      8,
@@ -178,6 +187,11 @@ func TestParseTSVStatistics(t *testing.T) {
 						FilesInCache:           360,
 						CacheSize:              "25MB",
 						CacheSizeBytes:         units.MetricBytes(25260032),
+						LocalStorageHit:        111,
+						LocalStorageMiss:       189,
+						LocalStorageReadHit:    220,
+						LocalStorageReadMiss:   384,
+						LocalStorageWrite:      360,
 					},
 				},
 			},
@@ -200,6 +214,8 @@ func TestParseTSVStatistics(t *testing.T) {
 					inputFilename: "firstbuild.tsv",
 					wantStats: Statistics{
 						CacheMiss:              69,
+						AutoconfTest:           26,
+						BadCompilerArguments:   1,
 						CalledForLink:          2,
 						CalledForPreprocessing: 11,
 						CompilationFailed:      5,
@@ -219,6 +235,8 @@ func TestParseTSVStatistics(t *testing.T) {
 						CacheMiss:              69,
 						CacheHitRate:           50,
 						CacheHitRatio:          0.5,
+						AutoconfTest:           52,
+						BadCompilerArguments:   2,
 						CalledForLink:          4,
 						CalledForPreprocessing: 22,
 						CompilationFailed:      10,
@@ -259,6 +277,7 @@ func TestParseTSVStatistics(t *testing.T) {
 						FilesInCache:           506,
 						CacheSize:              "134MB",
 						CacheSizeBytes:         units.MetricBytes(134987776),
+						LocalStorageMiss:       512,
 					},
 				},
 				{
@@ -270,8 +289,8 @@ func TestParseTSVStatistics(t *testing.T) {
 						CacheMiss:              255,
 						CacheMissDirect:        267,
 						CacheMissPreprocessed:  257,
-						CacheHitRate:           16.326531,
-						CacheHitRatio:          0.163265,
+						CacheHitRate:           37.346437,
+						CacheHitRatio:          0.373464,
 						CalledForLink:          90,
 						CalledForPreprocessing: 105,
 						CompilationFailed:      2,
@@ -280,6 +299,8 @@ func TestParseTSVStatistics(t *testing.T) {
 						FilesInCache:           506,
 						CacheSize:              "134MB",
 						CacheSizeBytes:         units.MetricBytes(134987776),
+						LocalStorageHit:        302,
+						LocalStorageMiss:       518,
 					},
 				},
 			},
@@ -294,7 +315,9 @@ func TestParseTSVStatistics(t *testing.T) {
 					tname:         "empty cache",
 					inputFilename: "empty.tsv",
 					wantStats: Statistics{
-						CacheSize: "0B",
+						CacheSize:         "0B",
+						MaxCacheSize:      "5GB",
+						MaxCacheSizeBytes: units.MetricBytes(5368709120),
 					},
 				},
 				{
@@ -311,6 +334,11 @@ func TestParseTSVStatistics(t *testing.T) {
 						FilesInCache:          292,
 						CacheSize:             "79MB",
 						CacheSizeBytes:        units.MetricBytes(79470592),
+						MaxCacheSize:          "5GB",
+						MaxCacheSizeBytes:     units.MetricBytes(5368709120),
+						LocalStorageMiss:      147,
+						LocalStorageReadMiss:  309,
+						LocalStorageWrite:     292,
 					},
 				},
 				{
@@ -322,8 +350,8 @@ func TestParseTSVStatistics(t *testing.T) {
 						CacheMiss:             176,
 						CacheMissDirect:       198,
 						CacheMissPreprocessed: 190,
-						CacheHitRate:          17.302053,
-						CacheHitRatio:         0.173020,
+						CacheHitRate:          40.136054,
+						CacheHitRatio:         0.401361,
 						CalledForLink:         70,
 						CompilationFailed:     14,
 						NoInputFile:           30,
@@ -331,6 +359,13 @@ func TestParseTSVStatistics(t *testing.T) {
 						FilesInCache:          350,
 						CacheSize:             "79MB",
 						CacheSizeBytes:        units.MetricBytes(79892480),
+						MaxCacheSize:          "5GB",
+						MaxCacheSizeBytes:     units.MetricBytes(5368709120),
+						LocalStorageHit:       118,
+						LocalStorageMiss:      176,
+						LocalStorageReadHit:   234,
+						LocalStorageReadMiss:  384,
+						LocalStorageWrite:     350,
 					},
 				},
 			},
@@ -386,7 +421,9 @@ func TestParseTSVStatisticsWithRemoteStorage(t *testing.T) {
 					tname:         "empty cache",
 					inputFilename: "empty.tsv",
 					wantStats: Statistics{
-						CacheSize: "0B",
+						CacheSize:         "0B",
+						MaxCacheSize:      "5GB",
+						MaxCacheSizeBytes: units.MetricBytes(5368709120),
 					},
 				},
 				{
@@ -397,6 +434,8 @@ func TestParseTSVStatisticsWithRemoteStorage(t *testing.T) {
 						CacheMissDirect:       157,
 						CacheMissPreprocessed: 154,
 						CacheSize:             "0B",
+						MaxCacheSize:          "5GB",
+						MaxCacheSizeBytes:     units.MetricBytes(5368709120),
 						CalledForLink:         35,
 						CompilationFailed:     7,
 						NoInputFile:           15,
@@ -415,10 +454,12 @@ func TestParseTSVStatisticsWithRemoteStorage(t *testing.T) {
 						CacheMiss:             176,
 						CacheMissDirect:       198,
 						CacheMissPreprocessed: 190,
-						CacheHitRate:          17.302053,
-						CacheHitRatio:         0.173020,
+						CacheHitRate:          40.136054,
+						CacheHitRatio:         0.401361,
 						CalledForLink:         70,
 						CacheSize:             "0B",
+						MaxCacheSize:          "5GB",
+						MaxCacheSizeBytes:     units.MetricBytes(5368709120),
 						CompilationFailed:     14,
 						NoInputFile:           30,
 						PreprocessingFailed:   6,
@@ -468,3 +509,186 @@ func TestParseTSVStatisticsWithRemoteStorage(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTSVStatisticsHistoricalKeys(t *testing.T) {
+	inputFilepaths := []string{
+		filepath.Join("testdata", "arch-rolling-ccache-4.6.1", "firstbuild.tsv"),
+		filepath.Join("testdata", "arch-rolling-ccache-4.6.1", "secondbuild.tsv"),
+		filepath.Join("testdata", "ubuntu-22.04-ccache-4.5.1", "firstbuild.tsv"),
+		filepath.Join("testdata", "ubuntu-22.04-ccache-4.5.1", "secondbuild.tsv"),
+	}
+
+	renamedKeys := map[string]bool{}
+
+	for _, inputFilepath := range inputFilepaths {
+		t.Run(inputFilepath, func(t *testing.T) {
+			input, err := os.ReadFile(inputFilepath)
+			if err != nil {
+				t.Fatalf("failed to open test input: %q", err)
+			}
+
+			s, err := ParseTSVStatistics(string(input))
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			for _, line := range strings.Split(strings.TrimSpace(string(input)), "\n") {
+				key, rawValue, _ := strings.Cut(line, "\t")
+
+				alias, ok := statisticsKeyAliases[key]
+				if !ok {
+					continue
+				}
+
+				renamedKeys[key] = true
+
+				if _, ok := s.Counters[key]; ok {
+					t.Errorf("Counters: want %q to be recorded as %q", key, alias)
+				}
+
+				value, err := strconv.ParseInt(rawValue, 10, 64)
+				if err != nil {
+					t.Fatalf("failed to parse test input: %q", err)
+				}
+
+				assertIntFieldEquals(t, alias, s.Counters[alias], value)
+				assertIntFieldEquals(t, alias+" (field)", *s.counter(alias), value)
+			}
+		})
+	}
+
+	for key := range statisticsKeyAliases {
+		if !renamedKeys[key] {
+			t.Errorf("no test input contains %q", key)
+		}
+	}
+}
+
+func TestParseTSVStatisticsHistoricalKeysValues(t *testing.T) {
+	input := `primary_storage_hit	1
+primary_storage_miss	2
+secondary_storage_error	3
+secondary_storage_hit	4
+secondary_storage_miss	5
+secondary_storage_timeout	6
+`
+
+	want := Statistics{
+		LocalStorageHit:      1,
+		LocalStorageMiss:     2,
+		RemoteStorageError:   3,
+		RemoteStorageHit:     4,
+		RemoteStorageMiss:    5,
+		RemoteStorageTimeout: 6,
+		CacheSize:            "0B",
+	}
+
+	got, err := ParseTSVStatistics(input)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+
+	assertStatisticsEqual(t, got, &want)
+	assertCountersEqual(t, got.Counters, map[string]int64{
+		"local_storage_hit":      1,
+		"local_storage_miss":     2,
+		"remote_storage_error":   3,
+		"remote_storage_hit":     4,
+		"remote_storage_miss":    5,
+		"remote_storage_timeout": 6,
+	})
+}
+
+func TestParseTSVStatisticsEdgeCases(t *testing.T) {
+	cases := []struct {
+		tname     string
+		input     string
+		wantStats Statistics
+		wantErr   error
+	}{
+		{
+			tname: "64-bit counters",
+			input: "cache_miss\t4294967296\nlocal_storage_read_miss\t9223372036854775807\n",
+			wantStats: Statistics{
+				CacheMiss:            4294967296,
+				LocalStorageReadMiss: 9223372036854775807,
+				CacheSize:            "0B",
+			},
+		},
+		{
+			tname: "unknown counters are ignored",
+			input: "cache_miss\t3\nunknown_counter\t12\n",
+			wantStats: Statistics{
+				CacheMiss: 3,
+				CacheSize: "0B",
+			},
+		},
+		{
+			tname: "keys with invalid characters are ignored",
+			input: "cache_miss\t3\nnew_\xffkey\t3\nNew-Counter\t4\n",
+			wantStats: Statistics{
+				CacheMiss: 3,
+				CacheSize: "0B",
+				Counters: map[string]int64{
+					"cache_miss": 3,
+				},
+			},
+		},
+
+		// error cases
+		{
+			tname:   "invalid counter value",
+			input:   "local_storage_hit\tmany\n",
+			wantErr: errors.New("tsv: line 1: local_storage_hit: strconv.ParseInt: parsing \"many\": invalid syntax"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			s, err := ParseTSVStatistics(tc.input)
+
+			if tc.wantErr != nil {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				} else if err.Error() != tc.wantErr.Error() {
+					t.Fatalf("want error %q, got %q", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %q", err)
+			}
+
+			assertStatisticsEqual(t, s, &tc.wantStats)
+
+			if tc.wantStats.Counters != nil {
+				assertCountersEqual(t, s.Counters, tc.wantStats.Counters)
+			}
+		})
+	}
+}
+
+func TestParseTSVStatisticsCounters(t *testing.T) {
+	input := `cache_miss	176
+local_storage_read_hit	234
+stats_updated_timestamp	1708109988
+some_future_counter	42
+some_future_setting	enabled
+`
+
+	want := map[string]int64{
+		"cache_miss":              176,
+		"local_storage_read_hit":  234,
+		"stats_updated_timestamp": 1708109988,
+		"some_future_counter":     42,
+	}
+
+	s, err := ParseTSVStatistics(input)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+
+	assertCountersEqual(t, s.Counters, want)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	featureRegex        = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+	libraryVersionRegex = regexp.MustCompile(`^([A-Za-z0-9_.+-]+)(?:\s+version)?\s+v?(\d[A-Za-z0-9_.+-]*)$`)
+)
+
+// VersionInfo describes a ccache build, as printed by `ccache --version`.
+type VersionInfo struct {
+	Version string `json:"version"`
+
+	// Features compiled in ccache, e.g. "http-storage" or "redis-storage";
+	// empty for ccache < 4.0, which does not list them.
+	Features []string `json:"features"`
+
+	// Versions of the libraries ccache was built with, by library name, if
+	// listed by ccache.
+	Libraries map[string]string `json:"libraries,omitempty"`
+}
+
+// HasFeature returns whether ccache was built with the given feature, e.g.
+// "redis-storage".
+func (v *VersionInfo) HasFeature(feature string) bool {
+	return slices.Contains(v.Features, feature)
+}
+
+// ParseVersionInfo parses the version, features and library versions printed
+// by `ccache --version`.
+//
+// Features are read from the "Features:" line, e.g.
+//
+//	Features: file-storage http-storage redis+unix-storage redis-storage
+//
+// Library versions are read from a "Libraries:" line listing comma-separated
+// "<name> <version>" pairs, or from the indented lines following it.
+//
+// Features, library names and versions that are not made of ASCII letters,
+// digits and "_.+-" characters are ignored.
+func ParseVersionInfo(text string) (*VersionInfo, error) {
+	if err := checkOutputSize(text); err != nil {
+		return &VersionInfo{}, err
+	}
+
+	version, err := parseVersion(text)
+	if err != nil {
+		return &VersionInfo{}, err
+	}
+
+	info := &VersionInfo{
+		Version:  version.Original(),
+		Features: []string{},
+	}
+
+	inLibraries := false
+
+	scanner := newOutputScanner(text)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if inLibraries && strings.HasPrefix(line, " ") {
+			info.addLibraries(line)
+			continue
+		}
+
+		inLibraries = false
+
+		label, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		switch strings.TrimSpace(label) {
+		case "Features":
+			for _, feature := range strings.Fields(value) {
+				if featureRegex.MatchString(feature) {
+					info.Features = append(info.Features, feature)
+				}
+			}
+
+		case "Libraries":
+			info.addLibraries(value)
+			inLibraries = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return &VersionInfo{}, err
+	}
+
+	slices.Sort(info.Features)
+	info.Features = slices.Compact(info.Features)
+
+	return info, nil
+}
+
+// addLibraries records the library versions listed in a comma-separated list
+// of "<name> <version>" pairs; entries that do not match are ignored.
+func (v *VersionInfo) addLibraries(list string) {
+	for _, entry := range strings.Split(list, ",") {
+		matches := libraryVersionRegex.FindStringSubmatch(strings.TrimSpace(entry))
+		if len(matches) != 3 {
+			continue
+		}
+
+		if v.Libraries == nil {
+			v.Libraries = make(map[string]string)
+		}
+
+		v.Libraries[strings.ToLower(matches[1])] = matches[2]
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) VirtualTam
+// SPDX-License-Identifier: MIT
+
+package ccache
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseVersionInfo(t *testing.T) {
+	cases := []struct {
+		tname   string
+		input   string
+		want    VersionInfo
+		wantErr error
+	}{
+		{
+			tname: "ccache 3.3.4",
+			input: `
+ccache version 3.3.4
+
+Copyright (C) 2002-2007 Andrew Tridgell
+Copyright (C) 2009-2017 Joel Rosdahl
+`,
+			want: VersionInfo{
+				Version:  "3.3.4",
+				Features: []string{},
+			},
+		},
+		{
+			tname: "ccache 4.6.1",
+			input: `ccache version 4.6.1
+Features: file-storage http-storage redis-storage
+
+Copyright (C) 2002-2007 Andrew Tridgell
+Copyright (C) 2009-2022 Joel Rosdahl and other contributors
+`,
+			want: VersionInfo{
+				Version:  "4.6.1",
+				Features: []string{"file-storage", "http-storage", "redis-storage"},
+			},
+		},
+		{
+			tname: "ccache 4.10.2 without Redis support",
+			input: `ccache version 4.10.2
+Features: avx2 file-storage http-storage
+Libraries: blake3 1.5.1, fmt 10.2.1, xxhash 0.8.2, zstd 1.5.6
+
+Copyright (C) 2002-2007 Andrew Tridgell
+`,
+			want: VersionInfo{
+				Version:  "4.10.2",
+				Features: []string{"avx2", "file-storage", "http-storage"},
+				Libraries: map[string]string{
+					"blake3": "1.5.1",
+					"fmt":    "10.2.1",
+					"xxhash": "0.8.2",
+					"zstd":   "1.5.6",
+				},
+			},
+		},
+		{
+			tname: "libraries listed on indented lines",
+			input: `ccache version 4.11
+Features: redis-storage redis+unix-storage file-storage redis-storage
+Libraries:
+  Hiredis version 1.2.0
+  zstd v1.5.6
+  unknown
+Copyright (C) 2002-2007 Andrew Tridgell
+`,
+			want: VersionInfo{
+				Version:  "4.11",
+				Features: []string{"file-storage", "redis+unix-storage", "redis-storage"},
+				Libraries: map[string]string{
+					"hiredis": "1.2.0",
+					"zstd":    "1.5.6",
+				},
+			},
+		},
+		{
+			tname: "invalid features and libraries are ignored",
+			input: "ccache version 4.10.2\n" +
+				"Features: file-storage http-\xffstorage redis storage,\n" +
+				"Libraries: blake3 1.5.1, f\xffmt 10.2.1, xxhash 0.8\xff2, zstd 1.5.6\n",
+			want: VersionInfo{
+				Version:  "4.10.2",
+				Features: []string{"file-storage", "redis"},
+				Libraries: map[string]string{
+					"blake3": "1.5.1",
+					"zstd":   "1.5.6",
+				},
+			},
+		},
+
+		// error cases
+		{
+			tname:   "missing version",
+			input:   "Features: file-storage\n",
+			wantErr: ErrVersionMissing,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			got, err := ParseVersionInfo(tc.input)
+
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("want error %q, got %q", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			if got.Version != tc.want.Version {
+				t.Errorf("want version %q, got %q", tc.want.Version, got.Version)
+			}
+
+			if !slices.Equal(got.Features, tc.want.Features) {
+				t.Errorf("want features %q, got %q", tc.want.Features, got.Features)
+			}
+
+			if !maps.Equal(got.Libraries, tc.want.Libraries) {
+				t.Errorf("want libraries %v, got %v", tc.want.Libraries, got.Libraries)
+			}
+		})
+	}
+}
+
+func TestWrapperVersionInfo(t *testing.T) {
+	cmd := &upgradableCommand{
+		fakeCommand: &fakeCommand{},
+		version:     "ccache version 4.9.1\nFeatures: file-storage http-storage\n",
+	}
+
+	wrapper := newTestWrapper(t, cmd)
+
+	info := wrapper.VersionInfo()
+
+	if info.HasFeature("redis-storage") {
+		t.Error("want no Redis support")
+	}
+
+	// the returned value must not alias the state of the wrapper
+	info.Features[0] = "redis-storage"
+
+	if wrapper.VersionInfo().HasFeature("redis-storage") {
+		t.Error("want the version info of the wrapper to be left unchanged")
+	}
+
+	cmd.upgrade("4.10\nFeatures: file-storage http-storage redis-storage")
+
+	if err := wrapper.DetectVersion(context.Background()); err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	if !wrapper.VersionInfo().HasFeature("redis-storage") {
+		t.Error("want Redis support after the upgrade")
+	}
+}
@@ -4,8 +4,16 @@
 package ccache
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"maps"
+	"os/exec"
 	"regexp"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 )
@@ -15,88 +23,362 @@ var (
 )
 
 var (
-	versionRegex                    = regexp.MustCompile("ccache version (.+)")
-	useLegacyParserForVersionsBelow = semver.MustParse("3.7")
+	versionRegex = regexp.MustCompile("ccache version (.+)")
+
+	// as printed by getopt, e.g. "ccache: unrecognized option '--format=json'"
+	unrecognizedOptionRegex = regexp.MustCompile(`(?:unrecognized|invalid) option.*--format`)
 )
 
 // Wrapper provides an abstraction for ccache commands.
+//
+// The version of ccache, which determines how statistics are read, is detected
+// again when the ccache executable is replaced, if the Command implements
+// BinaryIdentifier.
+//
+// A Wrapper is safe for concurrent use.
 type Wrapper struct {
-	command    Command
-	version    semver.Version
-	versionStr string
+	command         Command
+	onVersionChange func(VersionChange)
+
+	// time zone of the timestamps printed by ccache < 3.7
+	location *time.Location
+
+	// serializes version detections
+	detectMu sync.Mutex
+
+	mu           sync.RWMutex
+	binary       *BinaryIdentity
+	version      semver.Version
+	versionStr   string
+	versionInfo  *VersionInfo
+	capabilities *Capabilities
+
+	// whether ccache can print statistics as JSON
+	supportsJSONStatistics bool
 }
 
-// NewWrapper initializes and returns a new Wrapper.
-func NewWrapper(c Command) *Wrapper {
+// VersionChange describes a change of the version of ccache, detected after
+// its executable was replaced.
+type VersionChange struct {
+	Previous string
+	Current  string
+
+	// Identity of the new executable; nil if the Command does not implement
+	// BinaryIdentifier.
+	Binary *BinaryIdentity
+}
+
+// WrapperOption configures a Wrapper.
+type WrapperOption func(*Wrapper)
+
+// WithVersionChangeHandler sets a function called when a new version of ccache
+// is detected, e.g. to log the transition.
+func WithVersionChangeHandler(handler func(VersionChange)) WrapperOption {
+	return func(w *Wrapper) {
+		w.onVersionChange = handler
+	}
+}
+
+// WithLocation sets the time zone of the host running ccache, in which the
+// timestamps printed by ccache < 3.7 are expressed; defaults to the local time
+// zone.
+func WithLocation(loc *time.Location) WrapperOption {
+	return func(w *Wrapper) {
+		w.location = loc
+	}
+}
+
+// wrapperState holds the detected version of ccache, and the parser strategy
+// derived from its capabilities.
+type wrapperState struct {
+	version      semver.Version
+	versionStr   string
+	capabilities *Capabilities
+
+	supportsJSONStatistics bool
+}
+
+// NewWrapper detects the version of ccache, and returns a new Wrapper.
+func NewWrapper(ctx context.Context, c Command, options ...WrapperOption) (*Wrapper, error) {
 	w := &Wrapper{
-		command: c,
+		command:  c,
+		location: time.Local,
+	}
+
+	for _, option := range options {
+		option(w)
+	}
+
+	if err := w.detectVersion(ctx, w.binaryIdentity()); err != nil {
+		return nil, err
 	}
 
-	v, err := w.ParseVersion()
+	return w, nil
+}
+
+// binaryIdentity returns the identity of the ccache executable, or nil if it
+// cannot be determined.
+func (w *Wrapper) binaryIdentity() *BinaryIdentity {
+	identifier, ok := w.command.(BinaryIdentifier)
+	if !ok {
+		return nil
+	}
+
+	binary, err := identifier.BinaryIdentity()
+	if err != nil {
+		return nil
+	}
+
+	return &binary
+}
+
+// DetectVersion detects the version of ccache, and updates the parser strategy
+// accordingly.
+//
+// This is done automatically when the ccache executable is replaced, if the
+// Command implements BinaryIdentifier.
+func (w *Wrapper) DetectVersion(ctx context.Context) error {
+	return w.detectVersion(ctx, w.binaryIdentity())
+}
+
+// detectVersion detects the version of ccache, unless the given executable is
+// the one for which the version was last detected.
+func (w *Wrapper) detectVersion(ctx context.Context, binary *BinaryIdentity) error {
+	w.detectMu.Lock()
+	defer w.detectMu.Unlock()
+
+	if binary != nil && w.isCurrentBinary(*binary) {
+		// detected by a concurrent call
+		return nil
+	}
+
+	out, err := w.command.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	v, err := parseVersion(out)
+	if err != nil {
+		return err
+	}
+
+	versionInfo, err := ParseVersionInfo(out)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	w.mu.Lock()
+
+	previous := w.versionStr
+
+	w.binary = binary
 	w.version = *v
 	w.versionStr = v.Original()
+	w.versionInfo = versionInfo
+	w.capabilities = CapabilitiesFor(v)
+	w.supportsJSONStatistics = w.capabilities.HasCommand(CommandPrintStatsJSON)
+
+	w.mu.Unlock()
+
+	if previous != "" && previous != v.Original() && w.onVersionChange != nil {
+		w.onVersionChange(VersionChange{
+			Previous: previous,
+			Current:  v.Original(),
+			Binary:   binary,
+		})
+	}
 
-	return w
+	return nil
+}
+
+// isCurrentBinary returns whether the version was detected for the given
+// executable.
+func (w *Wrapper) isCurrentBinary(binary BinaryIdentity) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.binary != nil && w.binary.Equal(binary)
+}
+
+// state returns the detected version of ccache, after detecting it again if
+// the executable was replaced.
+func (w *Wrapper) state(ctx context.Context) (wrapperState, error) {
+	if binary := w.binaryIdentity(); binary != nil && !w.isCurrentBinary(*binary) {
+		if err := w.detectVersion(ctx, binary); err != nil {
+			return wrapperState{}, err
+		}
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return wrapperState{
+		version:                w.version,
+		versionStr:             w.versionStr,
+		capabilities:           w.capabilities,
+		supportsJSONStatistics: w.supportsJSONStatistics,
+	}, nil
 }
 
 // Configuration returns the current ccache configuration.
-func (w *Wrapper) Configuration() (*Configuration, error) {
+func (w *Wrapper) Configuration(ctx context.Context) (*Configuration, error) {
+	configuration, _, err := w.ConfigurationWithMode(ctx, ParseModeDefault)
+
+	return configuration, err
+}
+
+// ConfigurationWithMode returns the current ccache configuration, parsed with
+// the given mode.
+//
+// In lenient mode, settings with a malformed value are returned as warnings.
+func (w *Wrapper) ConfigurationWithMode(ctx context.Context, mode ParseMode) (*Configuration, []*ParseError, error) {
+	state, err := w.state(ctx)
+	if err != nil {
+		return &Configuration{}, nil, err
+	}
+
 	var out string
-	var err error
 
-	if w.version.LessThan(useLegacyParserForVersionsBelow) {
-		out, err = w.command.PrintConfig()
+	if state.capabilities.HasCommand(CommandShowConfig) {
+		out, err = w.command.ShowConfig(ctx)
 	} else {
-		out, err = w.command.ShowConfig()
+		out, err = w.command.PrintConfig(ctx)
 	}
 
 	if err != nil {
-		return &Configuration{}, err
+		return &Configuration{}, nil, err
 	}
 
-	return ParseConfiguration(out)
+	return ParseConfigurationWithMode(mode, out)
 }
 
 // Statistics returns the current ccache statistics.
-func (w *Wrapper) Statistics() (*Statistics, error) {
-	if w.version.LessThan(useLegacyParserForVersionsBelow) {
-		return w.legacyStatistics()
+func (w *Wrapper) Statistics(ctx context.Context) (*Statistics, error) {
+	stats, _, err := w.StatisticsWithMode(ctx, ParseModeDefault)
+
+	return stats, err
+}
+
+// StatisticsWithMode returns the current ccache statistics, parsed with the
+// given mode.
+//
+// In lenient mode, malformed entries are skipped and returned as warnings.
+func (w *Wrapper) StatisticsWithMode(ctx context.Context, mode ParseMode) (*Statistics, []*ParseError, error) {
+	state, err := w.state(ctx)
+	if err != nil {
+		return &Statistics{}, nil, err
+	}
+
+	if !state.capabilities.HasCommand(CommandPrintStats) {
+		return w.legacyStatistics(ctx, mode)
+	}
+
+	if state.supportsJSONStatistics {
+		out, err := w.command.PrintStatsJSON(ctx)
+		if err == nil {
+			stats, warnings, err := ParseStatisticsWithMode(StatisticsFormatJSON, mode, out)
+			if !isJSONDecodeError(err) {
+				// entries rejected by the parsing mode are reported as is
+				return stats, warnings, err
+			}
+
+			// this ccache build prints JSON that cannot be decoded
+			w.disableJSONStatistics(state.versionStr)
+		} else if ctxErr := ctx.Err(); ctxErr != nil {
+			// ccache was interrupted, JSON output may still be supported
+			return &Statistics{}, nil, ctxErr
+		} else if isJSONStatisticsUnsupported(err) {
+			w.disableJSONStatistics(state.versionStr)
+		}
+
+		// fall back to tab-separated values; other command failures may be
+		// transient, and JSON output is attempted again on the next call
+	}
+
+	return w.tsvStatistics(ctx, mode)
+}
+
+// disableJSONStatistics stops reading statistics as JSON, unless another
+// version of ccache was detected in the meantime.
+func (w *Wrapper) disableJSONStatistics(versionStr string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.versionStr == versionStr {
+		w.supportsJSONStatistics = false
+	}
+}
+
+func (w *Wrapper) legacyStatistics(ctx context.Context, mode ParseMode) (*Statistics, []*ParseError, error) {
+	out, err := w.command.ShowStats(ctx)
+	if err != nil {
+		return &Statistics{}, nil, err
 	}
 
-	return w.tsvStatistics()
+	return parseStatisticsInLocation(StatisticsFormatPre37, mode, w.location, out)
 }
 
-func (w *Wrapper) legacyStatistics() (*Statistics, error) {
-	out, err := w.command.ShowStats()
+func (w *Wrapper) tsvStatistics(ctx context.Context, mode ParseMode) (*Statistics, []*ParseError, error) {
+	out, err := w.command.PrintStats(ctx)
 	if err != nil {
-		return &Statistics{}, err
+		return &Statistics{}, nil, err
 	}
 
-	stats, err := ParsePre37Statistics(out)
+	return ParseStatisticsWithMode(StatisticsFormatTSV, mode, out)
+}
+
+// isJSONDecodeError returns whether an error of the JSON statistics parser
+// means that the output is not a JSON object, as opposed to entries rejected by
+// the parsing mode.
+func isJSONDecodeError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
 
-	return stats, err
+	return errors.As(err, &syntaxErr) ||
+		errors.As(err, &typeErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isJSONStatisticsUnsupported returns whether an error of
+// `ccache --print-stats --format=json` means that JSON output will never be
+// available, as opposed to a transient failure of the command.
+func isJSONStatisticsUnsupported(err error) bool {
+	if errors.Is(err, ErrOperationUnsupported) || errors.Is(err, ErrReplayOutputMissing) {
+		return true
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return unrecognizedOptionRegex.Match(exitErr.Stderr)
+	}
+
+	return unrecognizedOptionRegex.MatchString(err.Error())
 }
 
-func (w *Wrapper) tsvStatistics() (*Statistics, error) {
-	out, err := w.command.PrintStats()
+// Capabilities returns the commands, statistics counters and configuration
+// keys provided by the detected version of ccache.
+func (w *Wrapper) Capabilities(ctx context.Context) (*Capabilities, error) {
+	state, err := w.state(ctx)
 	if err != nil {
-		return &Statistics{}, err
+		return &Capabilities{}, err
 	}
 
-	return ParseTSVStatistics(out)
+	return state.capabilities, nil
 }
 
 // ParseVersion parses the semantic version for ccache.
-func (w *Wrapper) ParseVersion() (*semver.Version, error) {
-	out, err := w.command.Version()
+func (w *Wrapper) ParseVersion(ctx context.Context) (*semver.Version, error) {
+	out, err := w.command.Version(ctx)
 	if err != nil {
 		return &semver.Version{}, err
 	}
 
+	return parseVersion(out)
+}
+
+// parseVersion parses the semantic version printed by `ccache --version`.
+func parseVersion(out string) (*semver.Version, error) {
 	matches := versionRegex.FindStringSubmatch(out)
 	if len(matches) != 2 {
 		return &semver.Version{}, ErrVersionMissing
@@ -112,5 +394,21 @@ func (w *Wrapper) ParseVersion() (*semver.Version, error) {
 
 // Version returns the parsed version for ccache.
 func (w *Wrapper) Version() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
 	return w.versionStr
 }
+
+// VersionInfo returns the version, features and library versions of the
+// detected ccache build.
+func (w *Wrapper) VersionInfo() *VersionInfo {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return &VersionInfo{
+		Version:   w.versionInfo.Version,
+		Features:  slices.Clone(w.versionInfo.Features),
+		Libraries: maps.Clone(w.versionInfo.Libraries),
+	}
+}
@@ -4,7 +4,12 @@
 package ccache
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 )
@@ -13,28 +18,97 @@ var _ Command = &fakeCommand{}
 
 type fakeCommand struct {
 	version string
+
+	printStats        string
+	printStatsJSON    string
+	printStatsJSONErr error
+	showStats         string
+
+	// management operations and their arguments, in the order they were run
+	operations []string
+
+	// output of management operations
+	operationOutput string
+
+	// statistics printed once a management operation has run
+	printStatsAfterOperation string
 }
 
-func (c *fakeCommand) PrintConfig() (string, error) {
+func (c *fakeCommand) PrintConfig(_ context.Context) (string, error) {
 	return "", nil
 }
 
-func (c *fakeCommand) ShowConfig() (string, error) {
+func (c *fakeCommand) ShowConfig(_ context.Context) (string, error) {
 	return "", nil
 }
 
-func (c *fakeCommand) PrintStats() (string, error) {
-	return "", nil
+func (c *fakeCommand) PrintStats(_ context.Context) (string, error) {
+	return c.printStats, nil
 }
 
-func (c *fakeCommand) ShowStats() (string, error) {
-	return "", nil
+func (c *fakeCommand) PrintStatsJSON(_ context.Context) (string, error) {
+	return c.printStatsJSON, c.printStatsJSONErr
 }
 
-func (c *fakeCommand) Version() (string, error) {
+func (c *fakeCommand) ShowStats(_ context.Context) (string, error) {
+	return c.showStats, nil
+}
+
+func (c *fakeCommand) Version(_ context.Context) (string, error) {
 	return c.version, nil
 }
 
+func (c *fakeCommand) operation(args ...string) (string, error) {
+	c.operations = append(c.operations, strings.Join(args, " "))
+
+	if c.printStatsAfterOperation != "" {
+		c.printStats = c.printStatsAfterOperation
+	}
+
+	return c.operationOutput, nil
+}
+
+func (c *fakeCommand) ZeroStats(_ context.Context) (string, error) {
+	return c.operation("--zero-stats")
+}
+
+func (c *fakeCommand) Cleanup(_ context.Context) (string, error) {
+	return c.operation("--cleanup")
+}
+
+func (c *fakeCommand) Clear(_ context.Context) (string, error) {
+	return c.operation("--clear")
+}
+
+func (c *fakeCommand) EvictOlderThan(_ context.Context, age string) (string, error) {
+	return c.operation("--evict-older-than", age)
+}
+
+func (c *fakeCommand) Recompress(_ context.Context, level string) (string, error) {
+	return c.operation("--recompress", level)
+}
+
+func (c *fakeCommand) SetConfig(_ context.Context, key string, value string) (string, error) {
+	return c.operation("--set-config=" + key + "=" + value)
+}
+
+func (c *fakeCommand) SetMaxSize(_ context.Context, size string) (string, error) {
+	return c.operation("--max-size", size)
+}
+
+// newTestWrapper returns a Wrapper for the given command, failing the test if
+// the version of ccache cannot be detected.
+func newTestWrapper(t *testing.T, c Command, options ...WrapperOption) *Wrapper {
+	t.Helper()
+
+	w, err := NewWrapper(context.Background(), c, options...)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	return w
+}
+
 func TestWrapperParseVersion(t *testing.T) {
 	cases := []struct {
 		tname      string
@@ -80,9 +154,9 @@ version.
 			cmd := &fakeCommand{
 				version: tc.cmdVersion,
 			}
-			wrapper := NewWrapper(cmd)
+			wrapper := newTestWrapper(t, cmd)
 
-			got, err := wrapper.ParseVersion()
+			got, err := wrapper.ParseVersion(context.Background())
 			if err != nil {
 				t.Fatalf("want no error, got %q", err)
 			}
@@ -93,3 +167,349 @@ version.
 		})
 	}
 }
+
+func TestWrapperStatisticsFormat(t *testing.T) {
+	cases := []struct {
+		tname         string
+		cmd           *fakeCommand
+		wantCacheMiss int64
+	}{
+		{
+			tname: "ccache 4.9.1 prints tab-separated values",
+			cmd: &fakeCommand{
+				version:        "ccache version 4.9.1",
+				printStats:     "cache_miss\t1\n",
+				printStatsJSON: `{"cache_miss": 2}`,
+			},
+			wantCacheMiss: 1,
+		},
+		{
+			tname: "ccache 4.10 prints JSON",
+			cmd: &fakeCommand{
+				version:        "ccache version 4.10",
+				printStats:     "cache_miss\t1\n",
+				printStatsJSON: `{"cache_miss": 2}`,
+			},
+			wantCacheMiss: 2,
+		},
+		{
+			tname: "ccache 4.10 falls back to tab-separated values",
+			cmd: &fakeCommand{
+				version:           "ccache version 4.10",
+				printStats:        "cache_miss\t1\n",
+				printStatsJSONErr: errors.New("ccache: unrecognized option '--format=json'"),
+			},
+			wantCacheMiss: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			wrapper := newTestWrapper(t, tc.cmd)
+
+			got, err := wrapper.Statistics(context.Background())
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			assertIntFieldEquals(t, "CacheMiss", got.CacheMiss, tc.wantCacheMiss)
+		})
+	}
+}
+
+func TestWrapperStatisticsLocation(t *testing.T) {
+	cmd := &fakeCommand{
+		version:   "ccache version 3.6",
+		showStats: "stats updated                       Sat Oct  6 09:05:21 2018\ncache miss                             3\n",
+	}
+
+	wrapper := newTestWrapper(t, cmd, WithLocation(time.FixedZone("UTC+2", 2*60*60)))
+
+	got, err := wrapper.Statistics(context.Background())
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	assertTimeFieldEquals(t, "StatsTime", got.StatsTime, time.Date(2018, time.October, 6, 7, 5, 21, 0, time.UTC))
+}
+
+func TestWrapperStatisticsJSONFallback(t *testing.T) {
+	cases := []struct {
+		tname             string
+		printStatsJSON    string
+		printStatsJSONErr error
+		wantCacheMiss     int64
+	}{
+		{
+			tname:             "unrecognized option disables JSON",
+			printStatsJSONErr: errors.New("ccache: unrecognized option '--format=json'"),
+			wantCacheMiss:     1,
+		},
+		{
+			tname:             "unsupported operation disables JSON",
+			printStatsJSONErr: &UnsupportedOperationError{Operation: "--print-stats --format=json", Version: "4.10", MinVersion: "4.10"},
+			wantCacheMiss:     1,
+		},
+		{
+			tname:          "invalid JSON disables JSON",
+			printStatsJSON: "cache_miss\t2\n",
+			wantCacheMiss:  1,
+		},
+		{
+			tname:             "command failure keeps JSON",
+			printStatsJSONErr: errors.New("exit status 1"),
+			wantCacheMiss:     2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			cmd := &fakeCommand{
+				version:           "ccache version 4.10",
+				printStats:        "cache_miss\t1\n",
+				printStatsJSON:    tc.printStatsJSON,
+				printStatsJSONErr: tc.printStatsJSONErr,
+			}
+
+			wrapper := newTestWrapper(t, cmd)
+
+			got, err := wrapper.Statistics(context.Background())
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			assertIntFieldEquals(t, "CacheMiss", got.CacheMiss, 1)
+
+			// JSON output is available again
+			cmd.printStatsJSON = `{"cache_miss": 2}`
+			cmd.printStatsJSONErr = nil
+
+			got, err = wrapper.Statistics(context.Background())
+			if err != nil {
+				t.Fatalf("want no error, got %q", err)
+			}
+
+			assertIntFieldEquals(t, "CacheMiss", got.CacheMiss, tc.wantCacheMiss)
+		})
+	}
+}
+
+func TestWrapperStatisticsJSONStrictMode(t *testing.T) {
+	cmd := &fakeCommand{
+		version:        "ccache version 4.10",
+		printStats:     "cache_miss\t1\n",
+		printStatsJSON: `{"cache_miss": 2, "some_future_counter": 12}`,
+	}
+
+	wrapper := newTestWrapper(t, cmd)
+
+	if _, _, err := wrapper.StatisticsWithMode(context.Background(), ParseModeStrict); !errors.Is(err, ErrStatisticsKeyUnknown) {
+		t.Fatalf("want error %q, got %q", ErrStatisticsKeyUnknown, err)
+	}
+
+	// JSON output is still read in other modes
+	got, err := wrapper.Statistics(context.Background())
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	assertIntFieldEquals(t, "CacheMiss", got.CacheMiss, 2)
+}
+
+func TestWrapperStatisticsWithMode(t *testing.T) {
+	cmd := &fakeCommand{
+		version:    "ccache version 4.9.1",
+		printStats: "cache_miss\t1\ndirect_cache_hit\tmany\n",
+	}
+
+	wrapper := newTestWrapper(t, cmd)
+
+	if _, err := wrapper.Statistics(context.Background()); err == nil {
+		t.Fatal("expected an error, got none")
+	}
+
+	got, warnings, err := wrapper.StatisticsWithMode(context.Background(), ParseModeLenient)
+	if err != nil {
+		t.Fatalf("want no error, got %q", err)
+	}
+
+	assertIntFieldEquals(t, "CacheMiss", got.CacheMiss, 1)
+
+	if len(warnings) != 1 {
+		t.Fatalf("want 1 warning, got %d", len(warnings))
+	}
+
+	if warnings[0].Key != "direct_cache_hit" {
+		t.Errorf("want warning for key %q, got %q", "direct_cache_hit", warnings[0].Key)
+	}
+}
+
+var _ BinaryIdentifier = &upgradableCommand{}
+
+// upgradableCommand simulates a ccache executable that can be replaced while
+// in use.
+type upgradableCommand struct {
+	*fakeCommand
+
+	mu      sync.Mutex
+	binary  BinaryIdentity
+	version string
+}
+
+func (c *upgradableCommand) BinaryIdentity() (BinaryIdentity, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.binary, nil
+}
+
+func (c *upgradableCommand) Version(_ context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.version, nil
+}
+
+// upgrade replaces the executable with the given version.
+func (c *upgradableCommand) upgrade(version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.binary.Inode++
+	c.binary.ModTime = c.binary.ModTime.Add(time.Hour)
+	c.version = "ccache version " + version
+}
+
+func TestNewWrapperErrors(t *testing.T) {
+	cases := []struct {
+		tname   string
+		version string
+		wantErr error
+	}{
+		{
+			tname:   "missing version",
+			version: "ccache: command not found",
+			wantErr: ErrVersionMissing,
+		},
+		{
+			tname:   "invalid version",
+			version: "ccache version 4.x",
+			wantErr: semver.ErrInvalidSemVer,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tname, func(t *testing.T) {
+			_, err := NewWrapper(context.Background(), &fakeCommand{version: tc.version})
+
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("want error %q, got %q", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWrapperDetectsUpgrade(t *testing.T) {
+	cmd := &upgradableCommand{
+		fakeCommand: &fakeCommand{
+			showStats:      "cache miss                             1\n",
+			printStats:     "cache_miss\t2\n",
+			printStatsJSON: `{"cache_miss": 3}`,
+		},
+		binary: BinaryIdentity{
+			Path:    "/usr/bin/ccache",
+			Inode:   1,
+			ModTime: time.Date(2025, 3, 25, 0, 0, 0, 0, time.UTC),
+		},
+		version: "ccache version 3.6",
+	}
+
+	var changes []VersionChange
+
+	wrapper := newTestWrapper(t, cmd, WithVersionChangeHandler(func(change VersionChange) {
+		changes = append(changes, change)
+	}))
+
+	steps := []struct {
+		version       string
+		wantCacheMiss int64
+	}{
+		{version: "3.6", wantCacheMiss: 1},
+		{version: "4.9.1", wantCacheMiss: 2},
+		{version: "4.10", wantCacheMiss: 3},
+	}
+
+	for i, step := range steps {
+		if i > 0 {
+			cmd.upgrade(step.version)
+		}
+
+		got, err := wrapper.Statistics(context.Background())
+		if err != nil {
+			t.Fatalf("ccache %s: want no error, got %q", step.version, err)
+		}
+
+		assertIntFieldEquals(t, "CacheMiss", got.CacheMiss, step.wantCacheMiss)
+
+		if wrapper.Version() != step.version {
+			t.Errorf("want version %q, got %q", step.version, wrapper.Version())
+		}
+	}
+
+	wantChanges := []VersionChange{
+		{Previous: "3.6", Current: "4.9.1"},
+		{Previous: "4.9.1", Current: "4.10"},
+	}
+
+	if len(changes) != len(wantChanges) {
+		t.Fatalf("want %d version changes, got %d", len(wantChanges), len(changes))
+	}
+
+	for i, want := range wantChanges {
+		if changes[i].Previous != want.Previous || changes[i].Current != want.Current {
+			t.Errorf("want version change %s -> %s, got %s -> %s", want.Previous, want.Current, changes[i].Previous, changes[i].Current)
+		}
+
+		if changes[i].Binary == nil || changes[i].Binary.Inode != uint64(i+2) {
+			t.Errorf("want the identity of the new executable, got %v", changes[i].Binary)
+		}
+	}
+}
+
+func TestWrapperConcurrentStatistics(t *testing.T) {
+	cmd := &upgradableCommand{
+		fakeCommand: &fakeCommand{
+			printStats:        "cache_miss\t2\n",
+			printStatsJSONErr: errors.New("ccache: unrecognized option '--format=json'"),
+		},
+		version: "ccache version 4.9.1",
+	}
+
+	wrapper := newTestWrapper(t, cmd)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if i%4 == 0 {
+				cmd.upgrade("4.10")
+			}
+
+			got, err := wrapper.Statistics(context.Background())
+			if err != nil {
+				t.Errorf("want no error, got %q", err)
+				return
+			}
+
+			if got.CacheMiss != 2 {
+				t.Errorf("want CacheMiss 2, got %d", got.CacheMiss)
+			}
+		}()
+	}
+
+	wg.Wait()
+}